@@ -0,0 +1,40 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+// requireAdminTokenMiddleware rejects requests with 403 unless they provide the admin token as a bearer token.
+func (s *server) requireAdminTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Admin.Token)) != 1 {
+			s.handleError(w, r, fault.New(fault.PermissionDeniedCode, "Invalid admin token."))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// flushHandler stores logs buffered by the engine right away, returning the number of processed logs flushed.
+func (s *server) flushHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := s.services.Buffers.FlushBuffers(r.Context())
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	s.writeJson( // nolint:errcheck
+		w,
+		http.StatusOK,
+		apiResponse{
+			Success: true,
+			Data:    map[string]any{"flushed": count},
+		},
+		nil,
+	)
+}
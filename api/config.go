@@ -1,16 +1,176 @@
 package api
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thisisjab/logzilla/querier"
+)
+
+const (
+	// IngestModeDisabled disables the ingest endpoint.
+	IngestModeDisabled = ""
+	// IngestModeProcessed stores posted records directly as processed logs.
+	IngestModeProcessed = "processed"
+	// IngestModeRaw feeds posted records into the engine's processing pipeline.
+	IngestModeRaw = "raw"
+)
+
+const (
+	// ErrorFormatStandard writes errors like any other response, with success set to false.
+	ErrorFormatStandard = "standard"
+	// ErrorFormatProblem writes errors as RFC 7807 problem details, using the application/problem+json content type.
+	ErrorFormatProblem = "problem"
+)
 
 type CORSConfig struct {
+	// TrustedOrigins are the origins allowed to make cross-origin requests. "*" allows any origin, which is only
+	// meant for development.
 	TrustedOrigins []string `yaml:"trusted_origins"`
+	// AllowedMethods are the methods allowed in preflight requests. Defaults to GET, POST and OPTIONS.
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowedHeaders are the request headers allowed in preflight requests.
+	// Defaults to Authorization, Content-Type and X-Request-ID.
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// MaxAge is how long browsers may cache preflight responses. Zero leaves it to browsers.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+type IngestConfig struct {
+	Mode string `yaml:"mode"`
+	// Source is the name of the channel source raw records are pushed into.
+	// It is only used when Mode is "raw".
+	Source string `yaml:"source"`
+}
+
+// AdminConfig configures admin endpoints (e.g. `POST /api/admin/flush`), which are only served if Token is set.
+type AdminConfig struct {
+	// Token must be provided by clients of admin endpoints as a bearer token (`Authorization: Bearer <token>`).
+	Token string `yaml:"token"`
 }
 
+// TimeoutsConfig limits how long the server waits on clients, so slow clients can't hold connections indefinitely.
+type TimeoutsConfig struct {
+	// ReadHeader is the time allowed to read request headers. Defaults to 5 seconds.
+	ReadHeader time.Duration `yaml:"read_header"`
+	// Read is the time allowed to read a whole request, including its body. Defaults to 30 seconds.
+	Read time.Duration `yaml:"read"`
+	// Write is the time allowed to write a response, counted from the end of reading request headers.
+	// Defaults to MaxQueryTimeout plus 10 seconds, so queries can use their whole timeout.
+	Write time.Duration `yaml:"write"`
+	// Idle is how long idle keep-alive connections are kept open. Defaults to 2 minutes.
+	Idle time.Duration `yaml:"idle"`
+}
+
+// StorageConnectConfig is the retry policy used to connect to the storage on start.
+type StorageConnectConfig struct {
+	// MaxAttempts is the number of connection attempts before giving up. Defaults to 10.
+	MaxAttempts uint `yaml:"max_attempts"`
+	// InitialBackoff is the delay after the first failed attempt. It's doubled after each attempt. Defaults to 500ms.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// MaxBackoff caps the delay between attempts. Defaults to 30s.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+const (
+	defaultStorageConnectMaxAttempts    = 10
+	defaultStorageConnectInitialBackoff = 500 * time.Millisecond
+	defaultStorageConnectMaxBackoff     = 30 * time.Second
+
+	defaultMaxQueryTimeout = time.Minute
+	defaultShutdownTimeout = 10 * time.Second
+
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	// writeTimeoutMargin is added to MaxQueryTimeout for the default write timeout.
+	writeTimeoutMargin = 10 * time.Second
+)
+
+var (
+	defaultCORSAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	defaultCORSAllowedHeaders = []string{"Authorization", "Content-Type", requestIDHeader}
+)
+
 type Config struct {
-	Addr     string     `yaml:"addr"`
-	CertFile string     `yaml:"cert_file"`
-	KeyFile  string     `yaml:"key_file"`
-	CORS     CORSConfig `yaml:"cors"`
+	Addr     string       `yaml:"addr"`
+	CertFile string       `yaml:"cert_file"`
+	KeyFile  string       `yaml:"key_file"`
+	CORS     CORSConfig   `yaml:"cors"`
+	Ingest   IngestConfig `yaml:"ingest"`
+	// TimeZone is the IANA name of the zone timestamps without a zone are interpreted in (e.g. "America/New_York").
+	// Queries can override it. Defaults to UTC.
+	TimeZone string `yaml:"time_zone"`
+	// ErrorFormat is either "standard" or "problem". Defaults to "standard".
+	ErrorFormat string `yaml:"error_format"`
+	// MaxQueryTimeout caps the timeout clients can request for queries. Defaults to 1 minute.
+	MaxQueryTimeout time.Duration `yaml:"max_query_timeout"`
+	// CursorSecret signs pagination cursors, so clients can't forge them. If empty, a random secret is generated on
+	// start, so cursors don't survive restarts and aren't shared between instances.
+	CursorSecret string `yaml:"cursor_secret"`
+	// ShutdownTimeout is how long in-flight requests are waited for on shutdown. Defaults to 10 seconds.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Timeouts limit how long the server waits on clients.
+	Timeouts TimeoutsConfig `yaml:"timeouts"`
+	// StorageConnect is only used when the server connects to the storage by itself (see Services.Storage).
+	StorageConnect StorageConnectConfig `yaml:"storage_connect"`
+	// Admin configures admin endpoints, which are disabled by default.
+	Admin AdminConfig `yaml:"admin"`
+	// QueryRetry configures retrying queries failing due to the storage, and the breaker failing them fast while
+	// the storage keeps failing.
+	QueryRetry querier.RetryConfig `yaml:"query_retry"`
+}
+
+func (c *Config) setDefaults() {
+	if c.ErrorFormat == "" {
+		c.ErrorFormat = ErrorFormatStandard
+	}
+
+	if len(c.CORS.AllowedMethods) == 0 {
+		c.CORS.AllowedMethods = defaultCORSAllowedMethods
+	}
+
+	if len(c.CORS.AllowedHeaders) == 0 {
+		c.CORS.AllowedHeaders = defaultCORSAllowedHeaders
+	}
+
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	if c.MaxQueryTimeout == 0 {
+		c.MaxQueryTimeout = defaultMaxQueryTimeout
+	}
+
+	if c.Timeouts.ReadHeader == 0 {
+		c.Timeouts.ReadHeader = defaultReadHeaderTimeout
+	}
+
+	if c.Timeouts.Read == 0 {
+		c.Timeouts.Read = defaultReadTimeout
+	}
+
+	if c.Timeouts.Write == 0 {
+		c.Timeouts.Write = c.MaxQueryTimeout + writeTimeoutMargin
+	}
+
+	if c.Timeouts.Idle == 0 {
+		c.Timeouts.Idle = defaultIdleTimeout
+	}
+
+	if c.StorageConnect.MaxAttempts == 0 {
+		c.StorageConnect.MaxAttempts = defaultStorageConnectMaxAttempts
+	}
+
+	if c.StorageConnect.InitialBackoff == 0 {
+		c.StorageConnect.InitialBackoff = defaultStorageConnectInitialBackoff
+	}
+
+	if c.StorageConnect.MaxBackoff == 0 {
+		c.StorageConnect.MaxBackoff = defaultStorageConnectMaxBackoff
+	}
 }
 
 func (c Config) Validate() error {
@@ -18,5 +178,49 @@ func (c Config) Validate() error {
 		return errors.New("api server address is required")
 	}
 
+	switch c.Ingest.Mode {
+	case IngestModeDisabled, IngestModeProcessed:
+	case IngestModeRaw:
+		if c.Ingest.Source == "" {
+			return errors.New("ingest source is required in raw ingest mode")
+		}
+	default:
+		return fmt.Errorf("invalid ingest mode: %s", c.Ingest.Mode)
+	}
+
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone: %w", err)
+	}
+
+	switch c.ErrorFormat {
+	case "", ErrorFormatStandard, ErrorFormatProblem:
+	default:
+		return fmt.Errorf("invalid error format: %s", c.ErrorFormat)
+	}
+
+	if c.CORS.MaxAge < 0 {
+		return errors.New("cors max age cannot be negative")
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return errors.New("shutdown timeout cannot be negative")
+	}
+
+	if c.MaxQueryTimeout < 0 {
+		return errors.New("max query timeout cannot be negative")
+	}
+
+	if c.Timeouts.ReadHeader < 0 || c.Timeouts.Read < 0 || c.Timeouts.Write < 0 || c.Timeouts.Idle < 0 {
+		return errors.New("server timeouts cannot be negative")
+	}
+
+	if c.StorageConnect.InitialBackoff < 0 || c.StorageConnect.MaxBackoff < 0 {
+		return errors.New("storage connect backoff cannot be negative")
+	}
+
+	if err := c.QueryRetry.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
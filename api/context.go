@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	requestIDContextKey = contextKey("request_id")
+	loggerContextKey    = contextKey("logger")
+)
+
+// contextSetRequestID returns a copy of r carrying the request ID and a logger annotated with it.
+func (s *server) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	ctx = context.WithValue(ctx, loggerContextKey, s.logger.With("request-id", requestID))
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the request ID of r, or an empty string if it has none.
+func contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// requestLogger returns the logger of the request. It falls back to the server logger outside of requestIDMiddleware.
+func (s *server) requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return s.logger
+}
@@ -1,13 +1,21 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"maps"
 	"net/http"
 
 	"github.com/thisisjab/logzilla/fault"
 )
 
 func (s *server) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		s.writeError(w, r, http.StatusGatewayTimeout, apiResponse{Success: false, Message: "Request timed out."})
+		return
+	}
+
 	var f fault.Fault
 	if errors.As(err, &f) {
 		switch f.Code() {
@@ -50,6 +58,13 @@ func (s *server) handleError(w http.ResponseWriter, r *http.Request, err error)
 			}
 			s.writeError(w, r, http.StatusForbidden, apiResponse{Success: false, Message: m})
 
+		case fault.UnavailableCode:
+			m := f.Message()
+			if m == "" {
+				m = "Service unavailable."
+			}
+			s.writeError(w, r, http.StatusServiceUnavailable, apiResponse{Success: false, Message: m})
+
 		default:
 			s.internalServerError(w, r, f)
 		}
@@ -61,13 +76,52 @@ func (s *server) handleError(w http.ResponseWriter, r *http.Request, err error)
 }
 
 func (s *server) logError(w http.ResponseWriter, r *http.Request, err error) {
-	s.logger.Error("internal server error", "method", r.Method, "path", r.RequestURI, "remote-addr", r.RemoteAddr, "error", err)
+	s.requestLogger(r).Error("internal server error", "method", r.Method, "path", r.RequestURI, "remote-addr", r.RemoteAddr, "error", err)
 }
 
 func (s *server) writeError(w http.ResponseWriter, r *http.Request, status int, response apiResponse) {
+	if requestID := contextGetRequestID(r); requestID != "" {
+		if response.Metadata == nil {
+			response.Metadata = map[string]any{}
+		}
+		response.Metadata["request_id"] = requestID
+	}
+
+	if s.cfg.ErrorFormat == ErrorFormatProblem {
+		s.writeProblem(w, status, response) //nolint:errcheck
+		return
+	}
+
 	s.writeJson(w, status, response, nil) //nolint:errcheck
 }
 
+// writeProblem writes the error response as RFC 7807 problem details. Metadata entries (e.g. field errors) are
+// written as extension members.
+func (s *server) writeProblem(w http.ResponseWriter, status int, response apiResponse) error {
+	problem := make(map[string]any, len(response.Metadata)+4)
+	maps.Copy(problem, response.Metadata)
+
+	problem["type"] = "about:blank"
+	problem["title"] = http.StatusText(status)
+	problem["status"] = status
+	if response.Message != "" {
+		problem["detail"] = response.Message
+	}
+
+	js, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(js) //nolint:errcheck
+
+	return nil
+}
+
 func (s *server) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
 	s.logError(w, r, err)
 	s.writeError(w, r, http.StatusInternalServerError, apiResponse{Success: false, Message: "Internal server error"})
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+func TestHandleErrorFormats(t *testing.T) {
+	err := fault.New(fault.BadInputCode, "Invalid query.").WithMetadata(fault.FieldErrorsMetadata{"limit": {"Field is required."}})
+	fields := map[string]any{"limit": []any{"Field is required."}}
+
+	tests := []struct {
+		format          string
+		wantContentType string
+		want            map[string]any
+	}{
+		{
+			format:          ErrorFormatStandard,
+			wantContentType: "application/json",
+			want:            map[string]any{"success": false, "message": "Invalid query.", "metadata": map[string]any{"fields": fields}},
+		},
+		{
+			format:          ErrorFormatProblem,
+			wantContentType: "application/problem+json",
+			want: map[string]any{"type": "about:blank", "title": "Unprocessable Entity", "status": float64(http.StatusUnprocessableEntity),
+				"detail": "Invalid query.", "fields": fields},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			s := newTestServer(t, Config{ErrorFormat: tt.format}, Services{Querier: &fakeQuerier{}})
+
+			rec := httptest.NewRecorder()
+			s.handleError(rec, httptest.NewRequest(http.MethodGet, "/", nil), err)
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("got content type %q, want %q", got, tt.wantContentType)
+			}
+
+			var got map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("cannot decode response body: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got body %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
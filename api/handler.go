@@ -1,8 +1,14 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/fault"
 	"github.com/thisisjab/logzilla/querier"
 )
 
@@ -10,32 +16,416 @@ func (s *server) searchLogsHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO: add documentation
 
 	// Reading query object from request
-	var logQuery querier.Query
+	logQuery := querier.Query{TimeZone: s.cfg.TimeZone}
 	if s.returnOnError(w, r, s.readJson(w, r, &logQuery)) {
 		return
 	}
 
+	// Cursors are signed by the server, so a verified cursor is replaced by the payload storages understand.
+	if logQuery.Cursor != "" {
+		c, err := querier.DecodeSignedCursor(logQuery.Cursor, s.cursorSecret)
+		if s.returnOnError(w, r, err) {
+			return
+		}
+		logQuery.Cursor = c.Encode()
+	}
+
+	if s.returnOnError(w, r, logQuery.Validate()) {
+		return
+	}
+
+	withCount, err := readBoolQueryParam(r, "count")
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	explain, err := readBoolQueryParam(r, "explain")
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	timeout, err := s.readQueryTimeout(r)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	if explain && s.explainer == nil {
+		s.handleError(w, r, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"explain": []string{"Storage does not support explaining queries."},
+		}))
+		return
+	}
+
 	// Preparing request
-	req := querier.QueryRequest{Query: logQuery}
+	req := querier.QueryRequest{Query: logQuery, Timeout: timeout}
 
 	// Getting response
-	resp, err := s.services.storage.Query(r.Context(), req)
+	// One extra record is fetched to find out whether more records exist, without an extra count query. It's only
+	// requested for the fetch, so counting and explaining use the query as given.
+	fetchReq := req
+	fetchReq.Query.Limit++
+	resp, err := s.services.Querier.Query(r.Context(), fetchReq)
 	if s.returnOnError(w, r, err) {
 		return
 	}
 
+	hasMore := len(resp.Records) > logQuery.Limit
+	if hasMore {
+		resp.Records = resp.Records[:logQuery.Limit]
+	}
+
+	// Cursors are keyed by time, so they can only be provided for results sorted by time. Queries without sort fields
+	// may still be sorted by a default sort of the querier.
+	cursor := resp.Cursor
+	if hasMore && len(logQuery.Sort) == 0 && len(resp.DefaultSort) == 0 {
+		if last := resp.Records[len(resp.Records)-1]; last.ID != uuid.Nil && !last.Timestamp.IsZero() {
+			cursor = querier.NewCursor(last).EncodeSigned(s.cursorSecret)
+		}
+	}
+
+	pagination := map[string]any{
+		"cursor":   cursor,
+		"has_more": hasMore,
+	}
+
+	var data any = resp.Records
+	if len(logQuery.Fields) > 0 {
+		projected := make([]map[string]any, len(resp.Records))
+		for i, record := range resp.Records {
+			projected[i] = querier.Project(record, logQuery.Fields)
+		}
+		data = projected
+	}
+
+	if withCount {
+		total, err := s.services.Querier.Count(r.Context(), req)
+		if s.returnOnError(w, r, err) {
+			return
+		}
+		pagination["total"] = total
+	}
+
+	metadata := map[string]any{"pagination": pagination}
+
+	if explain {
+		explanation, err := s.explainer.Explain(req)
+		if s.returnOnError(w, r, err) {
+			return
+		}
+		metadata["explain"] = explanation
+	}
+
 	// Return JSON response
+	s.writeJson( // nolint:errcheck
+		w,
+		http.StatusOK,
+		apiResponse{
+			Success:  true,
+			Data:     data,
+			Metadata: metadata,
+		},
+		nil,
+	)
+
+}
+
+// getLogHandler returns the processed log with the id given in the path.
+func (s *server) getLogHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		s.handleError(w, r, fault.New(fault.BadInputCode, "Log id must be a UUID."))
+		return
+	}
+
+	record, err := s.services.Querier.Get(r.Context(), id)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	s.writeJson( // nolint:errcheck
+		w,
+		http.StatusOK,
+		apiResponse{
+			Success: true,
+			Data:    record,
+		},
+		nil,
+	)
+}
+
+func (s *server) facetsHandler(w http.ResponseWriter, r *http.Request) {
+	field := r.URL.Query().Get("field")
+	if field == "" {
+		s.handleError(w, r, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{"Field is required."},
+		}))
+		return
+	}
+
+	now := time.Now()
+
+	start, err := s.readTimeQueryParam(r, "start", now)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	end, err := s.readTimeQueryParam(r, "end", now)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	timeout, err := s.readQueryTimeout(r)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	req := querier.QueryRequest{Query: querier.Query{Start: start, End: end}, Timeout: timeout}
+
+	facets, err := s.services.Querier.GroupByCount(r.Context(), req, field)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	s.writeJson( // nolint:errcheck
+		w,
+		http.StatusOK,
+		apiResponse{
+			Success: true,
+			Data:    facets,
+		},
+		nil,
+	)
+}
+
+// distinctHandler lists distinct values of a field, or a metadata path, in the logs within a time window.
+func (s *server) distinctHandler(w http.ResponseWriter, r *http.Request) {
+	const defaultLimit = 100
+	const maxLimit = 1000
+
+	field := r.URL.Query().Get("field")
+	if field == "" {
+		s.handleError(w, r, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{"Field is required."},
+		}))
+		return
+	}
+
+	limit, err := readIntQueryParam(r, "limit", defaultLimit)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	if limit < 1 || limit > maxLimit {
+		s.handleError(w, r, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"limit": []string{fmt.Sprintf("Expected a value between 1 and %d.", maxLimit)},
+		}))
+		return
+	}
+
+	now := time.Now()
+
+	start, err := s.readTimeQueryParam(r, "start", now)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	end, err := s.readTimeQueryParam(r, "end", now)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	timeout, err := s.readQueryTimeout(r)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	req := querier.QueryRequest{Query: querier.Query{Start: start, End: end, Limit: limit}, Timeout: timeout}
+
+	values, err := s.services.Querier.Distinct(r.Context(), req, field)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	// Values are never encoded as null, so clients can always iterate them.
+	if values == nil {
+		values = []string{}
+	}
+
+	s.writeJson( // nolint:errcheck
+		w,
+		http.StatusOK,
+		apiResponse{
+			Success: true,
+			Data:    map[string]any{"field": field, "values": values},
+		},
+		nil,
+	)
+}
+
+// aggregateHandler applies an aggregate function to a numeric metadata path of the logs within a time window.
+func (s *server) aggregateHandler(w http.ResponseWriter, r *http.Request) {
+	fn := r.URL.Query().Get("function")
+	field := r.URL.Query().Get("field")
+	if s.returnOnError(w, r, querier.ValidateAggregate(fn, field)) {
+		return
+	}
+
+	now := time.Now()
+
+	start, err := s.readTimeQueryParam(r, "start", now)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	end, err := s.readTimeQueryParam(r, "end", now)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	timeout, err := s.readQueryTimeout(r)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	req := querier.QueryRequest{Query: querier.Query{Start: start, End: end}, Timeout: timeout}
+
+	value, err := s.services.Querier.Aggregate(r.Context(), req, fn, field)
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
 	s.writeJson( // nolint:errcheck
 		w,
 		http.StatusOK,
 		apiResponse{
 			Success: true,
-			Data:    resp.Records,
-			Metadata: map[string]any{"pagination": map[string]any{
-				"cursor": resp.Cursor,
-			}},
+			Data:    map[string]any{"function": fn, "field": field, "value": value},
 		},
 		nil,
 	)
+}
+
+type ingestProcessedLogsRequest struct {
+	Records []entity.LogRecord `json:"records"`
+}
+
+// prepareIngestedRecord validates a posted record, giving it an id unless it has one. Levels may be posted by name
+// (e.g. "info") or by their numeric value.
+func prepareIngestedRecord(record entity.LogRecord) (entity.LogRecord, error) {
+	record.Timestamp = record.Timestamp.UTC()
+
+	if record.ID == uuid.Nil {
+		record.ID = uuid.New()
+	}
+
+	return record, record.Validate()
+}
+
+const (
+	ingestStatusAccepted = "accepted"
+	ingestStatusError    = "error"
+)
+
+// ingestRecordResult is the result of ingesting a single posted record.
+type ingestRecordResult struct {
+	Index  int                       `json:"index"`
+	Status string                    `json:"status"`
+	Errors fault.FieldErrorsMetadata `json:"errors,omitempty"`
+}
+
+type ingestRawLogsRequest struct {
+	Records []string `json:"records"`
+}
+
+// ingestLogsHandler stores or pushes posted records. In processed mode, invalid records don't fail the whole batch:
+// valid records are still stored, and the result of each record is reported (with 207 if only some were accepted).
+func (s *server) ingestLogsHandler(w http.ResponseWriter, r *http.Request) {
+	var records []entity.LogRecord
+	var results []ingestRecordResult
 
+	switch s.cfg.Ingest.Mode {
+	case IngestModeProcessed:
+		var req ingestProcessedLogsRequest
+		if s.returnOnError(w, r, s.readJson(w, r, &req)) {
+			return
+		}
+
+		fieldErrors := fault.FieldErrorsMetadata{}
+		results = make([]ingestRecordResult, len(req.Records))
+		for i, rec := range req.Records {
+			record, err := prepareIngestedRecord(rec)
+
+			var f fault.Fault
+			if errors.As(err, &f) {
+				md, _ := f.Metadata().(fault.FieldErrorsMetadata)
+				for field, messages := range md {
+					fieldErrors[fmt.Sprintf("records.%d.%s", i, field)] = messages
+				}
+				results[i] = ingestRecordResult{Index: i, Status: ingestStatusError, Errors: md}
+				continue
+			}
+
+			records = append(records, record)
+			results[i] = ingestRecordResult{Index: i, Status: ingestStatusAccepted}
+		}
+
+		// The batch is only rejected as a whole if none of the records are valid.
+		if len(records) == 0 && len(fieldErrors) > 0 {
+			s.handleError(w, r, fault.New(fault.BadInputCode, "").WithMetadata(fieldErrors))
+			return
+		}
+
+	case IngestModeRaw:
+		var req ingestRawLogsRequest
+		if s.returnOnError(w, r, s.readJson(w, r, &req)) {
+			return
+		}
+
+		// Raw records are timestamped on arrival, just like records read by a file source.
+		// Processors usually override the timestamp with the one found in the log itself.
+		now := time.Now().UTC()
+		for _, data := range req.Records {
+			records = append(records, entity.LogRecord{
+				RawData:    []byte(data),
+				Timestamp:  now,
+				IngestedAt: now,
+			})
+		}
+	}
+
+	if len(records) == 0 {
+		s.handleError(w, r, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"records": []string{"At least one record is required."},
+		}))
+		return
+	}
+
+	var err error
+	if s.cfg.Ingest.Mode == IngestModeRaw {
+		err = s.services.RawLogs.Push(r.Context(), records...)
+	} else {
+		err = s.services.ProcessedLogs.StoreProcessedLogs(r.Context(), records...)
+	}
+	if s.returnOnError(w, r, err) {
+		return
+	}
+
+	status := http.StatusAccepted
+	metadata := map[string]any{"count": len(records)}
+	if results != nil {
+		metadata["results"] = results
+		if len(records) < len(results) {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	s.writeJson( // nolint:errcheck
+		w,
+		status,
+		apiResponse{
+			Success:  true,
+			Metadata: metadata,
+		},
+		nil,
+	)
 }
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/querier"
+	"github.com/thisisjab/logzilla/storage"
+)
+
+func TestSearchLogsHandlerPagination(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var records []entity.LogRecord
+	for i := range 3 {
+		records = append(records, entity.LogRecord{ID: uuid.New(), Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	tests := []struct {
+		name        string
+		limit       int
+		wantRecords int
+		wantHasMore bool
+	}{
+		{name: "more records", limit: 2, wantRecords: 2, wantHasMore: true},
+		{name: "last page", limit: 3, wantRecords: 3, wantHasMore: false},
+		{name: "beyond last page", limit: 5, wantRecords: 3, wantHasMore: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{}, Services{Querier: &fakeQuerier{resp: querier.QueryResponse{Records: records}}})
+
+			status, resp := doJSON(t, s, http.MethodPost, "/api/logs/search?count=true&explain=true", map[string]any{
+				"start": start,
+				"limit": tt.limit,
+			})
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %+v", status, http.StatusOK, resp)
+			}
+
+			if got := len(resp.Data.([]any)); got != tt.wantRecords {
+				t.Errorf("got %d records, want %d", got, tt.wantRecords)
+			}
+
+			pagination := resp.Metadata["pagination"].(map[string]any)
+			if got := pagination["has_more"]; got != tt.wantHasMore {
+				t.Errorf("got has_more %v, want %v", got, tt.wantHasMore)
+			}
+
+			if got := pagination["total"]; got != float64(len(records)) {
+				t.Errorf("got total %v, want %d", got, len(records))
+			}
+
+			// The extra record fetched to find out whether more exist must not leak into the explained query.
+			explain := resp.Metadata["explain"].(map[string]any)
+			if got, want := explain["query"], fmt.Sprintf("LIMIT %d", tt.limit); got != want {
+				t.Errorf("got explained query %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSearchLogsHandlerCursorOnlyForTimeSort(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var records []entity.LogRecord
+	for i := range 3 {
+		records = append(records, entity.LogRecord{ID: uuid.New(), Source: "api", Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	tests := []struct {
+		name        string
+		sort        []querier.SortField
+		defaultSort []querier.SortField
+		wantCursor  bool
+	}{
+		{name: "sorted by time", wantCursor: true},
+		{name: "sort fields", sort: []querier.SortField{{Name: "source"}}},
+		{name: "default sort of the querier", defaultSort: []querier.SortField{{Name: "source"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &fakeQuerier{resp: querier.QueryResponse{Records: records, DefaultSort: tt.defaultSort}}
+			s := newTestServer(t, Config{}, Services{Querier: q})
+
+			status, resp := doJSON(t, s, http.MethodPost, "/api/logs/search", map[string]any{
+				"start":       start,
+				"limit":       2,
+				"sort_fields": tt.sort,
+			})
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %+v", status, http.StatusOK, resp)
+			}
+
+			pagination := resp.Metadata["pagination"].(map[string]any)
+			if pagination["has_more"] != true {
+				t.Fatalf("got pagination %v, want more records", pagination)
+			}
+			if got := pagination["cursor"] != ""; got != tt.wantCursor {
+				t.Errorf("got cursor %q, want a cursor %v", pagination["cursor"], tt.wantCursor)
+			}
+		})
+	}
+}
+
+// fakeProcessedLogsStorer keeps the logs it's asked to store.
+type fakeProcessedLogsStorer struct {
+	stored []entity.LogRecord
+}
+
+func (f *fakeProcessedLogsStorer) StoreProcessedLogs(_ context.Context, logs ...entity.LogRecord) error {
+	f.stored = append(f.stored, logs...)
+	return nil
+}
+
+func TestIngestLogsHandlerMixedValidity(t *testing.T) {
+	storer := &fakeProcessedLogsStorer{}
+	s := newTestServer(t, Config{Ingest: IngestConfig{Mode: IngestModeProcessed}}, Services{
+		Querier:       &fakeQuerier{},
+		ProcessedLogs: storer,
+	})
+
+	now := time.Now()
+	status, resp := doJSON(t, s, http.MethodPost, "/api/logs/ingest", map[string]any{
+		"records": []map[string]any{
+			{"source": "api", "level": "info", "timestamp": now, "message": "valid"},
+			{"source": "api", "level": "bogus", "timestamp": now, "message": "unknown level"},
+			{"level": "error", "timestamp": now, "message": "missing source"},
+		},
+	})
+	if status != http.StatusMultiStatus {
+		t.Fatalf("got status %d, want %d: %+v", status, http.StatusMultiStatus, resp)
+	}
+
+	if len(storer.stored) != 1 || storer.stored[0].Message != "valid" {
+		t.Fatalf("got stored records %+v, want only the valid one", storer.stored)
+	}
+
+	results := resp.Metadata["results"].([]any)
+	wantStatuses := []string{ingestStatusAccepted, ingestStatusError, ingestStatusError}
+	if len(results) != len(wantStatuses) {
+		t.Fatalf("got %d results, want %d", len(results), len(wantStatuses))
+	}
+
+	for i, want := range wantStatuses {
+		result := results[i].(map[string]any)
+		if result["index"] != float64(i) || result["status"] != want {
+			t.Errorf("got result %v, want index %d with status %q", result, i, want)
+		}
+	}
+
+	if _, ok := results[2].(map[string]any)["errors"].(map[string]any)["source"]; !ok {
+		t.Errorf("got result %v, want an error for the missing source", results[2])
+	}
+}
+
+func TestIngestLogsHandlerAllInvalid(t *testing.T) {
+	storer := &fakeProcessedLogsStorer{}
+	s := newTestServer(t, Config{Ingest: IngestConfig{Mode: IngestModeProcessed}}, Services{
+		Querier:       &fakeQuerier{},
+		ProcessedLogs: storer,
+	})
+
+	status, _ := doJSON(t, s, http.MethodPost, "/api/logs/ingest", map[string]any{
+		"records": []map[string]any{{"message": "missing everything"}},
+	})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if len(storer.stored) != 0 {
+		t.Fatalf("got stored records %+v, want none", storer.stored)
+	}
+}
+
+func TestSearchLogsHandlerRejectsTamperedCursor(t *testing.T) {
+	s := newTestServer(t, Config{CursorSecret: "secret"}, Services{Querier: &fakeQuerier{}})
+	cursor := querier.Cursor{Timestamp: time.Now(), ID: uuid.New()}
+
+	body := func(c string) map[string]any {
+		return map[string]any{"start": time.Now().Add(-time.Hour), "limit": 1, "cursor": c}
+	}
+
+	if status, resp := doJSON(t, s, http.MethodPost, "/api/logs/search", body(cursor.EncodeSigned([]byte("secret")))); status != http.StatusOK {
+		t.Fatalf("got status %d for a signed cursor, want %d: %+v", status, http.StatusOK, resp)
+	}
+
+	if status, _ := doJSON(t, s, http.MethodPost, "/api/logs/search", body(cursor.EncodeSigned([]byte("forged")))); status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d for a tampered cursor, want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+// fakeRawLogsPusher keeps the logs pushed into it.
+type fakeRawLogsPusher struct {
+	pushed []entity.LogRecord
+}
+
+func (f *fakeRawLogsPusher) Push(_ context.Context, logs ...entity.LogRecord) error {
+	f.pushed = append(f.pushed, logs...)
+	return nil
+}
+
+func TestIngestLogsHandlerRawMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		records    []string
+		wantStatus int
+	}{
+		{name: "records are pushed", records: []string{`{"level": "info"}`, "plain text line"}, wantStatus: http.StatusAccepted},
+		{name: "no records", records: []string{}, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pusher := &fakeRawLogsPusher{}
+			s := newTestServer(t, Config{Ingest: IngestConfig{Mode: IngestModeRaw, Source: "ingest"}}, Services{
+				Querier: &fakeQuerier{},
+				RawLogs: pusher,
+			})
+
+			status, resp := doJSON(t, s, http.MethodPost, "/api/logs/ingest", map[string]any{"records": tt.records})
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.wantStatus, resp)
+			}
+
+			if len(pusher.pushed) != len(tt.records) {
+				t.Fatalf("got %d pushed records, want %d", len(pusher.pushed), len(tt.records))
+			}
+
+			// Raw records are left to processors, only timestamped on arrival.
+			for i, r := range pusher.pushed {
+				if string(r.RawData) != tt.records[i] || r.Message != "" {
+					t.Errorf("got record %+v, want raw data %q left unprocessed", r, tt.records[i])
+				}
+				if r.Timestamp.IsZero() || r.IngestedAt.IsZero() {
+					t.Errorf("got timestamp %v and ingestion time %v, want both set", r.Timestamp, r.IngestedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestFacetsHandler(t *testing.T) {
+	at := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	memory := storage.NewMemoryStorage(storage.MemoryStorageConfig{})
+	err := memory.StoreProcessedLogs(context.Background(),
+		entity.LogRecord{ID: uuid.New(), Source: "api", Level: entity.LogLevelError, Timestamp: at},
+		entity.LogRecord{ID: uuid.New(), Source: "api", Level: entity.LogLevelInfo, Timestamp: at.Add(time.Second)},
+		entity.LogRecord{ID: uuid.New(), Source: "worker", Level: entity.LogLevelError, Timestamp: at.Add(2 * time.Second)},
+		entity.LogRecord{ID: uuid.New(), Source: "worker", Level: entity.LogLevelError, Timestamp: at.Add(time.Hour)},
+	)
+	if err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	s := newTestServer(t, Config{}, Services{Querier: memory})
+	window := "&start=2024-01-02T00:00:00Z&end=2024-01-02T00:01:00Z"
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []any
+	}{
+		{
+			name:       "per level",
+			query:      "field=level" + window,
+			wantStatus: http.StatusOK,
+			want:       []any{map[string]any{"value": "ERROR", "count": float64(2)}, map[string]any{"value": "INFO", "count": float64(1)}},
+		},
+		{
+			name:       "per source",
+			query:      "field=source" + window,
+			wantStatus: http.StatusOK,
+			want:       []any{map[string]any{"value": "api", "count": float64(2)}, map[string]any{"value": "worker", "count": float64(1)}},
+		},
+		{name: "missing field", query: window[1:], wantStatus: http.StatusUnprocessableEntity},
+		{name: "field not allowed", query: "field=message" + window, wantStatus: http.StatusUnprocessableEntity},
+		{name: "invalid start", query: "field=level&start=yesterday", wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := doJSON(t, s, http.MethodGet, "/api/facets?"+tt.query, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.wantStatus, resp)
+			}
+
+			if tt.want != nil && !reflect.DeepEqual(resp.Data, tt.want) {
+				t.Errorf("got facets %v, want %v", resp.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLogsHandlerProjectsFields(t *testing.T) {
+	record := entity.LogRecord{ID: uuid.New(), Source: "api", Message: "slow query", Metadata: map[string]any{"duration": "3s"}}
+	s := newTestServer(t, Config{}, Services{Querier: &fakeQuerier{resp: querier.QueryResponse{Records: []entity.LogRecord{record}}}})
+
+	status, resp := doJSON(t, s, http.MethodPost, "/api/logs/search", map[string]any{
+		"start":  time.Now(),
+		"limit":  10,
+		"fields": []string{"message", "metadata.duration"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %+v", status, http.StatusOK, resp)
+	}
+
+	want := []any{map[string]any{"message": "slow query", "metadata.duration": "3s"}}
+	if !reflect.DeepEqual(resp.Data, want) {
+		t.Errorf("got records %v, want %v", resp.Data, want)
+	}
+}
+
+func TestReadQueryTimeout(t *testing.T) {
+	s := newTestServer(t, Config{MaxQueryTimeout: 5 * time.Second}, Services{Querier: &fakeQuerier{}})
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "missing", want: 0},
+		{name: "below the maximum", value: "2s", want: 2 * time.Second},
+		{name: "clamped to the maximum", value: "1m", want: 5 * time.Second},
+		{name: "negative", value: "-1s", wantErr: true},
+		{name: "invalid", value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/logs/search?timeout="+tt.value, nil)
+
+			got, err := s.readQueryTimeout(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got timeout %v, want an error", got)
+				}
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("got timeout %v and error %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// deadlineQuerier runs queries until the timeout of the request is over.
+type deadlineQuerier struct {
+	fakeQuerier
+}
+
+func (q *deadlineQuerier) Query(ctx context.Context, req querier.QueryRequest) (querier.QueryResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	<-ctx.Done()
+	return querier.QueryResponse{}, ctx.Err()
+}
+
+func TestSearchLogsHandlerTimeout(t *testing.T) {
+	s := newTestServer(t, Config{}, Services{Querier: &deadlineQuerier{}})
+
+	status, resp := doJSON(t, s, http.MethodPost, "/api/logs/search?timeout=10ms", map[string]any{
+		"start": time.Now(),
+		"limit": 10,
+	})
+	if status != http.StatusGatewayTimeout {
+		t.Errorf("got status %d, want %d: %+v", status, http.StatusGatewayTimeout, resp)
+	}
+}
+
+func TestReadTimeQueryParamTimeZone(t *testing.T) {
+	s := newTestServer(t, Config{TimeZone: "America/New_York"}, Services{Querier: &fakeQuerier{}})
+
+	tests := []struct {
+		name    string
+		query   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "missing", query: ""},
+		{name: "configured time zone", query: "start=2024-01-01T10:00:00", want: time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)},
+		{name: "date in configured time zone", query: "start=2024-07-01", want: time.Date(2024, 7, 1, 4, 0, 0, 0, time.UTC)},
+		{name: "time zone overriding the configured one", query: "start=2024-01-01T10:00:00&time_zone=Asia/Tokyo", want: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{name: "explicit offset", query: "start=2024-01-01T10:00:00Z", want: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{name: "unknown time zone", query: "start=2024-01-01&time_zone=Mars/Olympus", wantErr: true},
+		{name: "invalid", query: "start=yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/logs/facets?"+tt.query, nil)
+
+			got, err := s.readTimeQueryParam(r, "start", time.Now())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got time %v, want an error", got)
+				}
+				return
+			}
+
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("got time %v and error %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLogHandler(t *testing.T) {
+	record := entity.LogRecord{ID: uuid.New(), Source: "api", Level: entity.LogLevelError, Timestamp: time.Now(), Message: "boom"}
+	memory := storage.NewMemoryStorage(storage.MemoryStorageConfig{})
+	if err := memory.StoreProcessedLogs(context.Background(), record); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	s := newTestServer(t, Config{}, Services{Querier: memory})
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{name: "found", id: record.ID.String(), wantStatus: http.StatusOK},
+		{name: "not found", id: uuid.NewString(), wantStatus: http.StatusNotFound},
+		{name: "malformed id", id: "not-a-uuid", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := doJSON(t, s, http.MethodGet, "/api/logs/"+tt.id, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.wantStatus, resp)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			data, ok := resp.Data.(map[string]any)
+			if !ok || data["id"] != record.ID.String() || data["message"] != "boom" {
+				t.Errorf("got record %v, want %v", resp.Data, record.ID)
+			}
+		})
+	}
+}
+
+func TestSearchLogsHandlerExplainsBackwardQuery(t *testing.T) {
+	sqlite, err := storage.NewSQLiteStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), storage.SQLiteStorageConfig{Path: filepath.Join(t.TempDir(), "logzilla.db")})
+	if err != nil {
+		t.Fatalf("cannot create storage: %v", err)
+	}
+	if err := sqlite.Connect(context.Background()); err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close(context.Background()) })
+
+	s := newTestServer(t, Config{}, Services{Querier: sqlite})
+
+	status, resp := doJSON(t, s, http.MethodPost, "/api/logs/search?explain=true", map[string]any{
+		"start": "2024-01-02T01:00:00Z",
+		"end":   "2024-01-02T00:00:00Z",
+		"limit": 10,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %+v", status, http.StatusOK, resp)
+	}
+
+	explanation, _ := resp.Metadata["explain"].(map[string]any)
+	plan, ok := explanation["plan"].(map[string]any)
+	if !ok {
+		t.Fatalf("got metadata %v, want an explain block with a plan", resp.Metadata)
+	}
+
+	want := map[string]any{
+		"lower_bound": "2024-01-02T00:00:00Z",
+		"upper_bound": "2024-01-02T01:00:00Z",
+		"direction":   "backward",
+		"order_by":    "ORDER BY timestamp DESC, id DESC",
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("got plan %v, want %v", plan, want)
+	}
+}
+
+func TestDistinctHandler(t *testing.T) {
+	at := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	memory := storage.NewMemoryStorage(storage.MemoryStorageConfig{})
+	err := memory.StoreProcessedLogs(context.Background(),
+		entity.LogRecord{ID: uuid.New(), Source: "worker", Timestamp: at, Metadata: map[string]any{"region": "eu", "status": 200}},
+		entity.LogRecord{ID: uuid.New(), Source: "api", Timestamp: at.Add(time.Second), Metadata: map[string]any{"region": "us", "status": 503}},
+		entity.LogRecord{ID: uuid.New(), Source: "api", Timestamp: at.Add(2 * time.Second), Metadata: map[string]any{"status": 200}},
+		entity.LogRecord{ID: uuid.New(), Source: "cron", Timestamp: at.Add(time.Hour), Metadata: map[string]any{"region": "ap"}},
+	)
+	if err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	s := newTestServer(t, Config{}, Services{Querier: memory})
+	window := "&start=2024-01-02T00:00:00Z&end=2024-01-02T00:01:00Z"
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []any
+	}{
+		{name: "sources", query: "field=source" + window, wantStatus: http.StatusOK, want: []any{"api", "worker"}},
+		{name: "metadata path", query: "field=metadata.region" + window, wantStatus: http.StatusOK, want: []any{"eu", "us"}},
+		{name: "numeric metadata path", query: "field=metadata.status" + window, wantStatus: http.StatusOK, want: []any{"200", "503"}},
+		{name: "limited", query: "field=source&limit=1" + window, wantStatus: http.StatusOK, want: []any{"api"}},
+		{name: "no values", query: "field=metadata.user" + window, wantStatus: http.StatusOK, want: []any{}},
+		{name: "missing field", query: window[1:], wantStatus: http.StatusUnprocessableEntity},
+		{name: "field not allowed", query: "field=message" + window, wantStatus: http.StatusUnprocessableEntity},
+		{name: "limit out of range", query: "field=source&limit=0" + window, wantStatus: http.StatusUnprocessableEntity},
+		{name: "invalid limit", query: "field=source&limit=many" + window, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := doJSON(t, s, http.MethodGet, "/api/distinct?"+tt.query, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.wantStatus, resp)
+			}
+
+			if tt.want == nil {
+				return
+			}
+			data, _ := resp.Data.(map[string]any)
+			if !reflect.DeepEqual(data["values"], tt.want) {
+				t.Errorf("got values %v, want %v", data["values"], tt.want)
+			}
+		})
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/thisisjab/logzilla/fault"
+	"github.com/thisisjab/logzilla/querier"
 )
 
 type apiResponse struct {
@@ -97,6 +100,89 @@ func (s *server) writeJson(w http.ResponseWriter, status int, data apiResponse,
 	return nil
 }
 
+// readBoolQueryParam reads an optional boolean query string parameter. Missing parameters are considered false.
+func readBoolQueryParam(r *http.Request, key string) (bool, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			key: []string{"Expected a boolean value."},
+		})
+	}
+
+	return b, nil
+}
+
+// readIntQueryParam reads an optional integer query string parameter. Missing parameters result in def.
+func readIntQueryParam(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			key: []string{"Expected an integer value."},
+		})
+	}
+
+	return n, nil
+}
+
+// readTimeQueryParam reads an optional time query string parameter, accepting relative times (see querier.ParseTime).
+// Timestamps without a zone are interpreted in the time_zone query string parameter, or the configured time zone.
+// Missing parameters result in a zero time.
+func (s *server) readTimeQueryParam(r *http.Request, key string, now time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	zone := s.cfg.TimeZone
+	if z := r.URL.Query().Get("time_zone"); z != "" {
+		zone = z
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"time_zone": []string{"Unknown time zone."},
+		})
+	}
+
+	t, err := querier.ParseTimeInLocation(value, now, loc)
+	if err != nil {
+		return time.Time{}, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			key: []string{"Expected an RFC3339 timestamp or a relative time."},
+		})
+	}
+
+	return t, nil
+}
+
+// readQueryTimeout reads the optional timeout query string parameter (e.g. `30s`), clamped to the configured maximum.
+// Missing parameters result in a zero duration, leaving the default timeout to the querier.
+func (s *server) readQueryTimeout(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("timeout")
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"timeout": []string{"Expected a positive duration (e.g. 30s)."},
+		})
+	}
+
+	return min(d, s.cfg.MaxQueryTimeout), nil
+}
+
 func (s *server) returnOnError(w http.ResponseWriter, r *http.Request, err error) bool {
 	if err != nil {
 		s.handleError(w, r, err)
@@ -3,11 +3,53 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/fault"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength limits the length of request IDs accepted from clients.
+	maxRequestIDLength = 128
 )
 
+// requestIDMiddleware reuses the request ID sent by the client or generates a new one. The ID is stored in the request
+// context and echoed in the response header, so log lines and responses of a single request can be correlated.
+func (s *server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+
+		next.ServeHTTP(w, s.contextSetRequestID(r, requestID))
+	})
+}
+
+// isValidRequestID reports whether id is safe to be echoed back and written to logs.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *server) requestLoggerMiddleware(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		s.logger.Info("incoming request", "method", r.Method, "path", r.RequestURI, "remote-addr", r.RemoteAddr)
+		s.requestLogger(r).Info("incoming request", "method", r.Method, "path", r.RequestURI, "remote-addr", r.RemoteAddr)
 
 		next.ServeHTTP(w, r)
 	}
@@ -15,6 +57,19 @@ func (s *server) requestLoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// requireReadyMiddleware rejects requests with 503 until the storage is connected.
+func (s *server) requireReadyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			w.Header().Set("Retry-After", "1")
+			s.handleError(w, r, fault.New(fault.UnavailableCode, "Storage is not connected yet."))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -22,11 +77,19 @@ func (s *server) corsMiddleware(next http.Handler) http.Handler {
 		origin := r.Header.Get("Origin")
 		if origin != "" {
 			for i := range s.cfg.CORS.TrustedOrigins {
-				if origin == s.cfg.CORS.TrustedOrigins[i] {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
+				if trusted := s.cfg.CORS.TrustedOrigins[i]; trusted == "*" || origin == trusted {
+					if trusted == "*" {
+						w.Header().Set("Access-Control-Allow-Origin", "*")
+					} else {
+						w.Header().Set("Access-Control-Allow-Origin", origin)
+					}
+
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
-						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Methods", strings.Join(s.cfg.CORS.AllowedMethods, ", "))
+						w.Header().Set("Access-Control-Allow-Headers", strings.Join(s.cfg.CORS.AllowedHeaders, ", "))
+						if s.cfg.CORS.MaxAge > 0 {
+							w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(s.cfg.CORS.MaxAge.Seconds())))
+						}
 						w.WriteHeader(http.StatusOK)
 						return
 					}
@@ -38,14 +101,30 @@ func (s *server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// recoverPanicMiddleware logs panics of handlers along with their stack. Panicking with an error (e.g. a fault) is
+// handled like returning it, so it's still mapped to its status code.
 func (s *server) recoverPanicMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			if err := recover(); err != nil {
-				w.Header().Set("Connection", "close")
+			rec := recover()
+			if rec == nil {
+				return
+			}
 
-				s.internalServerError(w, r, fmt.Errorf("%s", err))
+			// The server aborts the response silently for this one.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
 			}
+
+			w.Header().Set("Connection", "close")
+			s.requestLogger(r).Error("recovered from panic", "panic", rec, "stack", string(debug.Stack()))
+
+			if err, ok := rec.(error); ok {
+				s.handleError(w, r, err)
+				return
+			}
+
+			s.internalServerError(w, r, fmt.Errorf("%v", rec))
 		}()
 		next.ServeHTTP(w, r)
 	})
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "generated", header: ""},
+		{name: "sent by the client", header: "client-id-42", want: "client-id-42"},
+		{name: "invalid one is replaced", header: "bad id\n"},
+		{name: "too long one is replaced", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{}, Services{Querier: &fakeQuerier{}})
+
+			var handlerID string
+			h := s.requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerID = contextGetRequestID(r)
+				s.handleError(w, r, fault.New(fault.NotFoundCode, ""))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(requestIDHeader)
+			if tt.want != "" && got != tt.want {
+				t.Fatalf("got request ID %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && (got == "" || got == tt.header) {
+				t.Fatalf("got request ID %q, want a generated one", got)
+			}
+			if handlerID != got {
+				t.Errorf("got request ID %q in the handler, want %q", handlerID, got)
+			}
+
+			var resp apiResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("cannot decode response: %v", err)
+			}
+			if resp.Metadata["request_id"] != got {
+				t.Errorf("got request ID %v in the error response, want %q", resp.Metadata["request_id"], got)
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	cfg := Config{CORS: CORSConfig{TrustedOrigins: []string{"https://app.example.com"}, MaxAge: time.Hour}}
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		origin      string
+		method      string
+		wantOrigin  string
+		wantMethods string
+		wantMaxAge  string
+	}{
+		{
+			name:        "trusted origin",
+			cfg:         cfg,
+			origin:      "https://app.example.com",
+			method:      http.MethodPost,
+			wantOrigin:  "https://app.example.com",
+			wantMethods: "GET, POST, OPTIONS",
+			wantMaxAge:  "3600",
+		},
+		{
+			name:   "untrusted origin",
+			cfg:    cfg,
+			origin: "https://evil.example.com",
+			method: http.MethodPost,
+		},
+		{
+			name:        "configured methods",
+			cfg:         Config{CORS: CORSConfig{TrustedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{http.MethodGet}}},
+			origin:      "https://app.example.com",
+			method:      http.MethodDelete,
+			wantOrigin:  "https://app.example.com",
+			wantMethods: "GET",
+		},
+		{
+			name:        "wildcard origin",
+			cfg:         Config{CORS: CORSConfig{TrustedOrigins: []string{"*"}}},
+			origin:      "https://any.example.com",
+			method:      http.MethodGet,
+			wantOrigin:  "*",
+			wantMethods: "GET, POST, OPTIONS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.cfg, Services{Querier: &fakeQuerier{}})
+
+			h := s.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req := httptest.NewRequest(http.MethodOptions, "/api/logs/search", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			header := rec.Header()
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("got allowed origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("got allowed methods %q, want %q", got, tt.wantMethods)
+			}
+			if got := header.Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("got max age %q, want %q", got, tt.wantMaxAge)
+			}
+
+			// Preflight requests of trusted origins are answered by the middleware, and others are left to the handler.
+			wantStatus := http.StatusNoContent
+			if tt.wantOrigin != "" {
+				wantStatus = http.StatusOK
+			}
+			if rec.Code != wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, wantStatus)
+			}
+		})
+	}
+}
+
+func TestRecoverPanicMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		panicValue any
+		wantStatus int
+	}{
+		{name: "fault", panicValue: fault.New(fault.NotFoundCode, "No such log."), wantStatus: http.StatusNotFound},
+		{name: "wrapped fault", panicValue: errors.Join(errors.New("lookup"), fault.New(fault.NotFoundCode, "")), wantStatus: http.StatusNotFound},
+		{name: "error", panicValue: errors.New("nil map"), wantStatus: http.StatusInternalServerError},
+		{name: "other value", panicValue: 42, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{}, Services{Querier: &fakeQuerier{}})
+			h := s.requestIDMiddleware(s.recoverPanicMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic(tt.panicValue)
+			})))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Connection"); got != "close" {
+				t.Errorf("got Connection header %q, want close", got)
+			}
+		})
+	}
+}
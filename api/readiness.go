@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// connectStorage connects to the storage, retrying with exponential backoff, and marks the server as ready.
+func (s *server) connectStorage(ctx context.Context) error {
+	cfg := s.cfg.StorageConnect
+	backoff := cfg.InitialBackoff
+
+	var err error
+	for attempt := uint(1); attempt <= cfg.MaxAttempts; attempt++ {
+		if err = s.services.Storage.Connect(ctx); err == nil {
+			s.ready.Store(true)
+			s.logger.Info("connected to storage", "attempt", attempt)
+			return nil
+		}
+
+		if attempt == cfg.MaxAttempts {
+			break
+		}
+
+		s.logger.Warn("cannot connect to storage. retrying.", "attempt", attempt, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, cfg.MaxBackoff)
+	}
+
+	return fmt.Errorf("cannot connect to storage after %d attempts: %w", cfg.MaxAttempts, err)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/querier"
+)
+
+// fakeStorageConnector fails to connect until reachableAt.
+type fakeStorageConnector struct {
+	reachableAt time.Time
+	attempts    int
+}
+
+func (f *fakeStorageConnector) Connect(context.Context) error {
+	f.attempts++
+	if time.Now().Before(f.reachableAt) {
+		return errors.New("storage is unreachable")
+	}
+	return nil
+}
+
+func TestConnectStorageGatesReadiness(t *testing.T) {
+	storage := &fakeStorageConnector{reachableAt: time.Now().Add(50 * time.Millisecond)}
+	s := newTestServer(t, Config{StorageConnect: StorageConnectConfig{
+		MaxAttempts:    100,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+	}}, Services{Querier: &fakeQuerier{resp: querier.QueryResponse{}}, Storage: storage})
+
+	search := map[string]any{"start": time.Now(), "limit": 1}
+
+	if status, _ := doJSON(t, s, http.MethodPost, "/api/logs/search", search); status != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d before connecting, want %d", status, http.StatusServiceUnavailable)
+	}
+
+	if err := s.connectStorage(context.Background()); err != nil {
+		t.Fatalf("cannot connect to storage: %v", err)
+	}
+
+	if storage.attempts < 2 {
+		t.Errorf("got %d connection attempts, want the storage to be retried", storage.attempts)
+	}
+
+	if status, _ := doJSON(t, s, http.MethodPost, "/api/logs/search", search); status != http.StatusOK {
+		t.Fatalf("got status %d once connected, want %d", status, http.StatusOK)
+	}
+}
+
+func TestConnectStorageGivesUp(t *testing.T) {
+	storage := &fakeStorageConnector{reachableAt: time.Now().Add(time.Hour)}
+	s := newTestServer(t, Config{StorageConnect: StorageConnectConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}}, Services{Querier: &fakeQuerier{}, Storage: storage})
+
+	if err := s.connectStorage(context.Background()); err == nil {
+		t.Fatal("got no error connecting to an unreachable storage")
+	}
+
+	if storage.attempts != 3 || s.ready.Load() {
+		t.Errorf("got %d attempts and ready %v, want 3 attempts and not ready", storage.attempts, s.ready.Load())
+	}
+}
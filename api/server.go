@@ -2,31 +2,112 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/thisisjab/logzilla/entity"
 	"github.com/thisisjab/logzilla/querier"
 )
 
-type services struct {
-	storage querier.Querier
+// ProcessedLogsStorer stores already processed logs, bypassing the engine's processors.
+type ProcessedLogsStorer interface {
+	StoreProcessedLogs(ctx context.Context, logs ...entity.LogRecord) error
+}
+
+// RawLogsPusher feeds raw logs into the engine's processing pipeline.
+type RawLogsPusher interface {
+	Push(ctx context.Context, logs ...entity.LogRecord) error
+}
+
+// Services holds the dependencies used by the API handlers.
+type Services struct {
+	Querier querier.Querier
+
+	// ProcessedLogs is required when ingest mode is "processed".
+	ProcessedLogs ProcessedLogsStorer
+
+	// RawLogs is required when ingest mode is "raw".
+	RawLogs RawLogsPusher
+
+	// Storage is optional. If set, the server connects to it on start (see Config.StorageConnect), and requests
+	// depending on it fail with 503 until connected. Otherwise, the storage is assumed to be already connected.
+	Storage StorageConnector
+
+	// Buffers is optional. If set, admin endpoints flushing buffers are served (see Config.Admin).
+	Buffers BuffersFlusher
+}
+
+// BuffersFlusher stores logs buffered by the engine right away.
+type BuffersFlusher interface {
+	FlushBuffers(ctx context.Context) (int, error)
+}
+
+// StorageConnector connects to a storage.
+type StorageConnector interface {
+	Connect(ctx context.Context) error
 }
 
 type server struct {
 	cfg      Config
-	services services
+	services Services
 	logger   *slog.Logger
+	// ready reports whether the storage is connected.
+	ready atomic.Bool
+	// buildInfo is computed once, since it doesn't change while running.
+	buildInfo versionResponse
+	// cursorSecret signs pagination cursors.
+	cursorSecret []byte
+	// explainer is nil if the querier can't explain queries. It's kept aside, since services.Querier is wrapped.
+	explainer querier.Explainer
 }
 
-func NewServer(cfg Config, queryable querier.Querier, logger *slog.Logger) (*server, error) {
+func NewServer(cfg Config, services Services, logger *slog.Logger) (*server, error) {
+	cfg.setDefaults()
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
+	if services.Querier == nil {
+		return nil, errors.New("querier is required")
+	}
+
+	if cfg.Ingest.Mode == IngestModeProcessed && services.ProcessedLogs == nil {
+		return nil, errors.New("processed logs storer is required in processed ingest mode")
+	}
+
+	if cfg.Ingest.Mode == IngestModeRaw && services.RawLogs == nil {
+		return nil, errors.New("raw logs pusher is required in raw ingest mode")
+	}
+
+	cursorSecret := []byte(cfg.CursorSecret)
+	if len(cursorSecret) == 0 {
+		cursorSecret = make([]byte, 32)
+		if _, err := rand.Read(cursorSecret); err != nil {
+			return nil, fmt.Errorf("cannot generate cursor secret: %w", err)
+		}
+		logger.Warn("cursor secret is not configured, cursors are only valid until the server restarts.")
+	}
+
+	if cfg.Admin.Token != "" && services.Buffers == nil {
+		logger.Warn("admin token is configured, but there are no engine buffers to flush. flush endpoint is disabled.")
+	}
+
+	explainer, _ := services.Querier.(querier.Explainer)
+	services.Querier = querier.NewRetryingQuerier(services.Querier, cfg.QueryRetry)
+
 	return &server{
-		cfg:      cfg,
-		services: services{queryable},
-		logger:   logger,
+		cfg:          cfg,
+		services:     services,
+		logger:       logger,
+		buildInfo:    buildInfo(),
+		cursorSecret: cursorSecret,
+		explainer:    explainer,
 	}, nil
 }
 
@@ -34,23 +115,71 @@ func (s *server) routes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /api/healthcheck", s.healthCheckHandler)
+	mux.HandleFunc("GET /api/version", s.versionHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
 
 	// Fetching logs and sources
-	mux.HandleFunc("POST /api/logs/search", s.searchLogsHandler)
+	mux.Handle("POST /api/logs/search", s.requireReadyMiddleware(http.HandlerFunc(s.searchLogsHandler)))
+	mux.Handle("GET /api/logs/{id}", s.requireReadyMiddleware(http.HandlerFunc(s.getLogHandler)))
+	mux.Handle("GET /api/facets", s.requireReadyMiddleware(http.HandlerFunc(s.facetsHandler)))
+	mux.Handle("GET /api/distinct", s.requireReadyMiddleware(http.HandlerFunc(s.distinctHandler)))
+	mux.Handle("GET /api/aggregate", s.requireReadyMiddleware(http.HandlerFunc(s.aggregateHandler)))
 
-	return s.recoverPanicMiddleware(s.requestLoggerMiddleware(s.corsMiddleware(mux)))
+	// Ingesting logs
+	if s.cfg.Ingest.Mode != IngestModeDisabled {
+		mux.Handle("POST /api/logs/ingest", s.requireReadyMiddleware(http.HandlerFunc(s.ingestLogsHandler)))
+	}
+
+	// Admin
+	if s.cfg.Admin.Token != "" && s.services.Buffers != nil {
+		mux.Handle("POST /api/admin/flush", s.requireAdminTokenMiddleware(http.HandlerFunc(s.flushHandler)))
+	}
+
+	return s.requestIDMiddleware(s.recoverPanicMiddleware(s.requestLoggerMiddleware(s.corsMiddleware(mux))))
+}
+
+// newHTTPServer creates the HTTP server serving the routes, using the configured timeouts.
+func (s *server) newHTTPServer() *http.Server {
+	return &http.Server{
+		Addr:              s.cfg.Addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: s.cfg.Timeouts.ReadHeader,
+		ReadTimeout:       s.cfg.Timeouts.Read,
+		WriteTimeout:      s.cfg.Timeouts.Write,
+		IdleTimeout:       s.cfg.Timeouts.Idle,
+	}
 }
 
 func (s *server) Serve(ctx context.Context) error {
-	srv := &http.Server{
-		Addr:    s.cfg.Addr,
-		Handler: s.routes(),
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	connectErr := make(chan error, 1)
+	if s.services.Storage != nil {
+		go func() {
+			// Connecting is given up on shutdown, which isn't an error.
+			if err := s.connectStorage(ctx); err != nil && ctx.Err() == nil {
+				connectErr <- err
+				cancel()
+			}
+		}()
+	} else {
+		s.ready.Store(true)
 	}
 
+	srv := s.newHTTPServer()
+
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
-		s.logger.Info("shutting down server", "addr", s.cfg.Addr)
-		if err := srv.Shutdown(ctx); err != nil {
+
+		// ctx is already cancelled at this point, so in-flight requests are given a grace period of their own.
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.ShutdownTimeout)
+		defer cancelShutdown()
+
+		s.logger.Info("shutting down server", "addr", s.cfg.Addr, "timeout", s.cfg.ShutdownTimeout)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
 			s.logger.Error("failed to shutdown server", "addr", s.cfg.Addr, "error", err)
 		}
 	}()
@@ -68,5 +197,13 @@ func (s *server) Serve(ctx context.Context) error {
 		return serverErr
 	}
 
-	return nil
+	// Serving stops as soon as shutdown begins, so in-flight requests are waited for here.
+	<-shutdownDone
+
+	select {
+	case err := <-connectErr:
+		return err
+	default:
+		return nil
+	}
 }
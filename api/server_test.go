@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/querier"
+)
+
+// fakeQuerier returns up to the query's limit records, and explains queries by their limit. Methods not overridden
+// panic, so tests fail loudly if they're called.
+type fakeQuerier struct {
+	querier.Querier
+	resp querier.QueryResponse
+	// delay is how long queries take.
+	delay time.Duration
+}
+
+func (f *fakeQuerier) Query(_ context.Context, req querier.QueryRequest) (querier.QueryResponse, error) {
+	time.Sleep(f.delay)
+
+	resp := f.resp
+	resp.Records = resp.Records[:min(req.Query.Limit, len(resp.Records))]
+	return resp, nil
+}
+
+func (f *fakeQuerier) Count(_ context.Context, _ querier.QueryRequest) (int64, error) {
+	return int64(len(f.resp.Records)), nil
+}
+
+func (f *fakeQuerier) Explain(req querier.QueryRequest) (querier.Explanation, error) {
+	return querier.NewExplanation(fmt.Sprintf("LIMIT %d", req.Query.Limit), nil), nil
+}
+
+func newTestServer(t *testing.T, cfg Config, services Services) *server {
+	t.Helper()
+
+	if cfg.Addr == "" {
+		cfg.Addr = "localhost:0"
+	}
+
+	s, err := NewServer(cfg, services, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("cannot create server: %v", err)
+	}
+
+	// Serve marks servers without a storage to connect as ready.
+	if services.Storage == nil {
+		s.ready.Store(true)
+	}
+
+	return s
+}
+
+// doJSON sends a request with body encoded as JSON to the routes of s, and decodes the response into an apiResponse.
+func doJSON(t *testing.T, s *server, method, target string, body any) (int, apiResponse) {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("cannot encode request body: %v", err)
+		}
+		reqBody = bytes.NewReader(js)
+	}
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(method, target, reqBody))
+
+	var resp apiResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("cannot decode response body: %v", err)
+	}
+
+	return rec.Code, resp
+}
+
+func TestNewHTTPServerTimeouts(t *testing.T) {
+	cfg := Config{Timeouts: TimeoutsConfig{ReadHeader: 1, Read: 2, Write: 3, Idle: 4}}
+	srv := newTestServer(t, cfg, Services{Querier: &fakeQuerier{}}).newHTTPServer()
+
+	if srv.ReadHeaderTimeout != 1 || srv.ReadTimeout != 2 || srv.WriteTimeout != 3 || srv.IdleTimeout != 4 {
+		t.Errorf("got timeouts %v, %v, %v, %v, want 1ns, 2ns, 3ns, 4ns", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestNewHTTPServerDefaultTimeouts(t *testing.T) {
+	srv := newTestServer(t, Config{}, Services{Querier: &fakeQuerier{}}).newHTTPServer()
+
+	if srv.ReadHeaderTimeout != defaultReadHeaderTimeout || srv.ReadTimeout != defaultReadTimeout || srv.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("got timeouts %v, %v, %v, want defaults", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.IdleTimeout)
+	}
+
+	if want := defaultMaxQueryTimeout + writeTimeoutMargin; srv.WriteTimeout != want {
+		t.Errorf("got write timeout %v, want %v", srv.WriteTimeout, want)
+	}
+
+	if srv.Handler == nil || srv.Addr != "localhost:0" {
+		t.Errorf("got handler %v and addr %q, want routes and configured addr", srv.Handler, srv.Addr)
+	}
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("cannot find a free port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close() //nolint:errcheck
+
+	s := newTestServer(t, Config{Addr: addr, ShutdownTimeout: time.Second}, Services{
+		Querier: &fakeQuerier{delay: 200 * time.Millisecond},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- s.Serve(ctx) }()
+
+	// Waits for the server to listen.
+	var conn net.Conn
+	for range 50 {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			conn.Close() //nolint:errcheck
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server is not listening: %v", err)
+	}
+
+	status := make(chan int)
+	go func() {
+		resp, err := http.Post("http://"+addr+"/api/logs/search", "application/json",
+			strings.NewReader(`{"start": "2024-01-02T00:00:00Z", "limit": 1}`))
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close() //nolint:errcheck
+		status <- resp.StatusCode
+	}()
+
+	// Shuts down while the request is being served.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("got status %d for the in-flight request, want %d", got, http.StatusOK)
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("got error %v serving, want none", err)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, injected at build time using -ldflags, e.g.
+// `-X github.com/thisisjab/logzilla/api.Version=v1.2.0 -X github.com/thisisjab/logzilla/api.Commit=$(git rev-parse HEAD)`.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildInfo returns the injected build information. The commit and build date fall back to the VCS information
+// embedded by the Go toolchain, if any.
+func buildInfo() versionResponse {
+	res := versionResponse{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && res.Commit == "":
+				res.Commit = s.Value
+			case s.Key == "vcs.time" && res.BuildDate == "":
+				res.BuildDate = s.Value
+			}
+		}
+	}
+
+	return res
+}
+
+func (s *server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJson(w, http.StatusOK, apiResponse{ //nolint:errcheck
+		Success: true,
+		Data:    s.buildInfo,
+	}, nil)
+}
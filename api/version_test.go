@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	version, commit, buildDate := Version, Commit, BuildDate
+	t.Cleanup(func() { Version, Commit, BuildDate = version, commit, buildDate })
+	Version, Commit, BuildDate = "v1.2.0", "0123abc", "2024-01-02T00:00:00Z"
+
+	s := newTestServer(t, Config{}, Services{Querier: &fakeQuerier{}})
+
+	status, resp := doJSON(t, s, http.MethodGet, "/api/version", nil)
+	if status != http.StatusOK || !resp.Success {
+		t.Fatalf("got status %d: %+v, want %d", status, resp, http.StatusOK)
+	}
+
+	data, ok := resp.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("got data %v, want an object", resp.Data)
+	}
+
+	want := map[string]string{
+		"version":    "v1.2.0",
+		"commit":     "0123abc",
+		"build_date": "2024-01-02T00:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	for key, value := range want {
+		if got, ok := data[key]; !ok || got != value {
+			t.Errorf("got %s %v, want %q", key, got, value)
+		}
+	}
+}
@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/thisisjab/logzilla/api"
 	"github.com/thisisjab/logzilla/config"
 	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/querier"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,16 +24,13 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	cfgPath := flag.String("config", "./.config.yaml", "path to config file")
+	replayStart := flag.String("replay-start", "", "replay raw logs stored since this time (e.g. 2024-01-02T15:04:05Z or -1h) and exit")
+	replayEnd := flag.String("replay-end", "now", "replay raw logs stored until this time")
 	flag.Parse()
 
-	fileContent, err := os.ReadFile(*cfgPath)
+	cfg, err := readConfig(*cfgPath)
 	if err != nil {
-		panic(fmt.Errorf("cannot read config file content: %w", err))
-	}
-
-	var cfg config.Config
-	if err := yaml.Unmarshal(fileContent, &cfg); err != nil {
-		panic(fmt.Errorf("cannot parse config file: %w", err))
+		panic(err)
 	}
 
 	engineCfg, logger, err := cfg.Parse()
@@ -64,11 +67,185 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *replayStart != "" {
+		if err := replay(ctx, cfg, engine, *replayStart, *replayEnd, logger); err != nil {
+			logger.Error("replay error.", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var serverWg sync.WaitGroup
+
+	// Serve the API in-process if configured, so raw ingestion can reach the engine's pipeline.
+	if cfg.API != nil {
+		services, err := newAPIServices(*cfg.API, engineCfg)
+		if err != nil {
+			logger.Error("server error.", "error", err)
+			os.Exit(1)
+		}
+		// Processed logs are stored by the engine, so they're buffered and limited like logs of processors.
+		services.ProcessedLogs = engine
+		services.Buffers = engine
+		// The engine connects to the storage, so the API is only ready once it's done.
+		services.Storage = engineConnector{engine: engine}
+
+		server, err := api.NewServer(*cfg.API, services, logger)
+		if err != nil {
+			logger.Error("server error.", "error", err)
+			os.Exit(1)
+		}
+
+		serverWg.Go(func() {
+			if err := server.Serve(ctx); err != nil {
+				logger.Error("server error.", "error", err)
+				cancel()
+			}
+		})
+	}
+
+	// The engine is stopped only once the API is shut down, so in-flight requests can still use the storage.
+	engineCtx, cancelEngine := context.WithCancel(context.Background())
+	defer cancelEngine()
+
+	go func() {
+		<-ctx.Done()
+		serverWg.Wait()
+		cancelEngine()
+	}()
+
+	// Reload config on SIGHUP, applying changes which don't need a restart.
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
+	go func() {
+		for range reloadChan {
+			logger.Info("received SIGHUP. reloading config.", "path", *cfgPath)
+
+			newCfg, err := reloadConfig(*cfgPath, cfg, engine, logger)
+			if err != nil {
+				logger.Error("cannot reload config.", "error", err)
+				continue
+			}
+
+			cfg = newCfg
+			logger.Info("config reloaded.")
+		}
+	}()
+
 	// Run engine
-	if err := engine.Run(ctx); err != nil {
+	if err := engine.Run(engineCtx); err != nil {
 		logger.Error("engine error.", "error", err)
-		cancel()
 	}
 
+	// The engine may stop by itself (e.g. failing to connect), so the API is shut down, and waited for, here too.
+	cancel()
+	serverWg.Wait()
+
 	logger.Info("engine stopped.")
 }
+
+// replay re-processes raw logs stored within the time window, instead of running the engine.
+func replay(ctx context.Context, cfg config.Config, e *engine.Engine, start, end string, logger *slog.Logger) error {
+	replayCfg, err := cfg.ParseReplay(logger)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if replayCfg.Start, err = querier.ParseTime(start, now); err != nil {
+		return fmt.Errorf("invalid replay start: %w", err)
+	}
+	if replayCfg.End, err = querier.ParseTime(end, now); err != nil {
+		return fmt.Errorf("invalid replay end: %w", err)
+	}
+
+	logger.Info("replaying raw logs.", "start", replayCfg.Start, "end", replayCfg.End)
+
+	count, err := e.Replay(ctx, replayCfg)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("replayed raw logs.", "count", count)
+
+	return nil
+}
+
+// readConfig reads and parses the config file at path.
+func readConfig(path string) (config.Config, error) {
+	fileContent, err := os.ReadFile(path)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("cannot read config file content: %w", err)
+	}
+
+	var cfg config.Config
+	if err := yaml.Unmarshal(fileContent, &cfg); err != nil {
+		return config.Config{}, fmt.Errorf("cannot parse config file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// reloadConfig re-reads the config file and applies it to the running engine.
+// Changes which can't be applied live are logged and ignored until restart. The config in effect is returned.
+func reloadConfig(path string, prev config.Config, e *engine.Engine, logger *slog.Logger) (config.Config, error) {
+	cfg, err := readConfig(path)
+	if err != nil {
+		return prev, err
+	}
+
+	reloadCfg, effectiveCfg, ignored, err := cfg.ParseReload(logger, prev)
+	if err != nil {
+		return prev, err
+	}
+
+	for _, setting := range ignored {
+		logger.Warn("config change cannot be applied until restart. ignoring.", "setting", setting)
+	}
+
+	if err := e.Reload(*reloadCfg); err != nil {
+		return prev, err
+	}
+
+	return effectiveCfg, nil
+}
+
+// engineConnector waits for the engine to connect to the storage, instead of connecting by itself.
+type engineConnector struct {
+	engine *engine.Engine
+}
+
+func (c engineConnector) Connect(ctx context.Context) error {
+	return c.engine.WaitConnected(ctx)
+}
+
+// newAPIServices creates the API services from the storage and sources used by the engine.
+func newAPIServices(cfg api.Config, engineCfg *engine.Config) (api.Services, error) {
+	queryable, ok := engineCfg.Storage.(querier.Querier)
+	if !ok {
+		return api.Services{}, errors.New("configured storage does not support querying")
+	}
+
+	services := api.Services{Querier: queryable}
+
+	if cfg.Ingest.Mode == api.IngestModeRaw {
+		for _, s := range engineCfg.Sources {
+			if s.Name() != cfg.Ingest.Source {
+				continue
+			}
+
+			pusher, ok := s.(api.RawLogsPusher)
+			if !ok {
+				return api.Services{}, fmt.Errorf("ingest source `%s` does not accept pushed logs", s.Name())
+			}
+			services.RawLogs = pusher
+		}
+
+		if services.RawLogs == nil {
+			return api.Services{}, fmt.Errorf("ingest source `%s` not found", cfg.Ingest.Source)
+		}
+	}
+
+	return services, nil
+}
@@ -37,7 +37,7 @@ func main() {
 	}()
 
 	// FIXME: create this based on config
-	db, err := storage.NewClickHouseStorage(storage.ClickHouseStorageConfig{
+	db, err := storage.NewClickHouseStorage(logger, storage.ClickHouseStorageConfig{
 		Addr:     []string{"localhost:8000"},
 		Database: "logzilla",
 		Username: "logzilla",
@@ -53,7 +53,7 @@ func main() {
 		api.Config{
 			Addr: "localhost:8000",
 		},
-		db,
+		api.Services{Querier: db, ProcessedLogs: db, Storage: db},
 		logger,
 	)
 
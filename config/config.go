@@ -7,10 +7,8 @@ import (
 	"time"
 
 	"github.com/lmittmann/tint"
+	"github.com/thisisjab/logzilla/api"
 	"github.com/thisisjab/logzilla/engine"
-	"github.com/thisisjab/logzilla/processor"
-	"github.com/thisisjab/logzilla/source"
-	"github.com/thisisjab/logzilla/storage"
 	"go.yaml.in/yaml/v3"
 )
 
@@ -23,6 +21,32 @@ type Config struct {
 	StorageFlushInterval    time.Duration     `yaml:"storage_flush_interval"`
 	ProcessedLogsBufferSize uint              `yaml:"processed_logs_buffer_size"`
 	ProcessorWorkersCount   uint              `yaml:"processor_workers_count"`
+	// DefaultProcessors is the processor chain of sources which don't list their processors. Sources can opt out
+	// with an empty list (`processors: []`).
+	DefaultProcessors []string `yaml:"default_processors"`
+	// MaxConcurrentFlushes limits concurrent inserts to the storage. Zero means no limit.
+	MaxConcurrentFlushes uint `yaml:"max_concurrent_flushes"`
+	// MaxMetadataBytes limits the size of JSON encoded metadata of processed logs. Metadata of larger logs is replaced
+	// by `_truncated` and `_original_size` keys. Zero means no limit.
+	MaxMetadataBytes uint `yaml:"max_metadata_bytes"`
+	// PartitionProcessingBySource preserves the order of records within each source.
+	PartitionProcessingBySource bool `yaml:"partition_processing_by_source"`
+	// ProcessorCircuitBreaker temporarily skips processors which fail on most records. It's disabled by default.
+	ProcessorCircuitBreaker ProcessorCircuitBreakerConfig `yaml:"processor_circuit_breaker"`
+	// RawLogsStorage stores raw logs, as emitted by sources, along with processed logs. It's disabled by default.
+	RawLogsStorage RawLogsStorageConfig `yaml:"raw_logs_storage"`
+	// Dedup drops processed logs identical to one stored within the window. It's disabled by default.
+	Dedup DedupConfig `yaml:"dedup"`
+	// SourceRestart configures the backoff of restarting failed sources.
+	SourceRestart SourceRestartConfig `yaml:"source_restart"`
+	// WAL writes buffered processed logs ahead to disk, so they're stored after a crash. It's disabled by default.
+	WAL WALConfig `yaml:"wal"`
+
+	// Replay configures re-processing stored raw logs, which is done by running the engine with `-replay-start`.
+	Replay ReplayConfig `yaml:"replay"`
+
+	// API is optional. When set, the engine serves the API in-process, which is required for raw ingestion.
+	API *api.Config `yaml:"api"`
 }
 
 type LoggerConfig struct {
@@ -31,6 +55,46 @@ type LoggerConfig struct {
 	Output string `yaml:"output"`
 }
 
+type ProcessorCircuitBreakerConfig struct {
+	// ErrorRateThreshold is the ratio of failed records (0 to 1) that makes a processor be skipped. Zero disables it.
+	ErrorRateThreshold float64       `yaml:"error_rate_threshold"`
+	MinRequests        uint          `yaml:"min_requests"`
+	Window             time.Duration `yaml:"window"`
+	OpenDuration       time.Duration `yaml:"open_duration"`
+}
+
+type RawLogsStorageConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	BufferSize    uint          `yaml:"buffer_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+type SourceRestartConfig struct {
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+type DedupConfig struct {
+	Window     time.Duration `yaml:"window"`
+	MaxEntries uint          `yaml:"max_entries"`
+	// Fields are any of source, timestamp, level, message and metadata. Defaults to source, timestamp and message.
+	Fields []string `yaml:"fields"`
+}
+
+type WALConfig struct {
+	// Dir is the directory of write-ahead log segments. Empty disables the write-ahead log.
+	Dir      string `yaml:"dir"`
+	MaxBytes uint64 `yaml:"max_bytes"`
+}
+
+type ReplayConfig struct {
+	// Target optionally stores replayed logs in another storage. Defaults to the storage.
+	Target    *StorageConfig `yaml:"target"`
+	BatchSize uint           `yaml:"batch_size"`
+	// Timeout optionally limits how long a replay may take (e.g. "1h").
+	Timeout time.Duration `yaml:"timeout"`
+}
+
 type StorageConfig struct {
 	Type   string `yaml:"type"`
 	Config any    `yaml:"config"`
@@ -46,7 +110,9 @@ type SourceConfig struct {
 	Name       string   `yaml:"name"`
 	Type       string   `yaml:"type"`
 	Processors []string `yaml:"processors"`
-	Config     any      `yaml:"config"`
+	// Backpressure is one of block, drop-oldest or drop-new. Defaults to block.
+	Backpressure string `yaml:"backpressure"`
+	Config       any    `yaml:"config"`
 }
 
 func (cfg Config) Parse() (*engine.Config, *slog.Logger, error) {
@@ -55,38 +121,102 @@ func (cfg Config) Parse() (*engine.Config, *slog.Logger, error) {
 		return nil, nil, fmt.Errorf("cannot create logger: %w", err)
 	}
 
-	st, err := parseStorageConfig(cfg.Storage)
+	st, err := parseStorageConfig(logger, cfg.Storage)
 	if err != nil {
 		return nil, logger, fmt.Errorf("cannot create storage: %w", err)
 	}
 
-	processors := make([]engine.LogProcessor, len(cfg.Processors))
-	for i, pc := range cfg.Processors {
+	processors, sources, backpressurePolicies, err := parseComponents(logger, cfg.Processors, cfg.Sources, cfg.DefaultProcessors)
+	if err != nil {
+		return nil, logger, err
+	}
+
+	return &engine.Config{
+		RawLogsBufferMaxSize:        cfg.RawLogsBufferSize,
+		StorageFlushInterval:        cfg.StorageFlushInterval,
+		ProcessedLogsBufferMaxSize:  cfg.ProcessedLogsBufferSize,
+		ProcessorWorkersCount:       cfg.ProcessorWorkersCount,
+		MaxConcurrentFlushes:        cfg.MaxConcurrentFlushes,
+		MaxMetadataBytes:            cfg.MaxMetadataBytes,
+		PartitionProcessingBySource: cfg.PartitionProcessingBySource,
+		Storage:                     st,
+		Processors:                  processors,
+		Sources:                     sources,
+		SourceBackpressurePolicies:  backpressurePolicies,
+		ProcessorBreaker: engine.ProcessorBreakerConfig{
+			ErrorRateThreshold: cfg.ProcessorCircuitBreaker.ErrorRateThreshold,
+			MinRequests:        cfg.ProcessorCircuitBreaker.MinRequests,
+			Window:             cfg.ProcessorCircuitBreaker.Window,
+			OpenDuration:       cfg.ProcessorCircuitBreaker.OpenDuration,
+		},
+		RawLogsStorage: engine.RawLogsStorageConfig{
+			Enabled:       cfg.RawLogsStorage.Enabled,
+			BufferMaxSize: cfg.RawLogsStorage.BufferSize,
+			FlushInterval: cfg.RawLogsStorage.FlushInterval,
+		},
+		SourceRestart: engine.SourceRestartConfig{
+			InitialBackoff: cfg.SourceRestart.InitialBackoff,
+			MaxBackoff:     cfg.SourceRestart.MaxBackoff,
+		},
+		Dedup: engine.DedupConfig{
+			Window:     cfg.Dedup.Window,
+			MaxEntries: cfg.Dedup.MaxEntries,
+			Fields:     cfg.Dedup.Fields,
+		},
+		WAL: engine.WALConfig{
+			Dir:      cfg.WAL.Dir,
+			MaxBytes: cfg.WAL.MaxBytes,
+		},
+	}, logger, nil
+}
+
+// ParseReplay creates the replay config, except for its time window.
+func (cfg Config) ParseReplay(logger *slog.Logger) (engine.ReplayConfig, error) {
+	replayCfg := engine.ReplayConfig{BatchSize: cfg.Replay.BatchSize, Timeout: cfg.Replay.Timeout}
+
+	if cfg.Replay.Target != nil {
+		target, err := parseStorageConfig(logger, *cfg.Replay.Target)
+		if err != nil {
+			return engine.ReplayConfig{}, fmt.Errorf("cannot create replay target: %w", err)
+		}
+		replayCfg.Target = target
+	}
+
+	return replayCfg, nil
+}
+
+// parseComponents creates processors and sources, along with backpressure policies of sources.
+// Sources which don't list their processors use defaultProcessors.
+func parseComponents(logger *slog.Logger, processorConfigs []ProcessorConfig, sourceConfigs []SourceConfig, defaultProcessors []string) ([]engine.LogProcessor, []engine.LogSource, map[string]engine.BackpressurePolicy, error) {
+	processors := make([]engine.LogProcessor, len(processorConfigs))
+	for i, pc := range processorConfigs {
 		p, err := parseProcessorConfig(logger, pc)
 		if err != nil {
-			return nil, logger, fmt.Errorf("cannot create processor `%s`: %w", pc.Name, err)
+			return nil, nil, nil, fmt.Errorf("cannot create processor `%s`: %w", pc.Name, err)
 		}
 		processors[i] = p
 	}
 
-	sources := make([]engine.LogSource, len(cfg.Sources))
-	for i, sc := range cfg.Sources {
+	sources := make([]engine.LogSource, len(sourceConfigs))
+	backpressurePolicies := make(map[string]engine.BackpressurePolicy)
+	for i, sc := range sourceConfigs {
+		// A nil list means processors aren't listed at all, unlike an empty one.
+		if sc.Processors == nil {
+			sc.Processors = defaultProcessors
+		}
+
 		s, err := parseSourceConfig(logger, sc)
 		if err != nil {
-			return nil, logger, fmt.Errorf("cannot create source `%s`: %w", sc.Name, err)
+			return nil, nil, nil, fmt.Errorf("cannot create source `%s`: %w", sc.Name, err)
 		}
 		sources[i] = s
+
+		if sc.Backpressure != "" {
+			backpressurePolicies[sc.Name] = engine.BackpressurePolicy(sc.Backpressure)
+		}
 	}
 
-	return &engine.Config{
-		RawLogsBufferMaxSize:       cfg.RawLogsBufferSize,
-		StorageFlushInterval:       cfg.StorageFlushInterval,
-		ProcessedLogsBufferMaxSize: cfg.ProcessedLogsBufferSize,
-		ProcessorWorkersCount:      cfg.ProcessorWorkersCount,
-		Storage:                    st,
-		Processors:                 processors,
-		Sources:                    sources,
-	}, logger, nil
+	return processors, sources, backpressurePolicies, nil
 }
 
 func parseLoggerConfig(cfg LoggerConfig) (*slog.Logger, error) {
@@ -124,85 +254,31 @@ func parseLoggerConfig(cfg LoggerConfig) (*slog.Logger, error) {
 	return logger, nil
 }
 
-func parseStorageConfig(cfg StorageConfig) (engine.Storage, error) {
-	switch cfg.Type {
-	case "clickhouse":
-		var clickHouseConfig storage.ClickHouseStorageConfig
-
-		if err := remarshal(cfg.Config, &clickHouseConfig); err != nil {
-			return nil, fmt.Errorf("cannot parse clickhouse storage config: %w", err)
-		}
-
-		s, err := storage.NewClickHouseStorage(clickHouseConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create clickhouse storage: %w", err)
-		}
-
-		return s, nil
-
-	default:
+func parseStorageConfig(logger *slog.Logger, cfg StorageConfig) (engine.Storage, error) {
+	factory, ok := lookup(storageFactories, cfg.Type)
+	if !ok {
 		return nil, fmt.Errorf("invalid storage type: %s", cfg.Type)
 	}
+
+	return factory(logger, cfg.Config)
 }
 
 func parseSourceConfig(logger *slog.Logger, cfg SourceConfig) (engine.LogSource, error) {
-	switch cfg.Type {
-	case "file":
-		var fileConfig source.FileLogSourceConfig
-		err := remarshal(cfg.Config, &fileConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create file source: %w", err)
-		}
-
-		fileConfig.Name = cfg.Name
-		fileConfig.ProcessorNames = cfg.Processors
-
-		s, err := source.NewFileLogSource(logger, fileConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create file source: %w", err)
-		}
-
-		return s, nil
-	default:
+	factory, ok := lookup(sourceFactories, cfg.Type)
+	if !ok {
 		return nil, fmt.Errorf("invalid log source type: %s", cfg.Type)
 	}
+
+	return factory(logger, cfg.Name, cfg.Processors, cfg.Config)
 }
 
 func parseProcessorConfig(logger *slog.Logger, cfg ProcessorConfig) (engine.LogProcessor, error) {
-	switch cfg.Type {
-	case "json":
-		var jsonConfig processor.JsonLogProcessorConfig
-		err := remarshal(cfg.Config, &jsonConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create json processor: %w", err)
-		}
-
-		jsonConfig.Name = cfg.Name
-
-		p, err := processor.NewJsonLogProcessor(jsonConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create json processor: %w", err)
-		}
-
-		return p, nil
-	case "lua":
-		var luaConfig processor.LuaLogProcessorConfig
-		err := remarshal(cfg.Config, &luaConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create lua processor: %w", err)
-		}
-
-		luaConfig.Name = cfg.Name
-
-		p, err := processor.NewLuaLogProcessor(luaConfig)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create json processor: %w", err)
-		}
-
-		return p, nil
-	default:
+	factory, ok := lookup(processorFactories, cfg.Type)
+	if !ok {
 		return nil, fmt.Errorf("invalid log processor type: %s", cfg.Type)
 	}
+
+	return factory(logger, cfg.Name, cfg.Config)
 }
 
 // remarshal takes an input value, marshals it to YAML, and then unmarshals it into a new value of the same type.
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func TestParseComponentsDefaultProcessors(t *testing.T) {
+	const doc = `
+default_processors: [json, sample]
+sources:
+  - name: defaults
+    type: channel
+  - name: override
+    type: channel
+    processors: [lua]
+  - name: none
+    type: channel
+    processors: []
+`
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatalf("cannot unmarshal config: %v", err)
+	}
+
+	_, sources, _, err := parseComponents(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg.Processors, cfg.Sources, cfg.DefaultProcessors)
+	if err != nil {
+		t.Fatalf("cannot parse components: %v", err)
+	}
+
+	want := map[string][]string{
+		"defaults": {"json", "sample"},
+		"override": {"lua"},
+		"none":     {},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("got %d sources, want %d", len(sources), len(want))
+	}
+
+	for _, s := range sources {
+		if got := s.ProcessorNames(); !slices.Equal(got, want[s.Name()]) {
+			t.Errorf("got processors %v of %s, want %v", got, s.Name(), want[s.Name()])
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/processor"
+	"github.com/thisisjab/logzilla/source"
+	"github.com/thisisjab/logzilla/storage"
+)
+
+// StorageFactory creates a storage from the `config` value of its configuration, which can be decoded using Decode.
+type StorageFactory func(logger *slog.Logger, config any) (engine.Storage, error)
+
+// SourceFactory creates a source from its name, its processors and the `config` value of its configuration.
+type SourceFactory func(logger *slog.Logger, name string, processors []string, config any) (engine.LogSource, error)
+
+// ProcessorFactory creates a processor from its name and the `config` value of its configuration.
+type ProcessorFactory func(logger *slog.Logger, name string, config any) (engine.LogProcessor, error)
+
+var (
+	registryMu         sync.RWMutex
+	storageFactories   = make(map[string]StorageFactory)
+	sourceFactories    = make(map[string]SourceFactory)
+	processorFactories = make(map[string]ProcessorFactory)
+)
+
+// RegisterStorage makes a storage type available to configurations. It panics if the type is already registered.
+// Types should be registered before configurations are parsed, e.g. in an init function.
+func RegisterStorage(typ string, factory StorageFactory) {
+	register(storageFactories, "storage", typ, factory)
+}
+
+// RegisterSource makes a source type available to configurations. It panics if the type is already registered.
+func RegisterSource(typ string, factory SourceFactory) {
+	register(sourceFactories, "source", typ, factory)
+}
+
+// RegisterProcessor makes a processor type available to configurations. It panics if the type is already registered.
+func RegisterProcessor(typ string, factory ProcessorFactory) {
+	register(processorFactories, "processor", typ, factory)
+}
+
+// Decode decodes the `config` value of a component into dst, which must be a pointer to a struct with yaml tags.
+func Decode(config any, dst any) error {
+	return remarshal(config, dst)
+}
+
+func register[F any](factories map[string]F, kind, typ string, factory F) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := factories[typ]; ok {
+		panic(fmt.Sprintf("%s type `%s` is already registered", kind, typ))
+	}
+
+	factories[typ] = factory
+}
+
+func lookup[F any](factories map[string]F, typ string) (F, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	f, ok := factories[typ]
+	return f, ok
+}
+
+func init() {
+	RegisterStorage("clickhouse", newClickHouseStorage)
+	RegisterStorage("memory", newMemoryStorage)
+	RegisterStorage("sqlite", newSQLiteStorage)
+	RegisterStorage("elasticsearch", newElasticStorage)
+
+	RegisterSource("file", newFileSource)
+	RegisterSource("channel", newChannelSource)
+	RegisterSource("nats", newNATSSource)
+
+	RegisterProcessor("json", newJsonProcessor)
+	RegisterProcessor("lua", newLuaProcessor)
+	RegisterProcessor("transform", newTransformProcessor)
+	RegisterProcessor("sample", newSampleProcessor)
+	RegisterProcessor("router", newRouterProcessor)
+}
+
+func newClickHouseStorage(logger *slog.Logger, config any) (engine.Storage, error) {
+	var clickHouseConfig storage.ClickHouseStorageConfig
+
+	if err := remarshal(config, &clickHouseConfig); err != nil {
+		return nil, fmt.Errorf("cannot parse clickhouse storage config: %w", err)
+	}
+
+	s, err := storage.NewClickHouseStorage(logger, clickHouseConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create clickhouse storage: %w", err)
+	}
+
+	return s, nil
+}
+
+func newMemoryStorage(logger *slog.Logger, config any) (engine.Storage, error) {
+	var memoryConfig storage.MemoryStorageConfig
+
+	if err := remarshal(config, &memoryConfig); err != nil {
+		return nil, fmt.Errorf("cannot parse memory storage config: %w", err)
+	}
+
+	return storage.NewMemoryStorage(memoryConfig), nil
+}
+
+func newSQLiteStorage(logger *slog.Logger, config any) (engine.Storage, error) {
+	var sqliteConfig storage.SQLiteStorageConfig
+
+	if err := remarshal(config, &sqliteConfig); err != nil {
+		return nil, fmt.Errorf("cannot parse sqlite storage config: %w", err)
+	}
+
+	s, err := storage.NewSQLiteStorage(logger, sqliteConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create sqlite storage: %w", err)
+	}
+
+	return s, nil
+}
+
+func newElasticStorage(logger *slog.Logger, config any) (engine.Storage, error) {
+	var elasticConfig storage.ElasticStorageConfig
+
+	if err := remarshal(config, &elasticConfig); err != nil {
+		return nil, fmt.Errorf("cannot parse elasticsearch storage config: %w", err)
+	}
+
+	s, err := storage.NewElasticStorage(elasticConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create elasticsearch storage: %w", err)
+	}
+
+	return s, nil
+}
+
+func newFileSource(logger *slog.Logger, name string, processors []string, config any) (engine.LogSource, error) {
+	var fileConfig source.FileLogSourceConfig
+	err := remarshal(config, &fileConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file source: %w", err)
+	}
+
+	fileConfig.Name = name
+	fileConfig.ProcessorNames = processors
+
+	s, err := source.NewFileLogSource(logger, fileConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file source: %w", err)
+	}
+
+	return s, nil
+}
+
+func newChannelSource(logger *slog.Logger, name string, processors []string, config any) (engine.LogSource, error) {
+	var channelConfig source.ChannelLogSourceConfig
+	err := remarshal(config, &channelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create channel source: %w", err)
+	}
+
+	channelConfig.Name = name
+	channelConfig.ProcessorNames = processors
+
+	s, err := source.NewChannelLogSource(logger, channelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create channel source: %w", err)
+	}
+
+	return s, nil
+}
+
+func newNATSSource(logger *slog.Logger, name string, processors []string, config any) (engine.LogSource, error) {
+	var natsConfig source.NATSLogSourceConfig
+	err := remarshal(config, &natsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create nats source: %w", err)
+	}
+
+	natsConfig.Name = name
+	natsConfig.ProcessorNames = processors
+
+	s, err := source.NewNATSLogSource(logger, natsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create nats source: %w", err)
+	}
+
+	return s, nil
+}
+
+func newJsonProcessor(logger *slog.Logger, name string, config any) (engine.LogProcessor, error) {
+	var jsonConfig processor.JsonLogProcessorConfig
+	err := remarshal(config, &jsonConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create json processor: %w", err)
+	}
+
+	jsonConfig.Name = name
+
+	p, err := processor.NewJsonLogProcessor(jsonConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create json processor: %w", err)
+	}
+
+	return p, nil
+}
+
+func newLuaProcessor(logger *slog.Logger, name string, config any) (engine.LogProcessor, error) {
+	var luaConfig processor.LuaLogProcessorConfig
+	err := remarshal(config, &luaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create lua processor: %w", err)
+	}
+
+	luaConfig.Name = name
+
+	p, err := processor.NewLuaLogProcessor(luaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create lua processor: %w", err)
+	}
+
+	return p, nil
+}
+
+func newTransformProcessor(logger *slog.Logger, name string, config any) (engine.LogProcessor, error) {
+	var transformConfig processor.TransformLogProcessorConfig
+	err := remarshal(config, &transformConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create transform processor: %w", err)
+	}
+
+	transformConfig.Name = name
+
+	p, err := processor.NewTransformLogProcessor(transformConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create transform processor: %w", err)
+	}
+
+	return p, nil
+}
+
+func newSampleProcessor(logger *slog.Logger, name string, config any) (engine.LogProcessor, error) {
+	var sampleConfig processor.SampleLogProcessorConfig
+	err := remarshal(config, &sampleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create sample processor: %w", err)
+	}
+
+	sampleConfig.Name = name
+
+	p, err := processor.NewSampleLogProcessor(sampleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create sample processor: %w", err)
+	}
+
+	return p, nil
+}
+
+// routerProcessorConfig is the configuration of a router processor, whose branches define their processors inline.
+type routerProcessorConfig struct {
+	Branches []struct {
+		Prefix  string `yaml:"prefix"`
+		Pattern string `yaml:"pattern"`
+		// Processor is named after the router and the index of its branch (e.g. `router/0`) if it has no name.
+		Processor ProcessorConfig `yaml:"processor"`
+	} `yaml:"branches"`
+}
+
+func newRouterProcessor(logger *slog.Logger, name string, config any) (engine.LogProcessor, error) {
+	var routerConfig routerProcessorConfig
+	err := remarshal(config, &routerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create router processor: %w", err)
+	}
+
+	branches := make([]processor.RouterBranch, len(routerConfig.Branches))
+	for i, b := range routerConfig.Branches {
+		pc := b.Processor
+		if pc.Name == "" {
+			pc.Name = fmt.Sprintf("%s/%d", name, i)
+		}
+
+		p, err := parseProcessorConfig(logger, pc)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create processor of branch %d: %w", i, err)
+		}
+
+		branches[i] = processor.RouterBranch{Prefix: b.Prefix, Pattern: b.Pattern, Processor: p}
+	}
+
+	p, err := processor.NewRouterLogProcessor(processor.RouterLogProcessorConfig{Name: name, Branches: branches})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create router processor: %w", err)
+	}
+
+	return p, nil
+}
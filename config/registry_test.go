@@ -0,0 +1,91 @@
+package config
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/entity"
+	"go.yaml.in/yaml/v3"
+)
+
+// greeterSource stands for a source type registered by external code.
+type greeterSource struct {
+	name       string
+	processors []string
+	greeting   string
+}
+
+func (s *greeterSource) Name() string { return s.name }
+
+func (s *greeterSource) ProcessorNames() []string { return s.processors }
+
+func (s *greeterSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	logChan <- entity.LogRecord{Source: s.name, RawData: []byte(s.greeting)}
+	return nil
+}
+
+func TestRegisterSource(t *testing.T) {
+	RegisterSource("greeter", func(_ *slog.Logger, name string, processors []string, config any) (engine.LogSource, error) {
+		var cfg struct {
+			Greeting string `yaml:"greeting"`
+		}
+		if err := Decode(config, &cfg); err != nil {
+			return nil, err
+		}
+		return &greeterSource{name: name, processors: processors, greeting: cfg.Greeting}, nil
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(sourceFactories, "greeter")
+	})
+
+	const doc = `
+sources:
+  - name: hello
+    type: greeter
+    processors: [json]
+    config:
+      greeting: hello world
+`
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatalf("cannot unmarshal config: %v", err)
+	}
+
+	_, sources, _, err := parseComponents(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg.Processors, cfg.Sources, cfg.DefaultProcessors)
+	if err != nil {
+		t.Fatalf("cannot parse components: %v", err)
+	}
+	if len(sources) != 1 {
+		t.Fatalf("got %d sources, want 1", len(sources))
+	}
+
+	s, ok := sources[0].(*greeterSource)
+	if !ok {
+		t.Fatalf("got source %T, want *greeterSource", sources[0])
+	}
+	if s.name != "hello" || s.greeting != "hello world" || len(s.processors) != 1 || s.processors[0] != "json" {
+		t.Errorf("got source %+v, want it configured from the document", s)
+	}
+}
+
+func TestRegisterSourceTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("got no panic, want one for a type registered twice")
+		}
+	}()
+
+	RegisterSource("channel", newChannelSource)
+}
+
+func TestParseSourceConfigUnknownType(t *testing.T) {
+	if _, err := parseSourceConfig(slog.New(slog.NewTextHandler(io.Discard, nil)), SourceConfig{Name: "s", Type: "carrier-pigeon"}); err == nil {
+		t.Error("got no error, want one for an unregistered type")
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+
+	"github.com/thisisjab/logzilla/api"
+	"github.com/thisisjab/logzilla/engine"
+)
+
+// ParseReload parses the parts of cfg which can be applied to an engine that is running with prev.
+// It also returns the config which is in effect after reload, and the settings which have changed,
+// but can't be applied until the engine is restarted. Those settings keep their previous values in the effective config.
+func (cfg Config) ParseReload(logger *slog.Logger, prev Config) (*engine.ReloadConfig, Config, []string, error) {
+	var ignored []string
+
+	if !reflect.DeepEqual(cfg.Logger, prev.Logger) {
+		ignored = append(ignored, "logger")
+	}
+	if !reflect.DeepEqual(cfg.Storage, prev.Storage) {
+		ignored = append(ignored, "storage")
+	}
+	if cfg.RawLogsBufferSize != prev.RawLogsBufferSize {
+		ignored = append(ignored, "raw_logs_buffer_size")
+	}
+	if cfg.StorageFlushInterval != prev.StorageFlushInterval {
+		ignored = append(ignored, "storage_flush_interval")
+	}
+	if cfg.ProcessedLogsBufferSize != prev.ProcessedLogsBufferSize {
+		ignored = append(ignored, "processed_logs_buffer_size")
+	}
+	if cfg.MaxConcurrentFlushes != prev.MaxConcurrentFlushes {
+		ignored = append(ignored, "max_concurrent_flushes")
+	}
+	if cfg.MaxMetadataBytes != prev.MaxMetadataBytes {
+		ignored = append(ignored, "max_metadata_bytes")
+	}
+	if cfg.ProcessorWorkersCount != prev.ProcessorWorkersCount {
+		ignored = append(ignored, "processor_workers_count")
+	}
+	if cfg.PartitionProcessingBySource != prev.PartitionProcessingBySource {
+		ignored = append(ignored, "partition_processing_by_source")
+	}
+	if cfg.ProcessorCircuitBreaker != prev.ProcessorCircuitBreaker {
+		ignored = append(ignored, "processor_circuit_breaker")
+	}
+	if cfg.SourceRestart != prev.SourceRestart {
+		ignored = append(ignored, "source_restart")
+	}
+	if !reflect.DeepEqual(cfg.Dedup, prev.Dedup) {
+		ignored = append(ignored, "dedup")
+	}
+	if cfg.WAL != prev.WAL {
+		ignored = append(ignored, "wal")
+	}
+	if cfg.RawLogsStorage != prev.RawLogsStorage {
+		ignored = append(ignored, "raw_logs_storage")
+	}
+	if !reflect.DeepEqual(cfg.API, prev.API) {
+		ignored = append(ignored, "api")
+	}
+
+	sourceConfigs := slices.Clone(cfg.Sources)
+
+	// The API holds on to the raw ingest source, so it must keep its previous definition.
+	if prev.API != nil && prev.API.Ingest.Mode == api.IngestModeRaw {
+		name := prev.API.Ingest.Source
+		prevIdx := slices.IndexFunc(prev.Sources, func(sc SourceConfig) bool { return sc.Name == name })
+		idx := slices.IndexFunc(sourceConfigs, func(sc SourceConfig) bool { return sc.Name == name })
+
+		switch {
+		case prevIdx == -1:
+		case idx == -1:
+			sourceConfigs = append(sourceConfigs, prev.Sources[prevIdx])
+			ignored = append(ignored, fmt.Sprintf("sources.%s", name))
+		case !reflect.DeepEqual(sourceConfigs[idx], prev.Sources[prevIdx]):
+			sourceConfigs[idx] = prev.Sources[prevIdx]
+			ignored = append(ignored, fmt.Sprintf("sources.%s", name))
+		}
+	}
+
+	processors, sources, backpressurePolicies, err := parseComponents(logger, cfg.Processors, sourceConfigs, cfg.DefaultProcessors)
+	if err != nil {
+		return nil, prev, ignored, err
+	}
+
+	// Sources only need a restart if something other than their processors has changed,
+	// since processors of a source are looked up for every record.
+	var restartSources []string
+	for _, sc := range sourceConfigs {
+		idx := slices.IndexFunc(prev.Sources, func(p SourceConfig) bool { return p.Name == sc.Name })
+		if idx == -1 {
+			continue
+		}
+
+		p := prev.Sources[idx]
+		p.Processors, sc.Processors = nil, nil
+		if !reflect.DeepEqual(p, sc) {
+			restartSources = append(restartSources, sc.Name)
+		}
+	}
+
+	effective := prev
+	effective.Processors = cfg.Processors
+	effective.DefaultProcessors = cfg.DefaultProcessors
+	effective.Sources = sourceConfigs
+
+	return &engine.ReloadConfig{
+		Sources:                    sources,
+		Processors:                 processors,
+		SourceBackpressurePolicies: backpressurePolicies,
+		RestartSources:             restartSources,
+	}, effective, ignored, nil
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// BackpressurePolicy defines what happens to logs of a source when the raw logs buffer is full.
+type BackpressurePolicy string
+
+const (
+	// BackpressureBlock blocks the source until there is room in the buffer. This is the default.
+	BackpressureBlock BackpressurePolicy = "block"
+	// BackpressureDropOldest drops the oldest buffered log to make room for the new one.
+	BackpressureDropOldest BackpressurePolicy = "drop-oldest"
+	// BackpressureDropNew drops the new log.
+	BackpressureDropNew BackpressurePolicy = "drop-new"
+)
+
+func (p BackpressurePolicy) isValid() bool {
+	switch p {
+	case BackpressureBlock, BackpressureDropOldest, BackpressureDropNew:
+		return true
+	default:
+		return false
+	}
+}
+
+// forwardLog pushes a log of the given source into rawLogs, honoring the backpressure policy.
+func forwardLog(ctx context.Context, policy BackpressurePolicy, rawLogs chan entity.LogRecord, source string, l entity.LogRecord) {
+	defer func() {
+		if c := cap(rawLogs); c > 0 {
+			rawLogsBufferSaturation.Set(float64(len(rawLogs)) / float64(c))
+		}
+	}()
+
+	switch policy {
+	case BackpressureDropNew:
+		select {
+		case rawLogs <- l:
+		default:
+			droppedSourceLogs.WithLabelValues(source).Inc()
+		}
+
+	case BackpressureDropOldest:
+		for {
+			select {
+			case rawLogs <- l:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			// Buffer is full, make room by dropping the oldest log.
+			select {
+			case old := <-rawLogs:
+				droppedSourceLogs.WithLabelValues(old.Source).Inc()
+			default:
+			}
+		}
+
+	default:
+		select {
+		case rawLogs <- l:
+		case <-ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// bufferedMessages drains rawLogs, returning the messages of the buffered logs.
+func bufferedMessages(rawLogs chan entity.LogRecord) []string {
+	var messages []string
+	for {
+		select {
+		case l := <-rawLogs:
+			messages = append(messages, l.Message)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestForwardLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   BackpressurePolicy
+		buffered []string
+		want     []string
+	}{
+		{name: "block with room", policy: BackpressureBlock, buffered: []string{"a"}, want: []string{"a", "new"}},
+		{name: "block while full", policy: BackpressureBlock, buffered: []string{"a", "b"}, want: []string{"a", "b"}},
+		{name: "drop new with room", policy: BackpressureDropNew, buffered: []string{"a"}, want: []string{"a", "new"}},
+		{name: "drop new while full", policy: BackpressureDropNew, buffered: []string{"a", "b"}, want: []string{"a", "b"}},
+		{name: "drop oldest with room", policy: BackpressureDropOldest, buffered: []string{"a"}, want: []string{"a", "new"}},
+		{name: "drop oldest while full", policy: BackpressureDropOldest, buffered: []string{"a", "b"}, want: []string{"b", "new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawLogs := make(chan entity.LogRecord, 2)
+			for _, message := range tt.buffered {
+				rawLogs <- entity.LogRecord{Source: "test", Message: message}
+			}
+
+			// Only a blocked source waits for ctx.
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			forwardLog(ctx, tt.policy, rawLogs, "test", entity.LogRecord{Source: "test", Message: "new"})
+
+			blocked := time.Since(start) >= 50*time.Millisecond
+			if wantBlocked := tt.policy == BackpressureBlock && len(tt.buffered) == cap(rawLogs); blocked != wantBlocked {
+				t.Errorf("got source blocked %v, want %v", blocked, wantBlocked)
+			}
+
+			if got := bufferedMessages(rawLogs); !slices.Equal(got, tt.want) {
+				t.Errorf("got buffered logs %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineRejectsInvalidBackpressurePolicy(t *testing.T) {
+	_, err := New(Config{
+		Sources:                    []LogSource{idleSource{}},
+		Storage:                    &fakeStorage{},
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+		SourceBackpressurePolicies: map[string]BackpressurePolicy{"idle": "drop-everything"},
+	}, discardLogger())
+	if err == nil {
+		t.Error("got no error, want one for an unknown backpressure policy")
+	}
+}
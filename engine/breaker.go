@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow       = 1 * time.Minute
+	defaultBreakerOpenDuration = 30 * time.Second
+	defaultBreakerMinRequests  = 20
+
+	// breakerBuckets is the number of buckets the sliding window is split into.
+	breakerBuckets = 10
+)
+
+// ProcessorBreakerConfig configures circuit breakers of processors. A processor whose error rate exceeds
+// the threshold is skipped (records pass through it unchanged) for a while, then tried again.
+type ProcessorBreakerConfig struct {
+	// ErrorRateThreshold is the ratio of failed records (0 to 1) that opens the breaker. Zero disables breakers.
+	ErrorRateThreshold float64
+	// MinRequests is the minimum number of records in the window before the error rate is considered.
+	MinRequests uint
+	// Window is the duration of the sliding window the error rate is computed over.
+	Window time.Duration
+	// OpenDuration is how long a processor is skipped before it's tried again.
+	OpenDuration time.Duration
+}
+
+func (c *ProcessorBreakerConfig) setDefaults() {
+	if c.MinRequests == 0 {
+		c.MinRequests = defaultBreakerMinRequests
+	}
+
+	if c.Window == 0 {
+		c.Window = defaultBreakerWindow
+	}
+
+	if c.OpenDuration == 0 {
+		c.OpenDuration = defaultBreakerOpenDuration
+	}
+}
+
+func (c ProcessorBreakerConfig) validate() error {
+	if c.ErrorRateThreshold < 0 || c.ErrorRateThreshold > 1 {
+		return errors.New("processor breaker error rate threshold must be between 0 and 1")
+	}
+
+	if c.Window < breakerBuckets*time.Millisecond {
+		return errors.New("processor breaker window must be at least 10ms")
+	}
+
+	if c.OpenDuration < 0 {
+		return errors.New("processor breaker open duration cannot be negative")
+	}
+
+	return nil
+}
+
+func (c ProcessorBreakerConfig) enabled() bool {
+	return c.ErrorRateThreshold > 0
+}
+
+type breakerState uint8
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen lets a single record through to find out if the processor has recovered. Other records skip the
+	// processor until the result of that record is recorded.
+	breakerHalfOpen
+)
+
+type breakerBucket struct {
+	start  time.Time
+	total  uint
+	failed uint
+}
+
+// circuitBreaker tracks the error rate of a single processor over a sliding window.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	cfg      ProcessorBreakerConfig
+	buckets  [breakerBuckets]breakerBucket
+	state    breakerState
+	openedAt time.Time
+	// probing is set while the record let through by the half-open breaker is being processed.
+	probing bool
+}
+
+func newCircuitBreaker(cfg ProcessorBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg}
+}
+
+// allow reports whether the processor should be used. An open breaker becomes half-open once OpenDuration has passed,
+// and then allows a single record, whose result must be recorded.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && now.Sub(b.openedAt) >= b.cfg.OpenDuration {
+		b.state = breakerHalfOpen
+		b.probing = false
+	}
+
+	switch b.state {
+	case breakerOpen:
+		return false
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+
+	return true
+}
+
+// record registers the result of processing a record, and returns the new state if it has changed.
+func (b *circuitBreaker) record(now time.Time, failed bool) (breakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		// Records which were allowed before the breaker opened.
+		return b.state, false
+
+	case breakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.state = breakerOpen
+			b.openedAt = now
+		} else {
+			b.state = breakerClosed
+			b.buckets = [breakerBuckets]breakerBucket{}
+		}
+		return b.state, true
+	}
+
+	bucketSize := b.cfg.Window / breakerBuckets
+	start := now.Truncate(bucketSize)
+	bucket := &b.buckets[(start.UnixNano()/int64(bucketSize))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+
+	bucket.total++
+	if failed {
+		bucket.failed++
+	}
+
+	var total, failedTotal uint
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) < b.cfg.Window {
+			total += bk.total
+			failedTotal += bk.failed
+		}
+	}
+
+	if total >= b.cfg.MinRequests && float64(failedTotal)/float64(total) >= b.cfg.ErrorRateThreshold {
+		b.state = breakerOpen
+		b.openedAt = now
+		return b.state, true
+	}
+
+	return b.state, false
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+func TestCircuitBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	cfg := ProcessorBreakerConfig{ErrorRateThreshold: 0.5, MinRequests: 2, Window: time.Minute, OpenDuration: time.Second}
+	b := newCircuitBreaker(cfg)
+	now := time.Now()
+
+	for range 2 {
+		if !b.allow(now) {
+			t.Fatal("got records rejected by a closed breaker")
+		}
+		b.record(now, true)
+	}
+
+	if b.allow(now) {
+		t.Fatal("got records allowed by an open breaker")
+	}
+
+	// Once half-open, only the probe is let through until its result is recorded.
+	now = now.Add(cfg.OpenDuration)
+	if !b.allow(now) {
+		t.Fatal("got the probe rejected by a half-open breaker")
+	}
+
+	for range 10 {
+		if b.allow(now) {
+			t.Fatal("got records allowed while the probe is being processed")
+		}
+	}
+
+	// A failed probe opens the breaker again.
+	if state, changed := b.record(now, true); state != breakerOpen || !changed {
+		t.Fatalf("got state %d (changed: %v) after a failed probe, want open", state, changed)
+	}
+
+	if b.allow(now) {
+		t.Fatal("got records allowed after a failed probe")
+	}
+
+	now = now.Add(cfg.OpenDuration)
+	if !b.allow(now) || b.allow(now) {
+		t.Fatal("got no single probe allowed once half-open again")
+	}
+
+	// A successful probe closes the breaker, letting every record through.
+	if state, changed := b.record(now, false); state != breakerClosed || !changed {
+		t.Fatalf("got state %d (changed: %v) after a successful probe, want closed", state, changed)
+	}
+
+	for range 10 {
+		if !b.allow(now) {
+			t.Fatal("got records rejected after a successful probe")
+		}
+	}
+}
+
+func TestCircuitBreakerTripsAtThreshold(t *testing.T) {
+	cfg := ProcessorBreakerConfig{ErrorRateThreshold: 0.5, MinRequests: 4, Window: time.Minute, OpenDuration: time.Second}
+
+	tests := []struct {
+		name     string
+		failures []bool
+		wantOpen bool
+	}{
+		{name: "too few records", failures: []bool{true, true, true}},
+		{name: "error rate below threshold", failures: []bool{false, true, false, false, true, false}},
+		{name: "error rate at threshold", failures: []bool{false, true, false, true}, wantOpen: true},
+		{name: "error rate above threshold", failures: []bool{true, true, true, true}, wantOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(cfg)
+			now := time.Now()
+
+			var state breakerState
+			for i, failed := range tt.failures {
+				var changed bool
+				state, changed = b.record(now, failed)
+				if changed && i != len(tt.failures)-1 {
+					t.Fatalf("got state %d after record %d, want it to change on the last record only", state, i)
+				}
+			}
+
+			if got := state == breakerOpen; got != tt.wantOpen {
+				t.Errorf("got breaker open %v, want %v", got, tt.wantOpen)
+			}
+			if got := !b.allow(now); got != tt.wantOpen {
+				t.Errorf("got records rejected %v, want %v", got, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerForgetsFailuresOutsideWindow(t *testing.T) {
+	cfg := ProcessorBreakerConfig{ErrorRateThreshold: 0.5, MinRequests: 2, Window: time.Second, OpenDuration: time.Second}
+	b := newCircuitBreaker(cfg)
+	now := time.Now()
+
+	b.record(now, true)
+	if state, _ := b.record(now.Add(2*cfg.Window), true); state != breakerClosed {
+		t.Errorf("got state %d, want failures outside the window to be ignored", state)
+	}
+}
+
+// failingProcessor fails every record, counting the records it's called with.
+type failingProcessor struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *failingProcessor) Name() string { return "failing" }
+
+func (p *failingProcessor) Process(r entity.LogRecord) (entity.LogRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	return r, errors.New("cannot process")
+}
+
+// fakeSource is a source providing no logs, processed by the given processors.
+type fakeSource struct {
+	name       string
+	processors []string
+}
+
+func (s fakeSource) Name() string { return s.name }
+
+func (s fakeSource) ProcessorNames() []string { return s.processors }
+
+func (s fakeSource) Provide(ctx context.Context, _ chan<- entity.LogRecord) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestProcessorManagerSkipsProcessorWhileBreakerOpen(t *testing.T) {
+	p := &failingProcessor{}
+	cfg := ProcessorBreakerConfig{ErrorRateThreshold: 0.5, MinRequests: 5, Window: time.Minute, OpenDuration: time.Hour}
+	pm := newProcessorManager(discardLogger(), []LogSource{fakeSource{name: "api", processors: []string{"failing"}}}, []LogProcessor{p}, 1, false, cfg)
+
+	for i := range 20 {
+		record := entity.LogRecord{Source: "api", Message: "message"}
+		got, ok := pm.processLog(record)
+		if !ok {
+			t.Fatalf("got record %d dropped, want it passed through unchanged", i)
+		}
+		if got.Message != record.Message {
+			t.Fatalf("got message %q, want record %d unchanged", got.Message, i)
+		}
+	}
+
+	if p.calls != int(cfg.MinRequests) {
+		t.Errorf("got processor called %d times, want it skipped once the breaker opened after %d records", p.calls, cfg.MinRequests)
+	}
+}
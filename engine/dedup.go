@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+const defaultDedupMaxEntries = 100_000
+
+var (
+	dedupAllowedFields = []string{"source", "timestamp", "level", "message", "metadata"}
+	defaultDedupFields = []string{"source", "timestamp", "message"}
+)
+
+// DedupConfig configures dropping processed logs which are identical to a log stored shortly before.
+// Logs are identical when their fingerprints, computed from the configured fields, are equal.
+type DedupConfig struct {
+	// Window is how long a log is remembered. Zero disables deduplication.
+	Window time.Duration
+	// MaxEntries is the maximum number of remembered logs. The oldest ones are forgotten first. Defaults to 100000.
+	MaxEntries uint
+	// Fields are the fields fingerprints are computed from. Any of source, timestamp, level, message and metadata.
+	// Defaults to source, timestamp and message.
+	Fields []string
+}
+
+func (c *DedupConfig) setDefaults() {
+	if c.MaxEntries == 0 {
+		c.MaxEntries = defaultDedupMaxEntries
+	}
+
+	if c.Fields == nil {
+		c.Fields = defaultDedupFields
+	}
+}
+
+func (c DedupConfig) validate() error {
+	if c.Window < 0 {
+		return errors.New("deduplication window cannot be negative")
+	}
+
+	if len(c.Fields) == 0 {
+		return errors.New("deduplication fields cannot be empty")
+	}
+
+	for _, f := range c.Fields {
+		if !slices.Contains(dedupAllowedFields, f) {
+			return fmt.Errorf("invalid deduplication field: %s", f)
+		}
+	}
+
+	return nil
+}
+
+func (c DedupConfig) enabled() bool {
+	return c.Window > 0
+}
+
+type dedupEntry struct {
+	fingerprint [16]byte
+	seenAt      time.Time
+}
+
+// deduplicator remembers fingerprints of recent logs in a bounded LRU, ordered by the time they were first seen.
+type deduplicator struct {
+	mu      sync.Mutex
+	cfg     DedupConfig
+	entries map[[16]byte]*list.Element
+	order   *list.List
+}
+
+func newDeduplicator(cfg DedupConfig) *deduplicator {
+	return &deduplicator{
+		cfg:     cfg,
+		entries: make(map[[16]byte]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// filter returns logs which haven't been seen within the window, including only the first of duplicates in logs.
+func (d *deduplicator) filter(now time.Time, logs []entity.LogRecord) []entity.LogRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Forget logs which are out of the window.
+	for e := d.order.Front(); e != nil && now.Sub(e.Value.(dedupEntry).seenAt) >= d.cfg.Window; e = d.order.Front() {
+		delete(d.entries, e.Value.(dedupEntry).fingerprint)
+		d.order.Remove(e)
+	}
+
+	res := logs[:0:0]
+	for _, l := range logs {
+		fp := d.fingerprint(l)
+		if _, ok := d.entries[fp]; ok {
+			deduplicatedLogs.WithLabelValues(l.Source).Inc()
+			continue
+		}
+
+		d.entries[fp] = d.order.PushBack(dedupEntry{fingerprint: fp, seenAt: now})
+		if uint(d.order.Len()) > d.cfg.MaxEntries {
+			oldest := d.order.Front()
+			delete(d.entries, oldest.Value.(dedupEntry).fingerprint)
+			d.order.Remove(oldest)
+		}
+
+		res = append(res, l)
+	}
+
+	return res
+}
+
+// forget removes logs returned by filter, so they're not considered duplicates anymore.
+func (d *deduplicator) forget(logs []entity.LogRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, l := range logs {
+		fp := d.fingerprint(l)
+		if e, ok := d.entries[fp]; ok {
+			delete(d.entries, fp)
+			d.order.Remove(e)
+		}
+	}
+}
+
+func (d *deduplicator) fingerprint(l entity.LogRecord) [16]byte {
+	h := fnv.New128a()
+
+	for _, f := range d.cfg.Fields {
+		switch f {
+		case "source":
+			h.Write([]byte(l.Source)) //nolint:errcheck
+		case "timestamp":
+			h.Write(binary.BigEndian.AppendUint64(nil, uint64(l.Timestamp.UnixNano()))) //nolint:errcheck
+		case "level":
+			h.Write([]byte{byte(l.Level)}) //nolint:errcheck
+		case "message":
+			h.Write([]byte(l.Message)) //nolint:errcheck
+		case "metadata":
+			// Keys of maps are sorted when marshaled, so equal metadata always results in the same bytes.
+			b, _ := json.Marshal(l.Metadata)
+			h.Write(b) //nolint:errcheck
+		}
+		// Separates fields, so e.g. moving a suffix of the source to the message changes the fingerprint.
+		h.Write([]byte{0}) //nolint:errcheck
+	}
+
+	var fp [16]byte
+	h.Sum(fp[:0])
+
+	return fp
+}
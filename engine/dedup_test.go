@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+func logMessages(logs []entity.LogRecord) []string {
+	var res []string
+	for _, l := range logs {
+		res = append(res, l.Message)
+	}
+	return res
+}
+
+func TestDeduplicatorFilter(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	log := func(message string) entity.LogRecord {
+		return entity.LogRecord{Source: "api", Timestamp: start, Message: message}
+	}
+
+	tests := []struct {
+		name  string
+		cfg   DedupConfig
+		after time.Duration
+		first []entity.LogRecord
+		then  []entity.LogRecord
+		want  []string
+	}{
+		{
+			name:  "duplicates within a batch",
+			first: []entity.LogRecord{log("a"), log("a"), log("b")},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "duplicates within the window are dropped",
+			after: time.Minute - time.Nanosecond,
+			first: []entity.LogRecord{log("a"), log("b")},
+			then:  []entity.LogRecord{log("a"), log("c")},
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name:  "duplicates after the window are kept",
+			after: time.Minute,
+			first: []entity.LogRecord{log("a"), log("b")},
+			then:  []entity.LogRecord{log("a"), log("c")},
+			want:  []string{"a", "b", "a", "c"},
+		},
+		{
+			name:  "oldest logs are forgotten beyond max entries",
+			cfg:   DedupConfig{MaxEntries: 2, Fields: defaultDedupFields},
+			first: []entity.LogRecord{log("a"), log("b"), log("c")},
+			then:  []entity.LogRecord{log("a"), log("c")},
+			want:  []string{"a", "b", "c", "a"},
+		},
+		{
+			name:  "logs differing in other fields are duplicates",
+			cfg:   DedupConfig{MaxEntries: 10, Fields: []string{"message"}},
+			first: []entity.LogRecord{log("a"), {Source: "worker", Message: "a"}},
+			want:  []string{"a"},
+		},
+		{
+			name:  "logs differing in a field are kept",
+			first: []entity.LogRecord{log("a"), {Source: "worker", Timestamp: start, Message: "a"}, {Source: "api", Message: "a"}},
+			want:  []string{"a", "a", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Window = time.Minute
+			cfg.setDefaults()
+			d := newDeduplicator(cfg)
+
+			got := logMessages(d.filter(start, tt.first))
+			got = append(got, logMessages(d.filter(start.Add(tt.after), tt.then))...)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got logs %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorForget(t *testing.T) {
+	now := time.Now()
+	d := newDeduplicator(DedupConfig{Window: time.Minute, MaxEntries: 10, Fields: defaultDedupFields})
+
+	// Logs which fail to be stored are forgotten, so they're stored when they're retried.
+	logs := []entity.LogRecord{{Message: "a"}, {Message: "b"}}
+	d.filter(now, logs)
+	d.forget(logs[:1])
+
+	if got := logMessages(d.filter(now, logs)); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("got logs %q, want the forgotten log only", got)
+	}
+}
+
+func TestDedupConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DedupConfig
+		wantErr bool
+	}{
+		{name: "disabled", cfg: DedupConfig{}},
+		{name: "valid", cfg: DedupConfig{Window: time.Minute, Fields: []string{"source", "level", "metadata"}}},
+		{name: "negative window", cfg: DedupConfig{Window: -time.Minute}, wantErr: true},
+		{name: "no fields", cfg: DedupConfig{Window: time.Minute, Fields: []string{}}, wantErr: true},
+		{name: "unknown field", cfg: DedupConfig{Window: time.Minute, Fields: []string{"id"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.setDefaults()
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rawLogsBufferSaturation = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "logzilla_raw_logs_buffer_saturation",
+		Help: "Ratio of the raw logs buffer currently in use (0 to 1).",
+	})
+
+	droppedSourceLogs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_source_dropped_logs_total",
+		Help: "Number of logs dropped due to backpressure, per source.",
+	}, []string{"source"})
+
+	processorBreakerOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "logzilla_processor_breaker_open",
+		Help: "Whether the circuit breaker of a processor is open (1) or not (0).",
+	}, []string{"processor"})
+
+	skippedProcessorLogs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_processor_skipped_logs_total",
+		Help: "Number of logs which skipped a processor due to its open circuit breaker, per processor.",
+	}, []string{"processor"})
+
+	processorPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_processor_panics_total",
+		Help: "Number of logs a processor panicked on, per processor.",
+	}, []string{"processor"})
+
+	droppedProcessorLogs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_processor_dropped_logs_total",
+		Help: "Number of logs dropped by a processor (e.g. by sampling), per processor.",
+	}, []string{"processor"})
+
+	sourceRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_source_restarts_total",
+		Help: "Number of times a failed source was restarted, per source.",
+	}, []string{"source"})
+
+	logLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "logzilla_log_latency_seconds",
+		Help:    "Time from a log being read by a source to it being stored as a processed log.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+
+	truncatedMetadata = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_truncated_metadata_total",
+		Help: "Number of processed logs whose metadata was dropped for exceeding the maximum size, per source.",
+	}, []string{"source"})
+
+	walSkippedLogs = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "logzilla_wal_skipped_logs_total",
+		Help: "Number of processed logs buffered without being written ahead, e.g. because the write-ahead log is full.",
+	})
+
+	deduplicatedLogs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logzilla_deduplicated_logs_total",
+		Help: "Number of processed logs dropped as duplicates, per source.",
+	}, []string{"source"})
+)
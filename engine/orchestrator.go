@@ -19,24 +19,97 @@ type Config struct {
 	RawLogsBufferMaxSize       uint
 	ProcessedLogsBufferMaxSize uint
 	ProcessorWorkersCount      uint
+
+	// MaxMetadataBytes limits the size of the JSON encoded metadata of processed logs. Metadata of larger logs is
+	// replaced by `_truncated` and `_original_size` keys. Zero means no limit.
+	MaxMetadataBytes uint
+
+	// MaxConcurrentFlushes limits the number of flushes to the storage running at the same time. When reached,
+	// logs are held back until a flush completes. Zero means no limit.
+	MaxConcurrentFlushes uint
+
+	// PartitionProcessingBySource makes records of the same source be processed in order by a single worker.
+	// Records of different sources are still processed in parallel.
+	PartitionProcessingBySource bool
+
+	// SourceBackpressurePolicies maps source names to their backpressure policy.
+	// Sources not listed here use BackpressureBlock.
+	SourceBackpressurePolicies map[string]BackpressurePolicy
+
+	// ProcessorBreaker configures circuit breakers, which temporarily skip processors failing on most records.
+	ProcessorBreaker ProcessorBreakerConfig
+
+	// RawLogsStorage configures storing raw logs along with processed logs.
+	RawLogsStorage RawLogsStorageConfig
+
+	// Dedup configures dropping duplicate processed logs before they're stored.
+	Dedup DedupConfig
+
+	// SourceRestart configures restarting failed sources.
+	SourceRestart SourceRestartConfig
+
+	// WAL configures writing processed logs ahead to disk while they're buffered. It's disabled by default.
+	WAL WALConfig
+}
+
+// RawLogsStorageConfig configures storing raw logs, as emitted by sources before being processed.
+// Raw logs are buffered separately from processed logs. Like processed logs, buffering and scheduled flushing
+// cannot both be disabled.
+type RawLogsStorageConfig struct {
+	Enabled bool
+
+	// BufferMaxSize is the number of raw logs buffered before flushing. Zero disables buffering.
+	BufferMaxSize uint
+
+	// FlushInterval is the interval at which raw logs are flushed. Zero disables scheduled flushing.
+	FlushInterval time.Duration
 }
 
+// errEngineNotRunning is returned when logs are handed to an engine which isn't running.
+var errEngineNotRunning = errors.New("engine is not running")
+
 // Engine orchestrates different components such as log sources (readers) and processors.
 type Engine struct {
 	cfg            Config
 	logger         *slog.Logger
 	storageManager *storageManager
+	// connected is closed once the engine is connected to the storage (see WaitConnected).
+	connected chan struct{}
+
+	// Following fields are set once the engine is running, and are guarded by mu since they're modified by Reload.
+	mu             sync.Mutex
+	runCtx         context.Context
+	rawLogs        chan entity.LogRecord
+	sourcesWg      sync.WaitGroup
+	runningSources map[string]*runningSource
+	pm             *processorManager
 }
 
 func New(cfg Config, logger *slog.Logger) (*Engine, error) {
+	cfg.ProcessorBreaker.setDefaults()
+	cfg.Dedup.setDefaults()
+	cfg.SourceRestart.setDefaults()
+	cfg.WAL.setDefaults()
+
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
 
+	sm := newStorageManager(logger, cfg.Storage, cfg.RawLogsBufferMaxSize, cfg.StorageFlushInterval, cfg.RawLogsStorage, cfg.Dedup, cfg.MaxConcurrentFlushes, cfg.MaxMetadataBytes)
+
+	if cfg.WAL.enabled() {
+		w, err := openWAL(logger, cfg.WAL)
+		if err != nil {
+			return nil, err
+		}
+		sm.wal = w
+	}
+
 	return &Engine{
 		cfg:            cfg,
 		logger:         logger,
-		storageManager: newStorageManager(logger, cfg.Storage, cfg.RawLogsBufferMaxSize, cfg.StorageFlushInterval)}, nil
+		storageManager: sm,
+		connected:      make(chan struct{})}, nil
 }
 
 func (c Config) validate() error {
@@ -54,6 +127,16 @@ func (c Config) validate() error {
 		return errors.New("raw logs buffer max size and storage flush interval cannot both be zero")
 	}
 
+	if c.RawLogsStorage.Enabled {
+		if _, ok := c.Storage.(RawLogsStorer); !ok {
+			return errors.New("storage does not support storing raw logs")
+		}
+
+		if c.RawLogsStorage.BufferMaxSize == 0 && c.RawLogsStorage.FlushInterval == 0 {
+			return errors.New("raw logs storage buffer max size and flush interval cannot both be zero")
+		}
+	}
+
 	if c.ProcessedLogsBufferMaxSize == 0 {
 		return errors.New("processed logs buffer max size cannot be zero")
 	}
@@ -62,6 +145,24 @@ func (c Config) validate() error {
 		return errors.New("processor workers cannot be zero")
 	}
 
+	for name, policy := range c.SourceBackpressurePolicies {
+		if !policy.isValid() {
+			return fmt.Errorf("invalid backpressure policy `%s` for source `%s`", policy, name)
+		}
+	}
+
+	if err := c.ProcessorBreaker.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Dedup.validate(); err != nil {
+		return err
+	}
+
+	if err := c.SourceRestart.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -72,19 +173,40 @@ func (e *Engine) Run(ctx context.Context) error {
 		return fmt.Errorf("cannot establish a connection to the storage: %w", err)
 	}
 
-	// Start consuming logs from all sources.
+	// Logs buffered when a previous run crashed are stored before new logs are buffered.
+	if err := e.storageManager.replayWAL(ctx); err != nil {
+		return err
+	}
+
+	pm := newProcessorManager(e.logger, e.cfg.Sources, e.cfg.Processors, e.cfg.ProcessorWorkersCount, e.cfg.PartitionProcessingBySource, e.cfg.ProcessorBreaker)
+
 	// rawLogs will contain all raw logs from all sources.
-	rawLogs := e.consumeLogs(ctx)
+	rawLogs := e.consumeLogs(ctx, pm)
+
+	// Processed logs may be handed to the engine from now on (see StoreProcessedLogs).
+	close(e.connected)
+
+	// Raw logs are handed to the storage manager before they're fanned out to processors.
+	if e.storageManager.storesRawLogs() {
+		rawLogs = e.storeRawLogs(ctx, rawLogs)
+	}
 
 	var wg sync.WaitGroup
 	processedLogs := make(chan entity.LogRecord, e.cfg.ProcessedLogsBufferMaxSize)
 
-	pm := newProcessorManager(e.logger, e.cfg.Sources, e.cfg.Processors, e.cfg.ProcessorWorkersCount)
-
 	// Storage manager handles buffering, and periodic saves.
 	wg.Go(func() { e.storageManager.run(ctx) })
 	// Process manager handles fan-out pattern.
-	wg.Go(func() { pm.run(ctx, rawLogs, processedLogs) })
+	workersReady := make(chan struct{})
+	wg.Go(func() { pm.run(ctx, rawLogs, processedLogs, workersReady) })
+
+	// Sources are started once workers are running, so a burst of logs provided on start isn't stalled, or dropped
+	// by backpressure policies, while nothing consumes them.
+	select {
+	case <-workersReady:
+		e.startSources()
+	case <-ctx.Done():
+	}
 
 	for {
 		select {
@@ -106,29 +228,110 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 }
 
-func (e *Engine) consumeLogs(ctx context.Context) <-chan entity.LogRecord {
-	rawLogs := make(chan entity.LogRecord, e.cfg.RawLogsBufferMaxSize)
-	e.logger.Info("created incoming logs channel.", "size", e.cfg.RawLogsBufferMaxSize)
+// StoreProcessedLogs hands already processed logs (e.g. posted to the API) to the storage manager, bypassing
+// processors. Like logs of processors, they're deduplicated, their metadata is limited, and they're buffered before
+// being stored. If the write-ahead log is enabled, it returns once logs are written ahead, and fails if they can't be
+// (e.g. the write-ahead log is full). It fails if the engine isn't running.
+func (e *Engine) StoreProcessedLogs(ctx context.Context, logs ...entity.LogRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	var sourceWg sync.WaitGroup
+	e.mu.Lock()
+	runCtx := e.runCtx
+	e.mu.Unlock()
 
-	// Spawn sources
-	for _, s := range e.cfg.Sources {
-		sourceWg.Add(1)
-		go func(name string, src LogSource) {
-			defer sourceWg.Done()
-			err := src.Provide(ctx, rawLogs)
+	// Buffered logs are flushed using the context of the engine, since they outlive the caller's request.
+	if runCtx == nil || runCtx.Err() != nil {
+		return errEngineNotRunning
+	}
 
-			if err != nil {
-				e.logger.Error("failed to start log source.", "name", name, "error", err)
-			}
-		}(s.Name(), s)
+	return e.storageManager.addProcessedLogsDurably(runCtx, logs...)
+}
+
+// WaitConnected blocks until the running engine is connected to the storage, and has stored logs left in the
+// write-ahead log, so the storage can be used by others (e.g. the API).
+func (e *Engine) WaitConnected(ctx context.Context) error {
+	select {
+	case <-e.connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
+
+// FlushBuffers stores buffered logs right away, instead of waiting for the flush interval or the buffers to fill up
+// (e.g. before a deploy). It returns the number of processed logs flushed.
+func (e *Engine) FlushBuffers(ctx context.Context) (int, error) {
+	return e.storageManager.flushNow(ctx)
+}
+
+// consumeLogs creates the channel logs of sources are provided into. Sources are started by startSources.
+func (e *Engine) consumeLogs(ctx context.Context, pm *processorManager) <-chan entity.LogRecord {
+	rawLogs := make(chan entity.LogRecord, e.cfg.RawLogsBufferMaxSize)
+	e.logger.Info("created incoming logs channel.", "size", e.cfg.RawLogsBufferMaxSize)
+
+	e.mu.Lock()
+	e.runCtx = ctx
+	e.rawLogs = rawLogs
+	e.runningSources = make(map[string]*runningSource)
+	e.pm = pm
+	e.mu.Unlock()
 
+	// Sources may be started by Reload until ctx is done, so rawLogs is closed only after that.
 	go func() {
-		sourceWg.Wait()
+		<-ctx.Done()
+
+		// Holding the lock makes sure no source is started while waiting.
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.sourcesWg.Wait()
 		close(rawLogs)
 	}()
 
 	return rawLogs
 }
+
+// startSources spawns all configured sources, providing logs into the channel created by consumeLogs.
+func (e *Engine) startSources() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range e.cfg.Sources {
+		// Reload may have started the source meanwhile.
+		if _, ok := e.runningSources[s.Name()]; !ok {
+			e.startSource(s)
+		}
+	}
+}
+
+// storeRawLogs hands every log read from rawLogs to the storage manager, then forwards it to the returned channel.
+func (e *Engine) storeRawLogs(ctx context.Context, rawLogs <-chan entity.LogRecord) <-chan entity.LogRecord {
+	out := make(chan entity.LogRecord)
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case l, ok := <-rawLogs:
+				if !ok {
+					return
+				}
+
+				e.storageManager.addRawLogs(ctx, l)
+
+				select {
+				case out <- l:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
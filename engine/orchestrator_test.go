@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/querier"
+	"github.com/thisisjab/logzilla/source"
+	"github.com/thisisjab/logzilla/storage"
+)
+
+var pipelineTime = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// levelPrefixProcessor parses raw data like `ERROR disk full` into the level and the message of the record.
+type levelPrefixProcessor struct{}
+
+func (levelPrefixProcessor) Name() string { return "level_prefix" }
+
+func (levelPrefixProcessor) Process(r entity.LogRecord) (entity.LogRecord, error) {
+	level, message, _ := bytes.Cut(r.RawData, []byte(" "))
+
+	r.Level, _ = entity.ParseLogLevel(string(level))
+	r.Message = string(message)
+	r.Timestamp = pipelineTime
+	return r, nil
+}
+
+// idleSource provides no logs until ctx is done.
+type idleSource struct{}
+
+func (idleSource) Name() string { return "idle" }
+
+func (idleSource) ProcessorNames() []string { return nil }
+
+func (idleSource) Provide(ctx context.Context, _ chan<- entity.LogRecord) error {
+	<-ctx.Done()
+	return nil
+}
+
+// blockingStorage is a fakeStorage whose Connect blocks until unblock is closed.
+type blockingStorage struct {
+	fakeStorage
+	unblock chan struct{}
+}
+
+func (b *blockingStorage) Connect(ctx context.Context) error {
+	select {
+	case <-b.unblock:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestEngineWaitConnected(t *testing.T) {
+	storage := &blockingStorage{unblock: make(chan struct{})}
+	e, err := New(Config{
+		Sources:                    []LogSource{idleSource{}},
+		Storage:                    storage,
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+
+	waitCtx, cancelWait := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelWait()
+	if err := e.WaitConnected(waitCtx); err == nil {
+		t.Fatal("got engine connected before the storage accepted the connection")
+	}
+
+	close(storage.unblock)
+	if err := e.WaitConnected(ctx); err != nil {
+		t.Fatalf("cannot wait for the engine to connect: %v", err)
+	}
+
+	// Processed logs handed to the running engine are stored on shutdown at the latest.
+	if err := e.StoreProcessedLogs(context.Background(), testLogs(2)...); err != nil {
+		t.Fatalf("cannot store processed logs: %v", err)
+	}
+
+	cancel()
+	<-done
+
+	if processed, _ := storage.counts(); processed != 2 {
+		t.Errorf("got %d stored logs, want 2", processed)
+	}
+}
+
+func TestEnginePipeline(t *testing.T) {
+	src, err := source.NewChannelLogSource(discardLogger(), source.ChannelLogSourceConfig{
+		Name:           "api",
+		ProcessorNames: []string{"level_prefix"},
+		BufferSize:     10,
+	})
+	if err != nil {
+		t.Fatalf("cannot create source: %v", err)
+	}
+
+	memory := storage.NewMemoryStorage(storage.MemoryStorageConfig{})
+	e, err := New(Config{
+		Sources:                    []LogSource{src},
+		Processors:                 []LogProcessor{levelPrefixProcessor{}},
+		Storage:                    memory,
+		StorageFlushInterval:       10 * time.Millisecond,
+		RawLogsBufferMaxSize:       100,
+		ProcessedLogsBufferMaxSize: 100,
+		ProcessorWorkersCount:      2,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := e.WaitConnected(ctx); err != nil {
+		t.Fatalf("cannot wait for the engine to connect: %v", err)
+	}
+
+	raw := []string{"INFO user signed in", "ERROR disk full", "WARN slow query", "ERROR connection reset"}
+	for _, data := range raw {
+		if err := src.Push(ctx, entity.LogRecord{RawData: []byte(data), IngestedAt: time.Now()}); err != nil {
+			t.Fatalf("cannot push record: %v", err)
+		}
+	}
+
+	query := func(node querier.QueryNode) []entity.LogRecord {
+		t.Helper()
+
+		resp, err := memory.Query(ctx, querier.QueryRequest{Query: querier.Query{
+			Node:  node,
+			Start: pipelineTime,
+			End:   pipelineTime.Add(time.Second),
+			Limit: 100,
+		}})
+		if err != nil {
+			t.Fatalf("cannot query: %v", err)
+		}
+		return resp.Records
+	}
+
+	// Records are stored asynchronously, once they're processed and flushed.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(query(nil)) < len(raw) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d stored records, want %d", len(query(nil)), len(raw))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	records := query(querier.ComparisonNode{FieldName: "level", Operator: querier.OperatorEq, Value: "error"})
+
+	var messages []string
+	for _, r := range records {
+		if r.Source != "api" {
+			t.Errorf("got source %q, want %q", r.Source, "api")
+		}
+		messages = append(messages, r.Message)
+	}
+	slices.Sort(messages)
+
+	if want := []string{"connection reset", "disk full"}; !slices.Equal(messages, want) {
+		t.Errorf("got messages %v, want %v", messages, want)
+	}
+}
+
+// failingConnectStorage is a fakeStorage whose Connect fails with err.
+type failingConnectStorage struct {
+	fakeStorage
+	err error
+}
+
+func (f *failingConnectStorage) Connect(context.Context) error { return f.err }
+
+// countingSource counts the times it's started.
+type countingSource struct {
+	idleSource
+	starts atomic.Int32
+}
+
+func (s *countingSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	s.starts.Add(1)
+	return s.idleSource.Provide(ctx, logChan)
+}
+
+func TestEngineRunFailsToConnect(t *testing.T) {
+	errConnect := errors.New("connection refused")
+	src := &countingSource{}
+
+	e, err := New(Config{
+		Sources:                    []LogSource{src},
+		Storage:                    &failingConnectStorage{err: errConnect},
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	err = e.Run(context.Background())
+	if !errors.Is(err, errConnect) {
+		t.Fatalf("got error %v, want %v", err, errConnect)
+	}
+	if !strings.Contains(err.Error(), "cannot establish a connection to the storage") {
+		t.Errorf("got error %q, want it wrapped", err)
+	}
+
+	if got := src.starts.Load(); got != 0 {
+		t.Errorf("got source started %d times, want it never started", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := e.WaitConnected(ctx); err == nil {
+		t.Error("got engine connected, want it never connected")
+	}
+}
+
+// burstSource provides n logs at once when started, then returns.
+type burstSource struct {
+	n int
+}
+
+func (burstSource) Name() string { return "burst" }
+
+func (burstSource) ProcessorNames() []string { return []string{"level_prefix"} }
+
+func (s burstSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	for i := range s.n {
+		select {
+		case logChan <- entity.LogRecord{Source: "burst", RawData: fmt.Appendf(nil, "INFO log %d", i)}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestEngineProcessesBurstOnStart(t *testing.T) {
+	storage := &fakeStorage{}
+
+	// The burst is far larger than the raw logs buffer of the engine.
+	startTestEngine(t, storage, burstSource{n: 500})
+	waitStored(t, storage, 500)
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, l := range storage.processed {
+		if l.Level != entity.LogLevelInfo || !strings.HasPrefix(l.Message, "log ") {
+			t.Fatalf("got level %v and message %q, want the log processed", l.Level, l.Message)
+		}
+	}
+}
+
+func TestProcessorManagerSignalsReady(t *testing.T) {
+	for _, partition := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partition %v", partition), func(t *testing.T) {
+			pm := newProcessorManager(discardLogger(), nil, nil, 3, partition, ProcessorBreakerConfig{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ready := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				pm.run(ctx, make(chan entity.LogRecord), make(chan entity.LogRecord), ready)
+			}()
+
+			select {
+			case <-ready:
+			case <-time.After(5 * time.Second):
+				t.Fatal("got no signal, want one once workers are running")
+			}
+			cancel()
+			<-done
+		})
+	}
+}
@@ -2,8 +2,14 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/thisisjab/logzilla/entity"
@@ -15,16 +21,29 @@ type LogProcessor interface {
 	Process(logRecord entity.LogRecord) (entity.LogRecord, error)
 }
 
+// ErrDropRecord is returned by processors to drop the record (e.g. when sampling), so it's neither processed further
+// nor stored. Unlike other errors, it's not a processing failure.
+var ErrDropRecord = errors.New("drop record")
+
 // processorManager provides multiple workers (fan-out pattern) that process incoming logs (raw logs actually).
 type processorManager struct {
+	// mu guards sources and processors, which are replaced on reload.
+	mu           sync.RWMutex
 	sources      map[string]LogSource
 	processors   map[string]LogProcessor
 	logger       *slog.Logger
 	workersCount uint
 	wg           sync.WaitGroup
+
+	// partitionBySource makes all records of a source be processed by the same worker, preserving their order.
+	partitionBySource bool
+
+	breakerCfg ProcessorBreakerConfig
+	// breakers holds a circuit breaker per processor if breakers are enabled. It's guarded by mu.
+	breakers map[string]*circuitBreaker
 }
 
-func newProcessorManager(logger *slog.Logger, sources []LogSource, processors []LogProcessor, workersCount uint) *processorManager {
+func newProcessorManager(logger *slog.Logger, sources []LogSource, processors []LogProcessor, workersCount uint, partitionBySource bool, breakerCfg ProcessorBreakerConfig) *processorManager {
 	s := make(map[string]LogSource)
 	p := make(map[string]LogProcessor)
 
@@ -36,27 +55,70 @@ func newProcessorManager(logger *slog.Logger, sources []LogSource, processors []
 	}
 
 	return &processorManager{
-		sources:      s,
-		processors:   p,
-		logger:       logger,
-		workersCount: workersCount,
+		sources:           s,
+		processors:        p,
+		logger:            logger,
+		workersCount:      workersCount,
+		partitionBySource: partitionBySource,
+		breakerCfg:        breakerCfg,
+		breakers:          newCircuitBreakers(processors, breakerCfg),
+	}
+}
+
+func newCircuitBreakers(processors []LogProcessor, cfg ProcessorBreakerConfig) map[string]*circuitBreaker {
+	breakers := make(map[string]*circuitBreaker)
+	if !cfg.enabled() {
+		return breakers
+	}
+
+	for _, processor := range processors {
+		breakers[processor.Name()] = newCircuitBreaker(cfg)
+		processorBreakerOpen.WithLabelValues(processor.Name()).Set(0)
+	}
+
+	return breakers
+}
+
+// update replaces processors and adds or replaces sources.
+// Removed sources are kept, so their records which are still buffered get processed.
+func (pm *processorManager) update(sources []LogSource, processors []LogProcessor) {
+	p := make(map[string]LogProcessor)
+	for _, processor := range processors {
+		p[processor.Name()] = processor
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, source := range sources {
+		pm.sources[source.Name()] = source
 	}
+	pm.processors = p
+	pm.breakers = newCircuitBreakers(processors, pm.breakerCfg)
 }
 
 // run reads raw logs and processes the log, then pushes the processed log back to results channel to be further processed (stored).
-func (pm *processorManager) run(ctx context.Context, rawLogsChan <-chan entity.LogRecord, results chan<- entity.LogRecord) {
-	spawnWorker := func(workerId int) {
+// ready is closed once all workers are running.
+func (pm *processorManager) run(ctx context.Context, rawLogsChan <-chan entity.LogRecord, results chan<- entity.LogRecord, ready chan<- struct{}) {
+	var running sync.WaitGroup
+
+	spawnWorker := func(workerId int, jobs <-chan entity.LogRecord) {
+		running.Done()
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case j, ok := <-rawLogsChan:
+			case j, ok := <-jobs:
 				if !ok {
 					// The jobs channel is closed and empty. No more work.
 					return
 				}
 				// Process and send to results
-				processed := pm.processLog(j)
+				processed, ok := pm.processLog(j)
+				if !ok {
+					continue
+				}
 				processed.ID = uuid.New()
 
 				pm.logger.Debug("processed log", "worker_id", workerId, "log_id", processed.ID)
@@ -71,21 +133,87 @@ func (pm *processorManager) run(ctx context.Context, rawLogsChan <-chan entity.L
 		}
 	}
 
-	for i := 0; i < int(pm.workersCount); i++ {
+	if !pm.partitionBySource {
+		running.Add(int(pm.workersCount))
+		for i := 0; i < int(pm.workersCount); i++ {
+			pm.wg.Go(func() {
+				spawnWorker(i, rawLogsChan)
+			})
+		}
+
+		running.Wait()
+		close(ready)
+
+		pm.wg.Wait()
+		return
+	}
+
+	// Each worker gets its own partition, and records are dispatched to partitions based on their source.
+	partitions := make([]chan entity.LogRecord, pm.workersCount)
+	running.Add(len(partitions) + 1)
+	for i := range partitions {
+		partitions[i] = make(chan entity.LogRecord)
 		pm.wg.Go(func() {
-			spawnWorker(i)
+			spawnWorker(i, partitions[i])
 		})
 	}
 
+	pm.wg.Go(func() {
+		running.Done()
+
+		defer func() {
+			for _, p := range partitions {
+				close(p)
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case j, ok := <-rawLogsChan:
+				if !ok {
+					return
+				}
+
+				select {
+				case partitions[partitionOf(j.Source, len(partitions))] <- j:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	})
+
+	running.Wait()
+	close(ready)
+
 	pm.wg.Wait()
 }
 
+// partitionOf returns the partition index for the given source.
+func partitionOf(source string, partitionsCount int) int {
+	h := fnv.New32a()
+	h.Write([]byte(source)) //nolint:errcheck
+	return int(h.Sum32() % uint32(partitionsCount))
+}
+
 // processLog is the actual function that processes a raw log based on it's source and corresponding processors.
-func (pm *processorManager) processLog(rawLog entity.LogRecord) entity.LogRecord {
+// The second return value is false if a processor dropped the log.
+func (pm *processorManager) processLog(rawLog entity.LogRecord) (entity.LogRecord, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
 	src, ok := pm.sources[rawLog.Source]
+	if !ok {
+		// Sources providing multiple streams (e.g. file sources tailing a pattern) tag records with `<source>/<stream>`.
+		if i := strings.LastIndex(rawLog.Source, "/"); i != -1 {
+			src, ok = pm.sources[rawLog.Source[:i]]
+		}
+	}
 	if !ok {
 		pm.logger.Error("source not found", "source", rawLog.Source)
-		return rawLog
+		return rawLog, true
 	}
 
 	for _, pName := range src.ProcessorNames() {
@@ -95,7 +223,26 @@ func (pm *processorManager) processLog(rawLog entity.LogRecord) entity.LogRecord
 			continue
 		}
 
-		processedLog, err := p.Process(rawLog)
+		breaker := pm.breakers[pName]
+		if breaker != nil && !breaker.allow(time.Now()) {
+			skippedProcessorLogs.WithLabelValues(pName).Inc()
+			continue
+		}
+
+		processedLog, err := pm.safeProcess(p, rawLog)
+		dropped := errors.Is(err, ErrDropRecord)
+
+		if breaker != nil {
+			if state, changed := breaker.record(time.Now(), err != nil && !dropped); changed {
+				pm.logBreakerTransition(pName, state)
+			}
+		}
+
+		if dropped {
+			droppedProcessorLogs.WithLabelValues(pName).Inc()
+			return entity.LogRecord{}, false
+		}
+
 		if err != nil {
 			pm.logger.Error("failed to process log", "processor", pName, "error", err)
 			continue
@@ -104,5 +251,30 @@ func (pm *processorManager) processLog(rawLog entity.LogRecord) entity.LogRecord
 		rawLog = processedLog
 	}
 
-	return rawLog
+	return rawLog, true
+}
+
+// safeProcess processes the log, turning panics of the processor (e.g. a nil map write) into errors, so the log
+// fails the processor like it returned an error, instead of crashing the engine.
+func (pm *processorManager) safeProcess(p LogProcessor, rawLog entity.LogRecord) (processed entity.LogRecord, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			processorPanics.WithLabelValues(p.Name()).Inc()
+			pm.logger.Error("processor panicked", "processor", p.Name(), "source", rawLog.Source, "raw_data", string(rawLog.RawData), "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("processor panicked: %v", r)
+		}
+	}()
+
+	return p.Process(rawLog)
+}
+
+func (pm *processorManager) logBreakerTransition(processor string, state breakerState) {
+	switch state {
+	case breakerOpen:
+		processorBreakerOpen.WithLabelValues(processor).Set(1)
+		pm.logger.Warn("processor circuit breaker opened. skipping processor.", "processor", processor, "open_duration", pm.breakerCfg.OpenDuration)
+	case breakerClosed:
+		processorBreakerOpen.WithLabelValues(processor).Set(0)
+		pm.logger.Info("processor circuit breaker closed.", "processor", processor)
+	}
 }
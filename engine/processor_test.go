@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// jitterProcessor takes a different time to process records, depending on their message.
+type jitterProcessor struct{}
+
+func (jitterProcessor) Name() string { return "jitter" }
+
+func (jitterProcessor) Process(r entity.LogRecord) (entity.LogRecord, error) {
+	n, _ := strconv.Atoi(r.Message)
+	time.Sleep(time.Duration(n%4) * 100 * time.Microsecond)
+	return r, nil
+}
+
+func TestProcessorManagerPartitionBySourceKeepsOrder(t *testing.T) {
+	sources := []LogSource{
+		fakeSource{name: "api", processors: []string{"jitter"}},
+		fakeSource{name: "worker", processors: []string{"jitter"}},
+	}
+	pm := newProcessorManager(discardLogger(), sources, []LogProcessor{jitterProcessor{}}, 4, true, ProcessorBreakerConfig{})
+
+	const n = 200
+	rawLogs := make(chan entity.LogRecord, 2*n)
+	for i := range n {
+		rawLogs <- entity.LogRecord{Source: "api", Message: strconv.Itoa(i)}
+		rawLogs <- entity.LogRecord{Source: "worker", Message: strconv.Itoa(i)}
+	}
+	close(rawLogs)
+
+	results := make(chan entity.LogRecord, 2*n)
+	pm.run(context.Background(), rawLogs, results, make(chan struct{}))
+	close(results)
+
+	next := map[string]int{}
+	for r := range results {
+		if want := strconv.Itoa(next[r.Source]); r.Message != want {
+			t.Fatalf("got record %s of %s, want record %s", r.Message, r.Source, want)
+		}
+		next[r.Source]++
+	}
+
+	for _, source := range []string{"api", "worker"} {
+		if next[source] != n {
+			t.Errorf("got %d records of %s, want %d", next[source], source, n)
+		}
+	}
+}
+
+func TestPartitionOfIsStable(t *testing.T) {
+	for i := range 10 {
+		source := fmt.Sprintf("source-%d", i)
+		p := partitionOf(source, 4)
+		if p < 0 || p >= 4 {
+			t.Fatalf("got partition %d of %s, want one of 4", p, source)
+		}
+		if got := partitionOf(source, 4); got != p {
+			t.Errorf("got partitions %d and %d of %s, want the same one", p, got, source)
+		}
+	}
+}
+
+// panickingProcessor panics on records whose raw data is `boom`, and sets the message of other records.
+type panickingProcessor struct{}
+
+func (panickingProcessor) Name() string { return "panicking" }
+
+func (panickingProcessor) Process(r entity.LogRecord) (entity.LogRecord, error) {
+	if string(r.RawData) == "boom" {
+		var metadata map[string]any
+		metadata["boom"] = true
+	}
+	r.Message = "processed " + string(r.RawData)
+	return r, nil
+}
+
+func TestProcessorManagerRecoversFromPanics(t *testing.T) {
+	sources := []LogSource{fakeSource{name: "api", processors: []string{"panicking"}}}
+	pm := newProcessorManager(discardLogger(), sources, []LogProcessor{panickingProcessor{}}, 1, false, ProcessorBreakerConfig{})
+
+	rawLogs := make(chan entity.LogRecord, 3)
+	for _, data := range []string{"first", "boom", "last"} {
+		rawLogs <- entity.LogRecord{Source: "api", RawData: []byte(data)}
+	}
+	close(rawLogs)
+
+	results := make(chan entity.LogRecord, 3)
+	pm.run(context.Background(), rawLogs, results, make(chan struct{}))
+	close(results)
+
+	// The record the processor panicked on fails the processor, and is kept unprocessed.
+	var got []string
+	for r := range results {
+		got = append(got, r.Message)
+	}
+	if want := []string{"processed first", "", "processed last"}; !slices.Equal(got, want) {
+		t.Errorf("got messages %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// ReloadConfig holds the parts of Config which can be changed while the engine is running.
+type ReloadConfig struct {
+	Sources                    []LogSource
+	Processors                 []LogProcessor
+	SourceBackpressurePolicies map[string]BackpressurePolicy
+
+	// RestartSources lists running sources which must be restarted to apply their new definition.
+	// Other running sources keep running, but changes to their processors are still applied.
+	RestartSources []string
+}
+
+func (c ReloadConfig) validate() error {
+	if len(c.Sources) == 0 {
+		return errors.New("no log sources are configured")
+	}
+
+	for name, policy := range c.SourceBackpressurePolicies {
+		if !policy.isValid() {
+			return fmt.Errorf("invalid backpressure policy `%s` for source `%s`", policy, name)
+		}
+	}
+
+	return nil
+}
+
+// runningSource keeps track of a started source, so it can be stopped individually.
+type runningSource struct {
+	cancel context.CancelFunc
+	// done is closed once the source has stopped and all its logs are forwarded.
+	done chan struct{}
+}
+
+func (r *runningSource) stopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reload applies cfg to the running engine without interrupting other components.
+// Processors are swapped, removed sources are stopped, and new sources (or those in cfg.RestartSources) are started.
+// Sources which have stopped on their own (e.g. due to an error) are started again.
+func (e *Engine) Reload(cfg ReloadConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.runCtx == nil || e.runCtx.Err() != nil {
+		return errors.New("engine is not running")
+	}
+
+	e.pm.update(cfg.Sources, cfg.Processors)
+	e.cfg.Processors = cfg.Processors
+	e.cfg.SourceBackpressurePolicies = cfg.SourceBackpressurePolicies
+
+	for name, rs := range e.runningSources {
+		keep := slices.ContainsFunc(cfg.Sources, func(s LogSource) bool { return s.Name() == name })
+		if keep && !rs.stopped() && !slices.Contains(cfg.RestartSources, name) {
+			continue
+		}
+
+		rs.cancel()
+		<-rs.done
+		delete(e.runningSources, name)
+		e.logger.Info("stopped log source.", "name", name)
+	}
+
+	for _, s := range cfg.Sources {
+		if _, ok := e.runningSources[s.Name()]; ok {
+			continue
+		}
+
+		e.startSource(s)
+		e.logger.Info("started log source.", "name", s.Name())
+	}
+
+	e.cfg.Sources = cfg.Sources
+
+	return nil
+}
+
+// startSource spawns the source, which writes into its own channel. Logs are forwarded into rawLogs based on the
+// source's backpressure policy. e.mu must be held.
+func (e *Engine) startSource(s LogSource) {
+	policy, ok := e.cfg.SourceBackpressurePolicies[s.Name()]
+	if !ok {
+		policy = BackpressureBlock
+	}
+
+	runCtx, rawLogs := e.runCtx, e.rawLogs
+	ctx, cancel := context.WithCancel(runCtx)
+	rs := &runningSource{cancel: cancel, done: make(chan struct{})}
+	e.runningSources[s.Name()] = rs
+
+	sourceLogs := make(chan entity.LogRecord)
+
+	e.sourcesWg.Add(2)
+	go func(src LogSource) {
+		defer e.sourcesWg.Done()
+		defer close(sourceLogs)
+		e.provide(ctx, src, sourceLogs)
+	}(s)
+
+	// Logs are forwarded using the engine's context, so logs provided before a source is stopped are not lost.
+	go func(name string) {
+		defer e.sourcesWg.Done()
+		defer close(rs.done)
+		defer cancel()
+		for l := range sourceLogs {
+			forwardLog(runCtx, policy, rawLogs, name, l)
+		}
+	}(s.Name())
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// lifecycleSource provides a single log once started, then signals when it's stopped.
+type lifecycleSource struct {
+	name    string
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func newLifecycleSource(name string) *lifecycleSource {
+	return &lifecycleSource{name: name, started: make(chan struct{}, 10), stopped: make(chan struct{}, 10)}
+}
+
+func (s *lifecycleSource) Name() string { return s.name }
+
+func (s *lifecycleSource) ProcessorNames() []string { return []string{"level_prefix"} }
+
+func (s *lifecycleSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	s.started <- struct{}{}
+	defer func() { s.stopped <- struct{}{} }()
+
+	select {
+	case logChan <- entity.LogRecord{Source: s.name, RawData: []byte("INFO hello from " + s.name)}:
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// waitSignal fails the test unless a signal is received from c in time.
+func waitSignal(t *testing.T, c <-chan struct{}, what string) {
+	t.Helper()
+
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("got no signal, want the source %s", what)
+	}
+}
+
+// startTestEngine runs an engine with the given sources storing into storage, until the test ends.
+func startTestEngine(t *testing.T, storage Storage, sources ...LogSource) *Engine {
+	t.Helper()
+
+	e, err := New(Config{
+		Sources:                    sources,
+		Processors:                 []LogProcessor{levelPrefixProcessor{}},
+		Storage:                    storage,
+		StorageFlushInterval:       10 * time.Millisecond,
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if err := e.WaitConnected(ctx); err != nil {
+		t.Fatalf("cannot wait for the engine to connect: %v", err)
+	}
+	return e
+}
+
+// waitStored waits until storage holds n processed logs, failing the test if it takes too long.
+func waitStored(t *testing.T, storage *fakeStorage, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		processed, _ := storage.counts()
+		if processed >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d stored logs, want %d", processed, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEngineReloadSources(t *testing.T) {
+	storage := &fakeStorage{}
+	kept, removed, added := newLifecycleSource("kept"), newLifecycleSource("removed"), newLifecycleSource("added")
+
+	e := startTestEngine(t, storage, kept, removed)
+	waitSignal(t, kept.started, "kept started")
+	waitSignal(t, removed.started, "removed started")
+
+	if err := e.Reload(ReloadConfig{Sources: []LogSource{kept, added}, Processors: []LogProcessor{levelPrefixProcessor{}}}); err != nil {
+		t.Fatalf("cannot reload: %v", err)
+	}
+
+	waitSignal(t, removed.stopped, "removed stopped")
+	waitSignal(t, added.started, "added started")
+
+	// Logs of the new source are processed like the others.
+	waitStored(t, storage, 3)
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	for _, l := range storage.processed {
+		if want := "hello from " + l.Source; l.Message != want || l.Level != entity.LogLevelInfo {
+			t.Errorf("got log %q (level %v) of %s, want %q", l.Message, l.Level, l.Source, want)
+		}
+	}
+
+	// Sources which are kept keep running.
+	select {
+	case <-kept.stopped:
+		t.Error("got the kept source stopped, want it kept running")
+	case <-kept.started:
+		t.Error("got the kept source started again, want it kept running")
+	default:
+	}
+}
+
+func TestEngineReloadRestartsSources(t *testing.T) {
+	src := newLifecycleSource("api")
+
+	e := startTestEngine(t, &fakeStorage{}, src)
+	waitSignal(t, src.started, "started")
+
+	if err := e.Reload(ReloadConfig{Sources: []LogSource{src}, RestartSources: []string{"api"}}); err != nil {
+		t.Fatalf("cannot reload: %v", err)
+	}
+
+	waitSignal(t, src.stopped, "stopped")
+	waitSignal(t, src.started, "started again")
+}
+
+func TestEngineReloadNotRunning(t *testing.T) {
+	e, err := New(Config{
+		Sources:                    []LogSource{idleSource{}},
+		Storage:                    &fakeStorage{},
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	if err := e.Reload(ReloadConfig{Sources: []LogSource{idleSource{}}}); err == nil {
+		t.Error("got no error, want one for an engine which isn't running")
+	}
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+const defaultReplayBatchSize = 1000
+
+// RawLogsReader is an optional interface for storages that can read back stored raw logs. It's required by Replay.
+type RawLogsReader interface {
+	// ReadRawLogs calls fn with each raw log stored within [start, end), in chronological order, until fn fails or ctx
+	// is done.
+	ReadRawLogs(ctx context.Context, start, end time.Time, fn func(entity.LogRecord) error) error
+}
+
+// ReplayConfig configures re-processing stored raw logs through the configured processors.
+type ReplayConfig struct {
+	// Start and End define the time window of replayed raw logs. End is exclusive.
+	Start time.Time
+	End   time.Time
+
+	// Target optionally stores the replayed logs in another storage. Defaults to the configured storage.
+	Target Storage
+
+	// BatchSize is the number of replayed logs stored at once. Defaults to 1000.
+	BatchSize uint
+
+	// Timeout optionally limits how long the replay may take. Logs stored until then are kept. Zero means no limit.
+	Timeout time.Duration
+}
+
+func (c *ReplayConfig) setDefaults() {
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultReplayBatchSize
+	}
+}
+
+func (c ReplayConfig) validate() error {
+	if c.Start.IsZero() || c.End.IsZero() {
+		return errors.New("replay start and end are required")
+	}
+
+	if !c.Start.Before(c.End) {
+		return errors.New("replay start must be before end")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("replay timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// Replay reads raw logs within the time window from the storage, processes them with the processors of their source,
+// and stores them as new processed logs. The engine must not be running. It returns the number of replayed logs.
+func (e *Engine) Replay(ctx context.Context, cfg ReplayConfig) (uint, error) {
+	cfg.setDefaults()
+
+	if err := cfg.validate(); err != nil {
+		return 0, err
+	}
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	reader, ok := e.cfg.Storage.(RawLogsReader)
+	if !ok {
+		return 0, errors.New("storage does not support reading raw logs")
+	}
+
+	if err := e.cfg.Storage.Connect(ctx); err != nil {
+		return 0, fmt.Errorf("cannot establish a connection to the storage: %w", err)
+	}
+	defer e.cfg.Storage.Close(ctx) //nolint:errcheck
+
+	target := e.cfg.Storage
+	if cfg.Target != nil {
+		target = cfg.Target
+		if err := target.Connect(ctx); err != nil {
+			return 0, fmt.Errorf("cannot establish a connection to the replay target: %w", err)
+		}
+		defer target.Close(ctx) //nolint:errcheck
+	}
+
+	pm := newProcessorManager(e.logger, e.cfg.Sources, e.cfg.Processors, 1, false, e.cfg.ProcessorBreaker)
+
+	var replayed uint
+	batch := make([]entity.LogRecord, 0, cfg.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := target.StoreProcessedLogs(ctx, batch...); err != nil {
+			return fmt.Errorf("cannot store replayed logs: %w", err)
+		}
+
+		replayed += uint(len(batch))
+		e.logger.Debug("stored replayed logs", "count", len(batch), "total", replayed)
+		batch = batch[:0]
+
+		return nil
+	}
+
+	err := reader.ReadRawLogs(ctx, cfg.Start, cfg.End, func(raw entity.LogRecord) error {
+		processed, ok := pm.processLog(raw)
+		if !ok {
+			return nil
+		}
+		processed.ID = uuid.New()
+		processed = limitMetadataSize(processed, e.cfg.MaxMetadataBytes)
+		batch = append(batch, processed)
+
+		if uint(len(batch)) < cfg.BatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return replayed, fmt.Errorf("cannot replay raw logs: %w", err)
+	}
+
+	if err := flush(); err != nil {
+		return replayed, err
+	}
+
+	return replayed, nil
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// rawLogsStorage is a fakeStorage reading back its raw logs within the requested window.
+type rawLogsStorage struct {
+	fakeStorage
+}
+
+func (s *rawLogsStorage) ReadRawLogs(ctx context.Context, start, end time.Time, fn func(entity.LogRecord) error) error {
+	for _, raw := range s.raw {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if raw.Timestamp.Before(start) || !raw.Timestamp.Before(end) {
+			continue
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestReplayEngine(t *testing.T, storage Storage) *Engine {
+	t.Helper()
+
+	e, err := New(Config{
+		Sources:                    []LogSource{fakeSource{name: "api", processors: []string{"level_prefix"}}},
+		Processors:                 []LogProcessor{levelPrefixProcessor{}},
+		Storage:                    storage,
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+	return e
+}
+
+func TestEngineReplay(t *testing.T) {
+	storage := &rawLogsStorage{}
+	for i, raw := range []string{"INFO started", "WARN slow", "ERROR boom", "INFO stopped"} {
+		storage.raw = append(storage.raw, entity.LogRecord{ID: uuid.New(), Source: "api", RawData: []byte(raw),
+			Timestamp: pipelineTime.Add(time.Duration(i) * time.Minute)})
+	}
+
+	e := newTestReplayEngine(t, storage)
+
+	// The log at the end of the window isn't replayed.
+	n, err := e.Replay(context.Background(), ReplayConfig{Start: pipelineTime, End: pipelineTime.Add(3 * time.Minute), BatchSize: 2})
+	if err != nil {
+		t.Fatalf("cannot replay: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("got %d replayed logs, want 3", n)
+	}
+
+	var messages []string
+	for i, processed := range storage.processed {
+		messages = append(messages, processed.Level.String()+" "+processed.Message)
+		if processed.ID == storage.raw[i].ID {
+			t.Errorf("got replayed log %d stored with the id of its raw log, want a new one", i)
+		}
+	}
+	if want := []string{"INFO started", "WARN slow", "ERROR boom"}; !slices.Equal(messages, want) {
+		t.Errorf("got replayed logs %v, want %v", messages, want)
+	}
+}
+
+func TestEngineReplayToTarget(t *testing.T) {
+	storage := &rawLogsStorage{}
+	storage.raw = []entity.LogRecord{{ID: uuid.New(), Source: "api", RawData: []byte("ERROR boom"), Timestamp: pipelineTime}}
+	target := &fakeStorage{}
+
+	e := newTestReplayEngine(t, storage)
+	if _, err := e.Replay(context.Background(), ReplayConfig{Start: pipelineTime, End: pipelineTime.Add(time.Minute), Target: target}); err != nil {
+		t.Fatalf("cannot replay: %v", err)
+	}
+
+	if processed, _ := storage.counts(); processed != 0 {
+		t.Errorf("got %d logs stored in the replayed storage, want none", processed)
+	}
+	if processed, _ := target.counts(); processed != 1 {
+		t.Errorf("got %d logs stored in the target, want 1", processed)
+	}
+}
+
+func TestEngineReplayErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage Storage
+		cfg     ReplayConfig
+		ctx     func() context.Context
+		wantErr error
+	}{
+		{
+			name:    "storage without raw logs",
+			storage: &fakeStorage{},
+			cfg:     ReplayConfig{Start: pipelineTime, End: pipelineTime.Add(time.Minute)},
+		},
+		{
+			name:    "empty window",
+			storage: &rawLogsStorage{},
+			cfg:     ReplayConfig{Start: pipelineTime, End: pipelineTime},
+		},
+		{
+			name:    "negative timeout",
+			storage: &rawLogsStorage{},
+			cfg:     ReplayConfig{Start: pipelineTime, End: pipelineTime.Add(time.Minute), Timeout: -time.Second},
+		},
+		{
+			name: "done context",
+			storage: &rawLogsStorage{fakeStorage{raw: []entity.LogRecord{
+				{ID: uuid.New(), Source: "api", RawData: []byte("INFO started"), Timestamp: pipelineTime},
+			}}},
+			cfg: ReplayConfig{Start: pipelineTime, End: pipelineTime.Add(time.Minute)},
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+
+			_, err := newTestReplayEngine(t, tt.storage).Replay(ctx, tt.cfg)
+			if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want one", err)
+			}
+		})
+	}
+}
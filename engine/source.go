@@ -2,6 +2,8 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/thisisjab/logzilla/entity"
 )
@@ -12,3 +14,69 @@ type LogSource interface {
 	Provide(ctx context.Context, logChan chan<- entity.LogRecord) error
 	ProcessorNames() []string
 }
+
+const (
+	defaultSourceRestartInitialBackoff = 1 * time.Second
+	defaultSourceRestartMaxBackoff     = 1 * time.Minute
+)
+
+// SourceRestartConfig configures restarting sources whose Provide returns an error (e.g. after losing a connection).
+// Sources are restarted with exponential backoff until the engine stops. Sources returning no error are not restarted.
+type SourceRestartConfig struct {
+	// InitialBackoff is the delay before the first restart. It's doubled after each failed restart. Defaults to 1s.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between restarts. Sources which ran for longer than MaxBackoff before failing start
+	// over from InitialBackoff. Defaults to 1m.
+	MaxBackoff time.Duration
+}
+
+func (c *SourceRestartConfig) setDefaults() {
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultSourceRestartInitialBackoff
+	}
+
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultSourceRestartMaxBackoff
+	}
+}
+
+func (c SourceRestartConfig) validate() error {
+	if c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return errors.New("source restart backoff cannot be negative")
+	}
+
+	return nil
+}
+
+// provide runs the source until ctx is done, restarting it whenever it fails.
+func (e *Engine) provide(ctx context.Context, src LogSource, logChan chan<- entity.LogRecord) {
+	cfg := e.cfg.SourceRestart
+	backoff := cfg.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		err := src.Provide(ctx, logChan)
+		if err == nil || ctx.Err() != nil {
+			if err != nil {
+				e.logger.Error("log source failed.", "name", src.Name(), "error", err)
+			}
+			return
+		}
+
+		if time.Since(started) >= cfg.MaxBackoff {
+			backoff = cfg.InitialBackoff
+			attempt = 1
+		}
+
+		e.logger.Error("log source failed. restarting.", "name", src.Name(), "error", err, "attempt", attempt, "backoff", backoff)
+		sourceRestarts.WithLabelValues(src.Name()).Inc()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, cfg.MaxBackoff)
+	}
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+var errSourceDisconnected = errors.New("connection lost")
+
+// flakySource fails its first failures calls to Provide, then provides a single log until ctx is done.
+// If failures is negative, it returns right away without an error.
+type flakySource struct {
+	failures int
+
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (s *flakySource) Name() string { return "flaky" }
+
+func (s *flakySource) ProcessorNames() []string { return nil }
+
+func (s *flakySource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	s.mu.Lock()
+	s.calls = append(s.calls, time.Now())
+	attempt := len(s.calls)
+	s.mu.Unlock()
+
+	if s.failures < 0 {
+		return nil
+	}
+	if attempt <= s.failures {
+		return errSourceDisconnected
+	}
+
+	select {
+	case logChan <- entity.LogRecord{Source: s.Name(), Message: "reconnected"}:
+	case <-ctx.Done():
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (s *flakySource) callTimes() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls
+}
+
+func newTestSourceEngine(t *testing.T, src LogSource, cfg SourceRestartConfig) *Engine {
+	t.Helper()
+
+	e, err := New(Config{
+		Sources:                    []LogSource{src},
+		Storage:                    &fakeStorage{},
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+		SourceRestart:              cfg,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+	return e
+}
+
+func TestEngineRestartsFailedSourceWithBackoff(t *testing.T) {
+	src := &flakySource{failures: 2}
+	backoff := 20 * time.Millisecond
+	e := newTestSourceEngine(t, src, SourceRestartConfig{InitialBackoff: backoff, MaxBackoff: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logChan := make(chan entity.LogRecord, 1)
+	done := make(chan struct{})
+	go func() {
+		e.provide(ctx, src, logChan)
+		close(done)
+	}()
+
+	select {
+	case l := <-logChan:
+		if l.Message != "reconnected" {
+			t.Errorf("got log %q, want the log of the restarted source", l.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no log, want the source restarted")
+	}
+
+	cancel()
+	<-done
+
+	calls := src.callTimes()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+
+	// The backoff doubles after each failed restart.
+	for i, want := range []time.Duration{backoff, 2 * backoff} {
+		if got := calls[i+1].Sub(calls[i]); got < want {
+			t.Errorf("got restart %d after %v, want it after %v at least", i+1, got, want)
+		}
+	}
+}
+
+func TestEngineDoesNotRestartSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    *flakySource
+		cancel bool
+	}{
+		{name: "source returning without an error", src: &flakySource{failures: -1}},
+		{name: "source failing once the engine stops", src: &flakySource{failures: 100}, cancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestSourceEngine(t, tt.src, SourceRestartConfig{InitialBackoff: time.Millisecond})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			done := make(chan struct{})
+			go func() {
+				e.provide(ctx, tt.src, make(chan entity.LogRecord, 1))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("got the source restarted, want it stopped")
+			}
+
+			if got := len(tt.src.callTimes()); got != 1 {
+				t.Errorf("got %d calls, want 1", got)
+			}
+		})
+	}
+}
@@ -2,7 +2,11 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,6 +21,18 @@ type Storage interface {
 	Close(ctx context.Context) error
 }
 
+// RawLogsStorer is an optional interface for storages that can keep raw logs, as they were emitted by sources.
+// It's required when storing raw logs is enabled (see RawLogsStorageConfig).
+type RawLogsStorer interface {
+	StoreRawLogs(ctx context.Context, logs ...entity.LogRecord) error
+}
+
+// Flusher is an optional interface for storages that buffer writes by themselves.
+// If the storage implements it, Flush is called on shutdown after all buffered logs are handed to the storage.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
 // storageManager manages storage operations like inserting, buffering, and flushing logs.
 // Note that you should never disable buffering and scheduled flushing together.
 type storageManager struct {
@@ -26,6 +42,28 @@ type storageManager struct {
 	processedMutex  sync.Mutex
 	wg              sync.WaitGroup
 
+	// rawStorage is nil if storing raw logs is disabled.
+	rawStorage RawLogsStorer
+	rawBuffer  []entity.LogRecord
+	rawMutex   sync.Mutex
+	rawCfg     RawLogsStorageConfig
+
+	// dedup is nil if deduplication is disabled.
+	dedup *deduplicator
+
+	// flushSlots limits the number of concurrent flushes. It's nil if flushes are not limited.
+	flushSlots chan struct{}
+
+	// wal is nil if the write-ahead log is disabled. Logs are appended to it while processedMutex is held, so each
+	// generation of the processed buffer is held by a single segment.
+	wal *wal
+	// restoredSegments hold logs put back into the processed buffer after failing to be flushed (see flushNow). They're
+	// handed over along with the next generation of the buffer. Guarded by processedMutex.
+	restoredSegments []string
+
+	// maxMetadataBytes is the maximum size of metadata of processed logs (see limitMetadataSize). Zero means no limit.
+	maxMetadataBytes uint
+
 	// bufferMaxSize defines the maximum items that buffer holds before flushing.
 	// If value is reached, buffer will be flushed immediately.
 	// Setting this to zero will disable buffering.
@@ -36,90 +74,396 @@ type storageManager struct {
 	flushInterval time.Duration
 }
 
-func newStorageManager(logger *slog.Logger, storage Storage, bufferMaxSize uint, flushInterval time.Duration) *storageManager {
-	return &storageManager{
-		logger:          logger,
-		storage:         storage,
-		bufferMaxSize:   bufferMaxSize,
-		processedBuffer: make([]entity.LogRecord, 0, bufferMaxSize),
-		flushInterval:   flushInterval,
+func newStorageManager(logger *slog.Logger, storage Storage, bufferMaxSize uint, flushInterval time.Duration, rawCfg RawLogsStorageConfig, dedupCfg DedupConfig, maxConcurrentFlushes uint, maxMetadataBytes uint) *storageManager {
+	sm := &storageManager{
+		logger:           logger,
+		storage:          storage,
+		bufferMaxSize:    bufferMaxSize,
+		processedBuffer:  make([]entity.LogRecord, 0, bufferMaxSize),
+		flushInterval:    flushInterval,
+		rawCfg:           rawCfg,
+		maxMetadataBytes: maxMetadataBytes,
 	}
+
+	if rawCfg.Enabled {
+		// Config validation makes sure the storage implements RawLogsStorer.
+		sm.rawStorage, _ = storage.(RawLogsStorer)
+		sm.rawBuffer = make([]entity.LogRecord, 0, rawCfg.BufferMaxSize)
+	}
+
+	if dedupCfg.enabled() {
+		sm.dedup = newDeduplicator(dedupCfg)
+	}
+
+	if maxConcurrentFlushes > 0 {
+		sm.flushSlots = make(chan struct{}, maxConcurrentFlushes)
+	}
+
+	return sm
+}
+
+// storesRawLogs reports whether raw logs should be handed to the storage manager.
+func (sm *storageManager) storesRawLogs() bool {
+	return sm.rawStorage != nil
 }
 
 func (sm *storageManager) run(ctx context.Context) {
-	var ticker *time.Ticker
+	var ticker, rawTicker *time.Ticker
 
 	if sm.flushInterval > 0 {
 		ticker = time.NewTicker(sm.flushInterval)
 		defer ticker.Stop()
 	}
 
+	if sm.storesRawLogs() && sm.rawCfg.FlushInterval > 0 {
+		rawTicker = time.NewTicker(sm.rawCfg.FlushInterval)
+		defer rawTicker.Stop()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			sm.flushBuffers(ctx)
+			// ctx is already cancelled at this point, so the final flush must not depend on it.
+			shutdownCtx := context.WithoutCancel(ctx)
+
+			// Segments of logs which fail to be flushed are kept, so they're stored on the next start.
+			sm.flushBuffers(shutdownCtx)
+			sm.flushRawBuffer(shutdownCtx)
 			sm.wg.Wait()
+			sm.flushStorage(shutdownCtx)
 			return
 		// Please don't panic by this syntax. This was new to me as well.
 		// If ticker is nil, reading from it's channel will panic.
 		// So we do this trick that returns a channel that blocks forever if ticker is disabled.
-		case <-func() <-chan time.Time {
-			if ticker != nil {
-				return ticker.C
-			}
-			return make(chan time.Time) // blocks forever if ticker is disabled
-		}():
+		case <-tickerChan(ticker):
 			sm.flushBuffers(ctx)
+		case <-tickerChan(rawTicker):
+			sm.flushRawBuffer(ctx)
 		}
 	}
 }
 
+// tickerChan returns the channel of the ticker, or a channel that blocks forever if ticker is nil.
+func tickerChan(ticker *time.Ticker) <-chan time.Time {
+	if ticker != nil {
+		return ticker.C
+	}
+	return make(chan time.Time)
+}
+
 func (sm *storageManager) flushBuffers(ctx context.Context) {
-	var processedToFlush []entity.LogRecord
+	if processedToFlush, segments := sm.swapProcessedBuffer(); len(processedToFlush) > 0 {
+		sm.flushProcessedLogs(ctx, processedToFlush, segments)
+	}
+}
 
-	// Swap processed buffer
+// swapProcessedBuffer replaces the processed buffer with an empty one, returning the buffered logs along with the
+// write-ahead log segments holding them. There are no segments if the write-ahead log is disabled.
+func (sm *storageManager) swapProcessedBuffer() ([]entity.LogRecord, []string) {
 	sm.processedMutex.Lock()
-	if len(sm.processedBuffer) > 0 {
-		processedToFlush = sm.processedBuffer
-		sm.processedBuffer = make([]entity.LogRecord, 0, sm.bufferMaxSize)
+	defer sm.processedMutex.Unlock()
+
+	if len(sm.processedBuffer) == 0 {
+		return nil, nil
+	}
+
+	return sm.swapProcessedBufferLocked()
+}
+
+// swapProcessedBufferLocked is like swapProcessedBuffer, but processedMutex must be held by the caller.
+func (sm *storageManager) swapProcessedBufferLocked() ([]entity.LogRecord, []string) {
+	segments := sm.restoredSegments
+	sm.restoredSegments = nil
+	if sm.wal != nil {
+		if segment := sm.wal.rotate(); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	buffered := sm.processedBuffer
+	sm.processedBuffer = make([]entity.LogRecord, 0, sm.bufferMaxSize)
+	return buffered, segments
+}
+
+// restoreProcessedBuffer puts logs which failed to be flushed back in front of the processed buffer. Their segments
+// are kept until the logs are flushed along with the buffer.
+func (sm *storageManager) restoreProcessedBuffer(logs []entity.LogRecord, segments []string) {
+	sm.processedMutex.Lock()
+	defer sm.processedMutex.Unlock()
+
+	sm.processedBuffer = append(logs, sm.processedBuffer...)
+	sm.restoredSegments = append(sm.restoredSegments, segments...)
+}
+
+// removeSegments removes write-ahead log segments whose logs are stored.
+func (sm *storageManager) removeSegments(segments []string) {
+	if sm.wal == nil {
+		return
+	}
+
+	for _, segment := range segments {
+		sm.wal.remove(segment)
+	}
+}
+
+// replayWAL stores the logs of write-ahead log segments left by a previous run, if the write-ahead log is enabled.
+func (sm *storageManager) replayWAL(ctx context.Context) error {
+	if sm.wal == nil {
+		return nil
+	}
+
+	n, err := sm.wal.replay(ctx, sm.storage, sm.bufferMaxSize)
+	if err != nil {
+		return fmt.Errorf("cannot replay write-ahead log: %w", err)
+	}
+
+	if n > 0 {
+		sm.logger.Info("stored logs of write-ahead log.", "count", n)
+	}
+
+	return nil
+}
+
+// flushNow stores all buffered raw and processed logs, returning once they're stored. Unlike scheduled flushes, it
+// reports failures to the caller, and logs which fail to be stored are put back into their buffer, so they're flushed
+// again later. It takes a flush slot like scheduled flushes. It returns the number of processed logs flushed.
+func (sm *storageManager) flushNow(ctx context.Context) (int, error) {
+	if sm.flushSlots != nil {
+		select {
+		case sm.flushSlots <- struct{}{}:
+			defer func() { <-sm.flushSlots }()
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	var errs []error
+
+	if raw := sm.swapRawBuffer(); len(raw) > 0 {
+		if err := sm.rawStorage.StoreRawLogs(ctx, raw...); err != nil {
+			sm.restoreRawBuffer(raw)
+			errs = append(errs, fmt.Errorf("failed to flush raw logs: %w", err))
+		}
+	}
+
+	var flushed int
+	if processed, segments := sm.swapProcessedBuffer(); len(processed) > 0 {
+		if err := sm.storage.StoreProcessedLogs(ctx, processed...); err != nil {
+			sm.restoreProcessedBuffer(processed, segments)
+			errs = append(errs, fmt.Errorf("failed to flush processed logs: %w", err))
+		} else {
+			sm.removeSegments(segments)
+			observeLatency(processed)
+			flushed = len(processed)
+		}
+	}
+
+	return flushed, errors.Join(errs...)
+}
+
+// flushStorage forces the storage to flush its own buffers, if it has any.
+func (sm *storageManager) flushStorage(ctx context.Context) {
+	f, ok := sm.storage.(Flusher)
+	if !ok {
+		return
 	}
-	sm.processedMutex.Unlock()
 
-	if len(processedToFlush) > 0 {
-		sm.flushProcessedLogs(ctx, processedToFlush)
+	if err := f.Flush(ctx); err != nil {
+		sm.logger.Error("failed to flush storage", "error", err)
+		return
 	}
+
+	sm.logger.Debug("flushed storage successfully")
 }
 
-func (sm *storageManager) flushProcessedLogs(ctx context.Context, toFlush []entity.LogRecord) {
+// goFlush runs flush in a new goroutine. If the number of concurrent flushes is limited, it blocks until a slot is
+// free, so callers adding logs are held back while the storage is slow.
+func (sm *storageManager) goFlush(flush func()) {
+	if sm.flushSlots == nil {
+		sm.wg.Go(flush)
+		return
+	}
+
+	sm.flushSlots <- struct{}{}
 	sm.wg.Go(func() {
+		defer func() { <-sm.flushSlots }()
+		flush()
+	})
+}
+
+// flushProcessedLogs stores logs in a new goroutine, removing the write-ahead log segments holding them once stored.
+func (sm *storageManager) flushProcessedLogs(ctx context.Context, toFlush []entity.LogRecord, segments []string) {
+	sm.goFlush(func() {
 		if err := sm.storage.StoreProcessedLogs(ctx, toFlush...); err != nil {
 			sm.logger.Error("failed to flush processed logs", "error", err)
 			return
 		}
 
+		sm.removeSegments(segments)
+
+		observeLatency(toFlush)
+
 		sm.logger.Debug("flushed processed logs successfully", "count", len(toFlush))
 	})
 }
 
 func (sm *storageManager) addProcessedLogs(ctx context.Context, logs ...entity.LogRecord) {
+	// Logs are still buffered if they can't be written ahead, they're only lost if the engine crashes.
+	sm.bufferProcessedLogs(ctx, logs, false) //nolint:errcheck
+}
+
+// addProcessedLogsDurably is like addProcessedLogs, but it fails without buffering logs if they can't be written
+// ahead, so callers acknowledging logs (e.g. the API) only do so once the logs survive a crash.
+func (sm *storageManager) addProcessedLogsDurably(ctx context.Context, logs ...entity.LogRecord) error {
+	return sm.bufferProcessedLogs(ctx, logs, true)
+}
+
+// bufferProcessedLogs deduplicates logs, limits their metadata, writes them ahead and buffers them, flushing the
+// buffer once full. If durable is set, logs which can't be written ahead are not buffered and an error is returned.
+func (sm *storageManager) bufferProcessedLogs(ctx context.Context, logs []entity.LogRecord, durable bool) error {
+	if sm.dedup != nil {
+		logs = sm.dedup.filter(time.Now(), logs)
+	}
+
 	if len(logs) == 0 {
-		return
+		return nil
+	}
+
+	deduplicated := logs
+	if sm.maxMetadataBytes > 0 {
+		// Logs are copied, so records of the caller are left unchanged.
+		logs = slices.Clone(logs)
+		for i := range logs {
+			logs[i] = limitMetadataSize(logs[i], sm.maxMetadataBytes)
+		}
 	}
 
 	var toFlush []entity.LogRecord
+	var segments []string
 
 	sm.processedMutex.Lock()
+	if sm.wal != nil {
+		if err := sm.wal.append(logs); err != nil {
+			if durable {
+				sm.processedMutex.Unlock()
+
+				// Logs are forgotten, so they're not dropped as duplicates when the caller tries again.
+				if sm.dedup != nil {
+					sm.dedup.forget(deduplicated)
+				}
+				return fmt.Errorf("cannot write logs ahead: %w", err)
+			}
+
+			walSkippedLogs.Add(float64(len(logs)))
+			sm.logger.Debug("cannot append logs to write-ahead log", "error", err)
+		}
+	}
 	sm.processedBuffer = append(sm.processedBuffer, logs...)
 
 	// Check if buffer reached flush size
 	if sm.bufferMaxSize > 0 && uint(len(sm.processedBuffer)) >= sm.bufferMaxSize {
-		toFlush = sm.processedBuffer
-		sm.processedBuffer = make([]entity.LogRecord, 0, sm.bufferMaxSize)
+		toFlush, segments = sm.swapProcessedBufferLocked()
 	}
 	sm.processedMutex.Unlock()
 
 	// Flush asynchronously if needed
 	if toFlush != nil {
-		sm.flushProcessedLogs(ctx, toFlush)
+		sm.flushProcessedLogs(ctx, toFlush, segments)
+	}
+
+	return nil
+}
+
+func (sm *storageManager) flushRawBuffer(ctx context.Context) {
+	if toFlush := sm.swapRawBuffer(); len(toFlush) > 0 {
+		sm.flushRawLogs(ctx, toFlush)
+	}
+}
+
+// swapRawBuffer replaces the raw buffer with an empty one, returning the buffered logs.
+// It returns nil if storing raw logs is disabled.
+func (sm *storageManager) swapRawBuffer() []entity.LogRecord {
+	if !sm.storesRawLogs() {
+		return nil
+	}
+
+	sm.rawMutex.Lock()
+	defer sm.rawMutex.Unlock()
+
+	if len(sm.rawBuffer) == 0 {
+		return nil
+	}
+
+	buffered := sm.rawBuffer
+	sm.rawBuffer = make([]entity.LogRecord, 0, sm.rawCfg.BufferMaxSize)
+	return buffered
+}
+
+// restoreRawBuffer puts raw logs which failed to be flushed back in front of the raw buffer.
+func (sm *storageManager) restoreRawBuffer(logs []entity.LogRecord) {
+	sm.rawMutex.Lock()
+	defer sm.rawMutex.Unlock()
+
+	sm.rawBuffer = append(logs, sm.rawBuffer...)
+}
+
+func (sm *storageManager) flushRawLogs(ctx context.Context, toFlush []entity.LogRecord) {
+	sm.goFlush(func() {
+		if err := sm.rawStorage.StoreRawLogs(ctx, toFlush...); err != nil {
+			sm.logger.Error("failed to flush raw logs", "error", err)
+			return
+		}
+
+		sm.logger.Debug("flushed raw logs successfully", "count", len(toFlush))
+	})
+}
+
+func (sm *storageManager) addRawLogs(ctx context.Context, logs ...entity.LogRecord) {
+	if len(logs) == 0 || !sm.storesRawLogs() {
+		return
+	}
+
+	var toFlush []entity.LogRecord
+
+	sm.rawMutex.Lock()
+	sm.rawBuffer = append(sm.rawBuffer, logs...)
+
+	if sm.rawCfg.BufferMaxSize > 0 && uint(len(sm.rawBuffer)) >= sm.rawCfg.BufferMaxSize {
+		toFlush = sm.rawBuffer
+		sm.rawBuffer = make([]entity.LogRecord, 0, sm.rawCfg.BufferMaxSize)
+	}
+	sm.rawMutex.Unlock()
+
+	if toFlush != nil {
+		sm.flushRawLogs(ctx, toFlush)
+	}
+}
+
+// limitMetadataSize replaces the metadata of the record by `_truncated` and `_original_size` keys if its JSON encoding
+// is larger than maxBytes, so a malformed payload can't bloat the storage. Zero maxBytes means no limit.
+func limitMetadataSize(record entity.LogRecord, maxBytes uint) entity.LogRecord {
+	if maxBytes == 0 || len(record.Metadata) == 0 {
+		return record
+	}
+
+	// Metadata which can't be encoded is left to the storage to reject.
+	js, err := json.Marshal(record.Metadata)
+	if err != nil || uint(len(js)) <= maxBytes {
+		return record
+	}
+
+	truncatedMetadata.WithLabelValues(record.Source).Inc()
+	record.Metadata = map[string]any{"_truncated": true, "_original_size": len(js)}
+
+	return record
+}
+
+// observeLatency records the end-to-end latency of stored logs. Logs without an ingestion time are ignored.
+func observeLatency(logs []entity.LogRecord) {
+	now := time.Now()
+	for _, l := range logs {
+		if !l.IngestedAt.IsZero() {
+			logLatency.Observe(now.Sub(l.IngestedAt).Seconds())
+		}
 	}
 }
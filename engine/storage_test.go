@@ -0,0 +1,502 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+var errFakeStorage = errors.New("fake storage failure")
+
+// fakeStorage keeps stored logs in memory. Storing fails while the matching fail flag is set.
+type fakeStorage struct {
+	mu            sync.Mutex
+	processed     []entity.LogRecord
+	raw           []entity.LogRecord
+	failProcessed bool
+	failRaw       bool
+}
+
+func (f *fakeStorage) Connect(context.Context) error { return nil }
+
+func (f *fakeStorage) Close(context.Context) error { return nil }
+
+func (f *fakeStorage) StoreProcessedLogs(_ context.Context, logs ...entity.LogRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failProcessed {
+		return errFakeStorage
+	}
+	f.processed = append(f.processed, logs...)
+	return nil
+}
+
+func (f *fakeStorage) StoreRawLogs(_ context.Context, logs ...entity.LogRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failRaw {
+		return errFakeStorage
+	}
+	f.raw = append(f.raw, logs...)
+	return nil
+}
+
+func (f *fakeStorage) setFailures(processed, raw bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failProcessed, f.failRaw = processed, raw
+}
+
+func (f *fakeStorage) counts() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.processed), len(f.raw)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testLogs(n int) []entity.LogRecord {
+	logs := make([]entity.LogRecord, n)
+	for i := range logs {
+		logs[i] = entity.LogRecord{ID: uuid.New(), Source: "test", Timestamp: time.Now(), Message: "message"}
+	}
+	return logs
+}
+
+// newTestStorageManager creates a storage manager whose buffers only flush on demand.
+func newTestStorageManager(storage Storage, maxConcurrentFlushes uint) *storageManager {
+	rawCfg := RawLogsStorageConfig{Enabled: true, BufferMaxSize: 1000}
+	return newStorageManager(discardLogger(), storage, 1000, 0, rawCfg, DedupConfig{}, maxConcurrentFlushes, 0)
+}
+
+func TestFlushNowStoresBufferedLogs(t *testing.T) {
+	storage := &fakeStorage{}
+	sm := newTestStorageManager(storage, 0)
+
+	ctx := context.Background()
+	sm.addProcessedLogs(ctx, testLogs(3)...)
+	sm.addRawLogs(ctx, testLogs(2)...)
+
+	if processed, raw := storage.counts(); processed != 0 || raw != 0 {
+		t.Fatalf("got %d processed and %d raw logs stored before flushing, want none", processed, raw)
+	}
+
+	n, err := sm.flushNow(ctx)
+	if err != nil {
+		t.Fatalf("cannot flush: %v", err)
+	}
+
+	if n != 3 {
+		t.Errorf("got %d flushed logs, want 3", n)
+	}
+
+	if processed, raw := storage.counts(); processed != 3 || raw != 2 {
+		t.Errorf("got %d processed and %d raw logs stored, want 3 and 2", processed, raw)
+	}
+}
+
+func TestFlushNowRestoresFailedLogs(t *testing.T) {
+	storage := &fakeStorage{}
+	sm := newTestStorageManager(storage, 0)
+
+	w, err := openWAL(discardLogger(), WALConfig{Dir: t.TempDir(), MaxBytes: defaultWALMaxBytes})
+	if err != nil {
+		t.Fatalf("cannot open write-ahead log: %v", err)
+	}
+	sm.wal = w
+
+	ctx := context.Background()
+	sm.addProcessedLogs(ctx, testLogs(3)...)
+	sm.addRawLogs(ctx, testLogs(2)...)
+
+	// Raw logs failing to be stored must not keep processed logs from being flushed.
+	storage.setFailures(false, true)
+	if n, err := sm.flushNow(ctx); !errors.Is(err, errFakeStorage) || n != 3 {
+		t.Fatalf("got %d flushed logs and error %v, want 3 and the storage failure", n, err)
+	}
+
+	if processed, raw := storage.counts(); processed != 3 || raw != 0 {
+		t.Fatalf("got %d processed and %d raw logs stored, want 3 and 0", processed, raw)
+	}
+
+	// Processed logs failing to be stored are put back, and their segment is kept along with new logs.
+	sm.addProcessedLogs(ctx, testLogs(2)...)
+	storage.setFailures(true, false)
+	if n, err := sm.flushNow(ctx); !errors.Is(err, errFakeStorage) || n != 0 {
+		t.Fatalf("got %d flushed logs and error %v, want 0 and the storage failure", n, err)
+	}
+
+	sm.addProcessedLogs(ctx, testLogs(1)...)
+	if segments, _ := w.segments(); len(segments) != 2 {
+		t.Fatalf("got %d write-ahead log segments, want 2", len(segments))
+	}
+
+	storage.setFailures(false, false)
+	if n, err := sm.flushNow(ctx); err != nil || n != 3 {
+		t.Fatalf("got %d flushed logs and error %v, want 3 and no error", n, err)
+	}
+
+	if processed, raw := storage.counts(); processed != 6 || raw != 2 {
+		t.Errorf("got %d processed and %d raw logs stored, want 6 and 2", processed, raw)
+	}
+
+	if segments, _ := w.segments(); len(segments) != 0 {
+		t.Errorf("got write-ahead log segments %v after flushing, want none", segments)
+	}
+}
+
+func TestFlushNowTakesFlushSlot(t *testing.T) {
+	storage := &fakeStorage{}
+	sm := newTestStorageManager(storage, 1)
+	sm.addProcessedLogs(context.Background(), testLogs(1)...)
+
+	// A running flush holds the only slot.
+	sm.flushSlots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := sm.flushNow(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v while all flush slots are taken, want %v", err, context.DeadlineExceeded)
+	}
+
+	<-sm.flushSlots
+	if n, err := sm.flushNow(context.Background()); err != nil || n != 1 {
+		t.Fatalf("got %d flushed logs and error %v, want 1 and no error", n, err)
+	}
+}
+
+func TestAddProcessedLogsLimitsMetadata(t *testing.T) {
+	storage := &fakeStorage{}
+	sm := newStorageManager(discardLogger(), storage, 1000, 0, RawLogsStorageConfig{}, DedupConfig{}, 0, 64)
+
+	logs := testLogs(2)
+	logs[0].Metadata = map[string]any{"small": true}
+	logs[1].Metadata = map[string]any{"payload": strings.Repeat("x", 100)}
+
+	sm.addProcessedLogs(context.Background(), logs...)
+	if _, err := sm.flushNow(context.Background()); err != nil {
+		t.Fatalf("cannot flush: %v", err)
+	}
+
+	if got := storage.processed[0].Metadata; len(got) != 1 || got["small"] != true {
+		t.Errorf("got metadata %v of the small log, want it unchanged", got)
+	}
+
+	got := storage.processed[1].Metadata
+	if got["_truncated"] != true || got["_original_size"] != len(`{"payload":"`)+100+len(`"}`) || len(got) != 2 {
+		t.Errorf("got metadata %v of the oversized log, want it truncated", got)
+	}
+
+	// Records of the caller are left unchanged.
+	if _, ok := logs[1].Metadata["payload"]; !ok {
+		t.Errorf("got metadata %v of the caller's log, want it unchanged", logs[1].Metadata)
+	}
+}
+
+func TestEngineStoreProcessedLogsNotRunning(t *testing.T) {
+	e, err := New(Config{
+		Sources:                    []LogSource{nil},
+		Storage:                    &fakeStorage{},
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	if err := e.StoreProcessedLogs(context.Background(), testLogs(1)...); !errors.Is(err, errEngineNotRunning) {
+		t.Fatalf("got error %v, want %v", err, errEngineNotRunning)
+	}
+}
+
+// flushingStorage is a fakeStorage implementing Flusher, recording the processed logs stored when it's flushed.
+type flushingStorage struct {
+	fakeStorage
+	flushes          int
+	storedAtFlush    int
+	flushCtxCanceled bool
+}
+
+func (f *flushingStorage) Flush(ctx context.Context) error {
+	processed, _ := f.counts()
+
+	f.flushes++
+	f.storedAtFlush = processed
+	f.flushCtxCanceled = ctx.Err() != nil
+	return nil
+}
+
+func TestStorageManagerFlushesStorageOnShutdown(t *testing.T) {
+	storage := &flushingStorage{}
+	sm := newTestStorageManager(storage, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sm.run(ctx)
+		close(done)
+	}()
+
+	sm.addProcessedLogs(ctx, testLogs(3)...)
+	cancel()
+	<-done
+
+	if storage.flushes != 1 {
+		t.Fatalf("got %d flushes of the storage, want 1", storage.flushes)
+	}
+	if storage.storedAtFlush != 3 {
+		t.Errorf("got %d logs stored when the storage was flushed, want all 3 buffered logs", storage.storedAtFlush)
+	}
+	if storage.flushCtxCanceled {
+		t.Error("got the storage flushed with a canceled context")
+	}
+}
+
+func TestAddRawLogs(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         RawLogsStorageConfig
+		wantFlushed int
+		wantStored  int
+	}{
+		{name: "disabled", cfg: RawLogsStorageConfig{}},
+		{name: "full buffer is flushed", cfg: RawLogsStorageConfig{Enabled: true, BufferMaxSize: 3}, wantFlushed: 3, wantStored: 5},
+		{name: "buffered until flushed", cfg: RawLogsStorageConfig{Enabled: true, FlushInterval: time.Hour}, wantStored: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &fakeStorage{}
+			sm := newStorageManager(discardLogger(), storage, 1000, 0, tt.cfg, DedupConfig{}, 0, 0)
+			ctx := context.Background()
+
+			for _, l := range testLogs(5) {
+				sm.addRawLogs(ctx, l)
+			}
+			sm.wg.Wait()
+			if _, raw := storage.counts(); raw != tt.wantFlushed {
+				t.Errorf("got %d raw logs stored once buffered, want %d", raw, tt.wantFlushed)
+			}
+
+			sm.flushRawBuffer(ctx)
+			sm.wg.Wait()
+			if processed, raw := storage.counts(); processed != 0 || raw != tt.wantStored {
+				t.Errorf("got %d processed and %d raw logs stored once flushed, want none and %d", processed, raw, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestEngineStoresRawLogsBeforeProcessing(t *testing.T) {
+	storage := &fakeStorage{}
+	e, err := New(Config{
+		Sources:                    []LogSource{idleSource{}},
+		Storage:                    storage,
+		RawLogsBufferMaxSize:       10,
+		ProcessedLogsBufferMaxSize: 10,
+		ProcessorWorkersCount:      1,
+		RawLogsStorage:             RawLogsStorageConfig{Enabled: true, BufferMaxSize: 100},
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("cannot create engine: %v", err)
+	}
+
+	rawLogs := make(chan entity.LogRecord, 3)
+	for _, l := range testLogs(3) {
+		l.RawData = []byte("raw " + l.ID.String())
+		rawLogs <- l
+	}
+	close(rawLogs)
+
+	// Raw logs are forwarded unchanged to processors.
+	var forwarded int
+	for l := range e.storeRawLogs(context.Background(), rawLogs) {
+		if want := "raw " + l.ID.String(); string(l.RawData) != want {
+			t.Errorf("got raw data %q, want %q", l.RawData, want)
+		}
+		forwarded++
+	}
+	if forwarded != 3 {
+		t.Errorf("got %d forwarded logs, want 3", forwarded)
+	}
+
+	if _, err := e.FlushBuffers(context.Background()); err != nil {
+		t.Fatalf("cannot flush: %v", err)
+	}
+	if _, raw := storage.counts(); raw != 3 {
+		t.Errorf("got %d raw logs stored, want 3", raw)
+	}
+}
+
+// processedOnlyStorage can't store raw logs.
+type processedOnlyStorage struct {
+	Storage
+}
+
+func TestEngineValidatesRawLogsStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage Storage
+		cfg     RawLogsStorageConfig
+		wantErr bool
+	}{
+		{name: "disabled", storage: processedOnlyStorage{&fakeStorage{}}},
+		{name: "enabled", storage: &fakeStorage{}, cfg: RawLogsStorageConfig{Enabled: true, BufferMaxSize: 10}},
+		{name: "storage without raw logs", storage: processedOnlyStorage{&fakeStorage{}}, cfg: RawLogsStorageConfig{Enabled: true, BufferMaxSize: 10}, wantErr: true},
+		{name: "neither buffered nor flushed", storage: &fakeStorage{}, cfg: RawLogsStorageConfig{Enabled: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(Config{
+				Sources:                    []LogSource{idleSource{}},
+				Storage:                    tt.storage,
+				RawLogsBufferMaxSize:       10,
+				ProcessedLogsBufferMaxSize: 10,
+				ProcessorWorkersCount:      1,
+				RawLogsStorage:             tt.cfg,
+			}, discardLogger())
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("got error %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// slowStorage is a fakeStorage whose StoreProcessedLogs blocks until release is closed, tracking concurrent calls.
+type slowStorage struct {
+	fakeStorage
+	release chan struct{}
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (s *slowStorage) StoreProcessedLogs(ctx context.Context, logs ...entity.LogRecord) error {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	for {
+		m := s.maxInFlight.Load()
+		if n <= m || s.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	<-s.release
+	return s.fakeStorage.StoreProcessedLogs(ctx, logs...)
+}
+
+func TestStorageManagerLimitsConcurrentFlushes(t *testing.T) {
+	tests := []struct {
+		name                 string
+		maxConcurrentFlushes uint
+		want                 int32
+	}{
+		{name: "limited", maxConcurrentFlushes: 2, want: 2},
+		{name: "unlimited", want: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &slowStorage{release: make(chan struct{})}
+			// Every added log fills the buffer, so it's flushed right away.
+			sm := newStorageManager(discardLogger(), storage, 1, 0, RawLogsStorageConfig{}, DedupConfig{}, tt.maxConcurrentFlushes, 0)
+
+			added := make(chan struct{})
+			go func() {
+				defer close(added)
+				for _, l := range testLogs(6) {
+					sm.addProcessedLogs(context.Background(), l)
+				}
+			}()
+
+			// Adding logs is held back while all flush slots are taken.
+			deadline := time.Now().Add(5 * time.Second)
+			for storage.inFlight.Load() < tt.want {
+				if time.Now().After(deadline) {
+					t.Fatalf("got %d flushes running, want %d", storage.inFlight.Load(), tt.want)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			close(storage.release)
+			<-added
+			sm.wg.Wait()
+
+			if got := storage.maxInFlight.Load(); got != tt.want {
+				t.Errorf("got %d flushes running at once, want %d", got, tt.want)
+			}
+			if processed, _ := storage.counts(); processed != 6 {
+				t.Errorf("got %d stored logs, want 6", processed)
+			}
+		})
+	}
+}
+
+// latencySamples returns the number and the sum of observations of the log latency histogram.
+func latencySamples(t *testing.T) (uint64, float64) {
+	t.Helper()
+
+	var m dto.Metric
+	if err := logLatency.Write(&m); err != nil {
+		t.Fatalf("cannot read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestFlushNowObservesLatency(t *testing.T) {
+	storage := &fakeStorage{}
+	sm := newTestStorageManager(storage, 0)
+
+	// Only logs read by a source have an ingestion time, others aren't observed.
+	logs := testLogs(3)
+	for i := range logs[:2] {
+		logs[i].IngestedAt = time.Now().Add(-2 * time.Second)
+	}
+
+	ctx := context.Background()
+	sm.addProcessedLogs(ctx, logs...)
+	count, sum := latencySamples(t)
+
+	// Logs failing to be stored aren't observed until they're flushed.
+	storage.setFailures(true, false)
+	if _, err := sm.flushNow(ctx); !errors.Is(err, errFakeStorage) {
+		t.Fatalf("got error %v, want the storage failure", err)
+	}
+	if got, _ := latencySamples(t); got != count {
+		t.Fatalf("got %d latencies observed for logs not stored, want none", got-count)
+	}
+
+	storage.setFailures(false, false)
+	if _, err := sm.flushNow(ctx); err != nil {
+		t.Fatalf("cannot flush: %v", err)
+	}
+
+	gotCount, gotSum := latencySamples(t)
+	if gotCount-count != 2 {
+		t.Errorf("got %d latencies observed, want 2", gotCount-count)
+	}
+	if latency := gotSum - sum; latency < 4 {
+		t.Errorf("got total latency of %.3fs, want at least 4s", latency)
+	}
+}
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+const (
+	defaultWALMaxBytes = 1 << 30
+	walSegmentPrefix   = "segment-"
+	walSegmentSuffix   = ".jsonl"
+)
+
+// errWALFull is returned when appending to the write-ahead log would exceed its maximum size.
+var errWALFull = errors.New("write-ahead log is full")
+
+// WALConfig configures the write-ahead log of processed logs. Buffered logs are appended to a segment file, which
+// is removed once the buffer is flushed, so logs buffered when the engine crashes are stored on the next start.
+type WALConfig struct {
+	// Dir is the directory of segment files. Empty disables the write-ahead log.
+	Dir string
+	// MaxBytes limits the total size of segment files. Once reached, logs are buffered without being written ahead
+	// until flushed segments are removed. Defaults to 1GiB.
+	MaxBytes uint64
+}
+
+func (c *WALConfig) setDefaults() {
+	if c.MaxBytes == 0 {
+		c.MaxBytes = defaultWALMaxBytes
+	}
+}
+
+func (c WALConfig) enabled() bool {
+	return c.Dir != ""
+}
+
+// wal appends buffered processed logs to segment files, one segment per buffer generation. Segments are JSON lines
+// of log records. They're not synced on every append, so they survive crashes of the process, but not of the host.
+type wal struct {
+	cfg    WALConfig
+	logger *slog.Logger
+
+	mu sync.Mutex
+	// current is the segment logs are appended to. It's nil until the first append after a rotation.
+	current *os.File
+	// seq is the sequence number of the latest segment, which orders segments by creation.
+	seq uint64
+	// sizes holds the size of each segment on disk, and size their total.
+	sizes map[string]uint64
+	size  uint64
+}
+
+// openWAL opens the write-ahead log in the configured directory, creating it if needed. Segments left by a previous
+// run are kept until replayed (see replay).
+func openWAL(logger *slog.Logger, cfg WALConfig) (*wal, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create write-ahead log directory: %w", err)
+	}
+
+	w := &wal{cfg: cfg, logger: logger, sizes: make(map[string]uint64)}
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range segments {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat write-ahead log segment: %w", err)
+		}
+
+		w.sizes[path] = uint64(info.Size())
+		w.size += uint64(info.Size())
+		w.seq = max(w.seq, segmentSeq(path))
+	}
+
+	return w, nil
+}
+
+// segments returns the paths of segment files, ordered by creation.
+func (w *wal) segments() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(w.cfg.Dir, walSegmentPrefix+"*"+walSegmentSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list write-ahead log segments: %w", err)
+	}
+
+	slices.SortFunc(paths, func(a, b string) int { return cmp.Compare(segmentSeq(a), segmentSeq(b)) })
+
+	return paths, nil
+}
+
+// segmentSeq returns the sequence number of a segment, or zero if its name has none.
+func segmentSeq(path string) uint64 {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), walSegmentPrefix), walSegmentSuffix)
+	seq, _ := strconv.ParseUint(name, 10, 64)
+	return seq
+}
+
+// append writes logs to the current segment, creating it if needed. It returns errWALFull, without writing any log,
+// if the maximum size would be exceeded.
+func (w *wal) append(logs []entity.LogRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			return fmt.Errorf("cannot encode log: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size+uint64(buf.Len()) > w.cfg.MaxBytes {
+		return errWALFull
+	}
+
+	if w.current == nil {
+		w.seq++
+		path := filepath.Join(w.cfg.Dir, fmt.Sprintf("%s%020d%s", walSegmentPrefix, w.seq, walSegmentSuffix))
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("cannot create write-ahead log segment: %w", err)
+		}
+		w.current = f
+	}
+
+	n, err := w.current.Write(buf.Bytes())
+	w.sizes[w.current.Name()] += uint64(n)
+	w.size += uint64(n)
+	if err != nil {
+		return fmt.Errorf("cannot write to write-ahead log segment: %w", err)
+	}
+
+	return nil
+}
+
+// rotate closes the current segment, so following logs are appended to a new one, and returns its path. It returns
+// an empty path if nothing was appended since the last rotation.
+func (w *wal) rotate() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.current == nil {
+		return ""
+	}
+
+	path := w.current.Name()
+	if err := w.current.Close(); err != nil {
+		w.logger.Warn("cannot close write-ahead log segment.", "path", path, "error", err)
+	}
+	w.current = nil
+
+	return path
+}
+
+// remove removes a segment whose logs are stored. Empty paths are ignored.
+func (w *wal) remove(path string) {
+	if path == "" {
+		return
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		w.logger.Error("cannot remove write-ahead log segment.", "path", path, "error", err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.size -= w.sizes[path]
+	delete(w.sizes, path)
+}
+
+// replay stores the logs of segments left by a previous run in batches of batchSize, removing each segment once its
+// logs are stored. Lines which can't be decoded, e.g. the last line of a segment written during a crash, are skipped.
+// If storing fails, the segment is kept, so batches of it which were already stored are stored again on the next
+// replay. It must be called before logs are appended. It returns the number of stored logs.
+func (w *wal) replay(ctx context.Context, storage Storage, batchSize uint) (int, error) {
+	segments, err := w.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	var replayed int
+	for _, path := range segments {
+		n, err := w.replaySegment(ctx, storage, path, max(batchSize, 1))
+		replayed += n
+		if err != nil {
+			return replayed, err
+		}
+
+		w.remove(path)
+	}
+
+	return replayed, nil
+}
+
+func (w *wal) replaySegment(ctx context.Context, storage Storage, path string, batchSize uint) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open write-ahead log segment: %w", err)
+	}
+	defer f.Close()
+
+	var stored int
+	batch := make([]entity.LogRecord, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := storage.StoreProcessedLogs(ctx, batch...); err != nil {
+			return fmt.Errorf("cannot store logs of write-ahead log segment: %w", err)
+		}
+
+		stored += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	// Lines are as long as records, which may be larger than the default limit of the scanner.
+	scanner.Buffer(nil, int(min(w.cfg.MaxBytes, 1<<30)))
+	for scanner.Scan() {
+		var l entity.LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			w.logger.Warn("skipping invalid write-ahead log record.", "path", path, "error", err)
+			continue
+		}
+
+		batch = append(batch, l)
+		if uint(len(batch)) >= batchSize {
+			if err := flush(); err != nil {
+				return stored, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return stored, fmt.Errorf("cannot read write-ahead log segment: %w", err)
+	}
+
+	return stored, flush()
+}
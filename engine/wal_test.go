@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	w, err := openWAL(discardLogger(), WALConfig{Dir: dir, MaxBytes: defaultWALMaxBytes})
+	if err != nil {
+		t.Fatalf("cannot open write-ahead log: %v", err)
+	}
+
+	crashed := newTestStorageManager(&fakeStorage{}, 0)
+	crashed.wal = w
+	crashed.addProcessedLogs(ctx, testLogs(5)...)
+	// The engine crashes before its buffer is flushed, so nothing is stored or removed.
+
+	storage := &fakeStorage{}
+	restarted := newTestStorageManager(storage, 0)
+	if restarted.wal, err = openWAL(discardLogger(), WALConfig{Dir: dir, MaxBytes: defaultWALMaxBytes}); err != nil {
+		t.Fatalf("cannot reopen write-ahead log: %v", err)
+	}
+
+	if err := restarted.replayWAL(ctx); err != nil {
+		t.Fatalf("cannot replay write-ahead log: %v", err)
+	}
+
+	if processed, _ := storage.counts(); processed != 5 {
+		t.Errorf("got %d replayed logs, want 5", processed)
+	}
+
+	if segments, _ := restarted.wal.segments(); len(segments) != 0 {
+		t.Errorf("got write-ahead log segments %v after replaying, want none", segments)
+	}
+}
+
+func TestAddProcessedLogsDurablyWALFull(t *testing.T) {
+	w, err := openWAL(discardLogger(), WALConfig{Dir: t.TempDir(), MaxBytes: 1})
+	if err != nil {
+		t.Fatalf("cannot open write-ahead log: %v", err)
+	}
+
+	storage := &fakeStorage{}
+	sm := newStorageManager(discardLogger(), storage, 1000, 0, RawLogsStorageConfig{}, DedupConfig{Window: time.Hour, MaxEntries: 10, Fields: defaultDedupFields}, 0, 0)
+	sm.wal = w
+
+	ctx := context.Background()
+	logs := testLogs(1)
+	if err := sm.addProcessedLogsDurably(ctx, logs...); !errors.Is(err, errWALFull) {
+		t.Fatalf("got error %v, want %v", err, errWALFull)
+	}
+
+	if n, _ := sm.flushNow(ctx); n != 0 {
+		t.Fatalf("got %d flushed logs, want logs which can't be written ahead not to be buffered", n)
+	}
+
+	// Logs which can't be written ahead are buffered anyway if they're not acknowledged. The rejected log must not be
+	// dropped as a duplicate of itself.
+	sm.addProcessedLogs(ctx, logs...)
+	if n, _ := sm.flushNow(ctx); n != 1 {
+		t.Fatalf("got %d flushed logs, want the log to be buffered although it couldn't be written ahead", n)
+	}
+}
@@ -1,9 +1,13 @@
 package entity
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/fault"
 )
 
 type LogLevel uint8
@@ -17,11 +21,60 @@ const (
 	LogLevelFatal
 )
 
+var logLevelNames = [...]string{"UNKNOWN", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+// logLevelInvalid is the level of records whose level name is unknown, so they fail LogRecord.Validate.
+const logLevelInvalid LogLevel = 255
+
 func (l LogLevel) String() string {
-	return [...]string{"UNKNOWN", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}[l]
+	if !l.IsValid() {
+		return fmt.Sprintf("LogLevel(%d)", l)
+	}
+	return logLevelNames[l]
+}
+
+// UnmarshalJSON decodes levels encoded by their numeric value, as they're encoded, or by their name
+// (case-insensitive, e.g. as posted to the ingest API). Unknown names decode to an invalid level, which is reported by
+// LogRecord.Validate along with other invalid fields.
+func (l *LogLevel) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		level, ok := ParseLogLevel(name)
+		if !ok {
+			level = logLevelInvalid
+		}
+		*l = level
+		return nil
+	}
+
+	var value uint8
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*l = LogLevel(value)
+	return nil
+}
+
+// IsValid reports whether l is one of the defined log levels.
+func (l LogLevel) IsValid() bool {
+	return int(l) < len(logLevelNames)
+}
+
+// ParseLogLevel returns the log level with the given name (case-insensitive).
+// The second return value is false if the name is not a known log level.
+func ParseLogLevel(name string) (LogLevel, bool) {
+	for i, n := range logLevelNames {
+		if strings.EqualFold(n, name) {
+			return LogLevel(i), true
+		}
+	}
+
+	return LogLevelUnknown, false
 }
 
 // LogRecord represents a log record received from a log source.
+// Its JSON encoding is the canonical representation of processed logs, e.g. in API responses, posted to the ingest
+// API, and in the write-ahead log. Raw data isn't encoded, and levels are encoded by their numeric value.
 type LogRecord struct {
 	ID        uuid.UUID      `json:"id"`
 	Source    string         `json:"source"`
@@ -30,4 +83,29 @@ type LogRecord struct {
 	Timestamp time.Time      `json:"timestamp"`
 	Message   string         `json:"message"`
 	Metadata  map[string]any `json:"metadata"`
+	// IngestedAt is when the record was read by a source. It's used to measure latency and isn't persisted.
+	IngestedAt time.Time `json:"-"`
+}
+
+// Validate checks that the record has the fields required to be stored as a processed log.
+func (r LogRecord) Validate() error {
+	errs := fault.FieldErrorsMetadata{}
+
+	if r.Timestamp.IsZero() {
+		errs["timestamp"] = append(errs["timestamp"], "Field is required.")
+	}
+
+	if !r.Level.IsValid() {
+		errs["level"] = append(errs["level"], "Unknown level.")
+	}
+
+	if r.Source == "" {
+		errs["source"] = append(errs["source"], "Field is required.")
+	}
+
+	if len(errs) > 0 {
+		return fault.New(fault.BadInputCode, "").WithMetadata(errs)
+	}
+
+	return nil
 }
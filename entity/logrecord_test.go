@@ -0,0 +1,104 @@
+package entity
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLogRecordJSONRoundTrip(t *testing.T) {
+	record := LogRecord{
+		ID:        uuid.New(),
+		Source:    "api",
+		RawData:   []byte("raw"),
+		Level:     LogLevelWarn,
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 678, time.UTC),
+		Message:   "slow request",
+		Metadata: map[string]any{
+			"status":  float64(200),
+			"user":    "alice",
+			"tags":    []any{"a", "b"},
+			"request": map[string]any{"path": "/users", "cached": true},
+			"parent":  nil,
+		},
+		IngestedAt: time.Now(),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("cannot marshal record: %v", err)
+	}
+
+	var got LogRecord
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("cannot unmarshal record: %v", err)
+	}
+
+	// Raw data and the ingestion time aren't encoded.
+	want := record
+	want.RawData = nil
+	want.IngestedAt = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("cannot unmarshal fields: %v", err)
+	}
+	for _, f := range []string{"id", "source", "level", "timestamp", "message", "metadata"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("got fields %v, want `%s`", fields, f)
+		}
+	}
+	if len(fields) != 6 {
+		t.Errorf("got fields %v, want only the canonical ones", fields)
+	}
+	if fields["level"] != float64(LogLevelWarn) {
+		t.Errorf("got level %v, want it encoded by its numeric value", fields["level"])
+	}
+}
+
+func TestLogLevelUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		want      LogLevel
+		wantValid bool
+		wantErr   bool
+	}{
+		{name: "numeric value", data: `4`, want: LogLevelError, wantValid: true},
+		{name: "name", data: `"info"`, want: LogLevelInfo, wantValid: true},
+		{name: "name is case-insensitive", data: `"FaTaL"`, want: LogLevelFatal, wantValid: true},
+		{name: "unknown name", data: `"verbose"`, want: logLevelInvalid},
+		{name: "unknown numeric value", data: `9`, want: LogLevel(9)},
+		{name: "wrong type", data: `true`, wantErr: true},
+		{name: "numeric value out of range", data: `256`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got LogLevel
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got level %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot unmarshal level: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got level %v, want %v", got, tt.want)
+			}
+			if got.IsValid() != tt.wantValid {
+				t.Errorf("got level valid %v, want %v", got.IsValid(), tt.wantValid)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ const (
 	NotFoundCode         faultCode = "not_found"
 	BadInputCode         faultCode = "bad_input"
 	PermissionDeniedCode faultCode = "permission_denied"
+	UnavailableCode      faultCode = "unavailable"
 )
 
 type FieldErrorsMetadata map[string][]string
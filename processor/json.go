@@ -4,22 +4,60 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/thisisjab/logzilla/entity"
 )
 
+// TimestampFallback defines how JsonLogProcessor handles records without a valid timestamp.
+type TimestampFallback string
+
+const (
+	// TimestampFallbackError fails the record.
+	TimestampFallbackError TimestampFallback = "error"
+	// TimestampFallbackNow uses the time the record is processed at.
+	TimestampFallbackNow TimestampFallback = "now"
+	// TimestampFallbackIngest uses the time the record was read by its source, or the processing time if unknown.
+	TimestampFallbackIngest TimestampFallback = "ingest"
+)
+
 type JsonLogProcessorConfig struct {
 	Name                  string `yaml:"-"`
 	LogLevelFieldName     string `yaml:"level_field"`
 	LogMessageFieldName   string `yaml:"message_field"`
 	LogTimestampFieldName string `yaml:"timestamp_field"`
+
+	// TimestampFallback applies to records whose timestamp field is missing, or can't be parsed. Defaults to
+	// TimestampFallbackError.
+	TimestampFallback TimestampFallback `yaml:"timestamp_fallback"`
+
+	// MessageFieldCandidates are fields tried in order (e.g. `["message", "msg", "text"]`) after LogMessageFieldName
+	// for the message. The first one holding a string is used, and the others are kept in metadata.
+	MessageFieldCandidates []string `yaml:"message_field_candidates"`
+	// MessageFieldRequired fails records without a message field holding a string. Otherwise, their message is empty.
+	MessageFieldRequired bool `yaml:"message_field_required"`
+
+	// Flatten flattens nested objects of metadata into keys joined by FlattenSeparator (e.g. `a.b.c`).
+	// Note that keys containing a dot must be quoted in queries (e.g. `metadata."a.b.c"`).
+	Flatten bool `yaml:"flatten"`
+	// FlattenSeparator joins keys of flattened objects. Defaults to ".".
+	FlattenSeparator string `yaml:"flatten_separator"`
+	// FlattenArrays also flattens arrays, using indexes as keys (e.g. `a.0.b`). Otherwise arrays are kept as-is.
+	FlattenArrays bool `yaml:"flatten_arrays"`
+
+	// KeepRaw keeps the original log, as a string, in metadata under RawKey.
+	KeepRaw bool `yaml:"keep_raw"`
+	// RawKey is the metadata key of the original log. Defaults to "_raw".
+	RawKey string `yaml:"raw_key"`
 }
 
 // JsonLogProcessor is a simple JSON log processor. It parses JSON logs and extracts log level, message,
 // and timestamp, and any other fields will be considered as metadata.
 type JsonLogProcessor struct {
 	cfg JsonLogProcessorConfig
+	// messageFields holds the configured message field, followed by the candidates.
+	messageFields []string
 }
 
 // NewJsonLogProcessor creates a new instance of JsonLogProcessor.
@@ -28,7 +66,35 @@ func NewJsonLogProcessor(cfg JsonLogProcessorConfig) (*JsonLogProcessor, error)
 		return nil, fmt.Errorf("name cannot be empty")
 	}
 
-	return &JsonLogProcessor{cfg: cfg}, nil
+	if cfg.FlattenSeparator == "" {
+		cfg.FlattenSeparator = "."
+	}
+
+	if cfg.RawKey == "" {
+		cfg.RawKey = "_raw"
+	}
+
+	if cfg.TimestampFallback == "" {
+		cfg.TimestampFallback = TimestampFallbackError
+	}
+
+	switch cfg.TimestampFallback {
+	case TimestampFallbackError, TimestampFallbackNow, TimestampFallbackIngest:
+	default:
+		return nil, fmt.Errorf("invalid timestamp fallback: %s", cfg.TimestampFallback)
+	}
+
+	var messageFields []string
+	if cfg.LogMessageFieldName != "" {
+		messageFields = append(messageFields, cfg.LogMessageFieldName)
+	}
+	messageFields = append(messageFields, cfg.MessageFieldCandidates...)
+
+	if cfg.MessageFieldRequired && len(messageFields) == 0 {
+		return nil, fmt.Errorf("message field is required, but none is configured")
+	}
+
+	return &JsonLogProcessor{cfg: cfg, messageFields: messageFields}, nil
 }
 
 func (p *JsonLogProcessor) Name() string {
@@ -45,20 +111,13 @@ func (p *JsonLogProcessor) Process(record entity.LogRecord) (entity.LogRecord, e
 	}
 
 	// Parsing time
-	val, ok := data[p.cfg.LogTimestampFieldName]
-	timestampValue, isString := val.(string)
-	if !ok || !isString || timestampValue == "" {
-		return entity.LogRecord{}, errors.New("timestamp field is missing or not a string")
-	}
-
-	timestamp, err := time.Parse(time.RFC3339, timestampValue)
+	timestamp, err := p.parseTimestamp(record, data)
 	if err != nil {
-		return entity.LogRecord{}, fmt.Errorf("cannot parse timestamp: %w", err)
+		return entity.LogRecord{}, err
 	}
-	delete(data, p.cfg.LogTimestampFieldName)
 
 	// Parsing level
-	val, ok = data[p.cfg.LogLevelFieldName]
+	val, ok := data[p.cfg.LogLevelFieldName]
 	levelValue, isString := val.(string)
 	if !ok || !isString {
 		return entity.LogRecord{}, errors.New("level field is missing or not a string")
@@ -67,14 +126,97 @@ func (p *JsonLogProcessor) Process(record entity.LogRecord) (entity.LogRecord, e
 	delete(data, p.cfg.LogLevelFieldName)
 
 	// Getting message
-	val = data[p.cfg.LogMessageFieldName]
-	messageValue, _ := val.(string)
-	delete(data, p.cfg.LogMessageFieldName)
-
-	return entity.LogRecord{
-		Level:     level,
-		Message:   messageValue,
-		Timestamp: timestamp,
-		Metadata:  data,
-	}, nil
+	var messageValue string
+	messageFound := false
+	for _, f := range p.messageFields {
+		if messageValue, messageFound = data[f].(string); messageFound {
+			delete(data, f)
+			break
+		}
+	}
+
+	if !messageFound && p.cfg.MessageFieldRequired {
+		return entity.LogRecord{}, errors.New("message field is missing or not a string")
+	}
+
+	// Fields not extracted from the log (e.g. source) are preserved.
+	record.Level = level
+	record.Message = messageValue
+	record.Timestamp = timestamp
+	record.Metadata = data
+	if p.cfg.Flatten {
+		record.Metadata = make(map[string]any, len(data))
+		p.flatten(record.Metadata, "", data)
+	}
+
+	// The original log is added after the fields are extracted, so it's never flattened or taken for one of them.
+	if p.cfg.KeepRaw {
+		record.Metadata[p.cfg.RawKey] = string(record.RawData)
+	}
+
+	return record, nil
+}
+
+// parseTimestamp returns the timestamp of the record, removing its field from data once parsed. Fields which are
+// missing or can't be parsed are handled according to TimestampFallback, and invalid ones are kept in data.
+func (p *JsonLogProcessor) parseTimestamp(record entity.LogRecord, data map[string]any) (time.Time, error) {
+	timestampValue, _ := data[p.cfg.LogTimestampFieldName].(string)
+	if timestampValue == "" {
+		return p.fallbackTimestamp(record, errors.New("timestamp field is missing or not a string"))
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, timestampValue)
+	if err != nil {
+		return p.fallbackTimestamp(record, fmt.Errorf("cannot parse timestamp: %w", err))
+	}
+	delete(data, p.cfg.LogTimestampFieldName)
+
+	// Offsets are dropped, so timestamps of all records are stored and compared alike.
+	return timestamp.UTC(), nil
+}
+
+// fallbackTimestamp returns the timestamp of a record without a valid one according to TimestampFallback, or err if
+// the record must fail.
+func (p *JsonLogProcessor) fallbackTimestamp(record entity.LogRecord, err error) (time.Time, error) {
+	switch p.cfg.TimestampFallback {
+	case TimestampFallbackIngest:
+		if !record.IngestedAt.IsZero() {
+			return record.IngestedAt.UTC(), nil
+		}
+		return time.Now().UTC(), nil
+	case TimestampFallbackNow:
+		return time.Now().UTC(), nil
+	default:
+		return time.Time{}, err
+	}
+}
+
+// flatten adds the values of nested objects (and arrays, if configured) in value to dst, keyed by their path.
+func (p *JsonLogProcessor) flatten(dst map[string]any, prefix string, value any) {
+	key := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + p.cfg.FlattenSeparator + k
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 && prefix != "" {
+			dst[prefix] = v
+		}
+		for k, child := range v {
+			p.flatten(dst, key(k), child)
+		}
+	case []any:
+		if !p.cfg.FlattenArrays || len(v) == 0 {
+			dst[prefix] = v
+			return
+		}
+		for i, child := range v {
+			p.flatten(dst, key(strconv.Itoa(i)), child)
+		}
+	default:
+		dst[prefix] = v
+	}
 }
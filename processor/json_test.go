@@ -0,0 +1,356 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// newTestJsonProcessor creates a JSON processor reading the `level`, `msg` and `ts` fields, configured by configure.
+func newTestJsonProcessor(t *testing.T, configure func(cfg *JsonLogProcessorConfig)) *JsonLogProcessor {
+	t.Helper()
+
+	cfg := JsonLogProcessorConfig{
+		Name:                  "json",
+		LogLevelFieldName:     "level",
+		LogMessageFieldName:   "msg",
+		LogTimestampFieldName: "ts",
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	p, err := NewJsonLogProcessor(cfg)
+	if err != nil {
+		t.Fatalf("cannot create processor: %v", err)
+	}
+	return p
+}
+
+func TestJsonLogProcessorFlatten(t *testing.T) {
+	raw := `{"level": "info", "msg": "hello", "ts": "2024-01-02T00:00:00Z",
+		"http": {"status": 200, "headers": {"host": "example.com"}, "empty": {}}, "tags": ["a", {"b": 1}], "none": []}`
+
+	tests := []struct {
+		name      string
+		configure func(cfg *JsonLogProcessorConfig)
+		want      map[string]any
+	}{
+		{
+			name: "nested",
+			want: map[string]any{
+				"http": map[string]any{"status": float64(200), "headers": map[string]any{"host": "example.com"}, "empty": map[string]any{}},
+				"tags": []any{"a", map[string]any{"b": float64(1)}},
+				"none": []any{},
+			},
+		},
+		{
+			name:      "flattened",
+			configure: func(cfg *JsonLogProcessorConfig) { cfg.Flatten = true },
+			want: map[string]any{
+				"http.status":       float64(200),
+				"http.headers.host": "example.com",
+				"http.empty":        map[string]any{},
+				"tags":              []any{"a", map[string]any{"b": float64(1)}},
+				"none":              []any{},
+			},
+		},
+		{
+			name: "flattened with arrays and a custom separator",
+			configure: func(cfg *JsonLogProcessorConfig) {
+				cfg.Flatten = true
+				cfg.FlattenArrays = true
+				cfg.FlattenSeparator = "_"
+			},
+			want: map[string]any{
+				"http_status":       float64(200),
+				"http_headers_host": "example.com",
+				"http_empty":        map[string]any{},
+				"tags_0":            "a",
+				"tags_1_b":          float64(1),
+				"none":              []any{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestJsonProcessor(t, tt.configure).Process(entity.LogRecord{Source: "api", RawData: []byte(raw)})
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if !reflect.DeepEqual(got.Metadata, tt.want) {
+				t.Errorf("got metadata %v, want %v", got.Metadata, tt.want)
+			}
+
+			if got.Source != "api" || got.Level != entity.LogLevelInfo || got.Message != "hello" {
+				t.Errorf("got source %q, level %v and message %q, want them extracted", got.Source, got.Level, got.Message)
+			}
+		})
+	}
+}
+
+func TestJsonLogProcessorKeepRaw(t *testing.T) {
+	raw := `{"level": "warn", "msg": "slow", "ts": "2024-01-02T00:00:00Z", "db": {"query": "SELECT 1"}}`
+
+	tests := []struct {
+		name      string
+		configure func(cfg *JsonLogProcessorConfig)
+		key       string
+	}{
+		{
+			name:      "default key",
+			configure: func(cfg *JsonLogProcessorConfig) { cfg.KeepRaw = true },
+			key:       "_raw",
+		},
+		{
+			name: "custom key is never flattened",
+			configure: func(cfg *JsonLogProcessorConfig) {
+				cfg.KeepRaw = true
+				cfg.RawKey = "original.log"
+				cfg.Flatten = true
+			},
+			key: "original.log",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestJsonProcessor(t, tt.configure).Process(entity.LogRecord{RawData: []byte(raw)})
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if got.Metadata[tt.key] != raw {
+				t.Errorf("got %s %v, want the original log %s", tt.key, got.Metadata[tt.key], raw)
+			}
+		})
+	}
+}
+
+func TestJsonLogProcessorDoesNotKeepRawByDefault(t *testing.T) {
+	got, err := newTestJsonProcessor(t, nil).Process(entity.LogRecord{RawData: []byte(`{"level": "info", "ts": "2024-01-02T00:00:00Z"}`)})
+	if err != nil {
+		t.Fatalf("cannot process record: %v", err)
+	}
+
+	if _, ok := got.Metadata["_raw"]; ok {
+		t.Errorf("got metadata %v, want no original log", got.Metadata)
+	}
+}
+
+func TestJsonLogProcessorMessageFields(t *testing.T) {
+	tests := []struct {
+		name         string
+		configure    func(cfg *JsonLogProcessorConfig)
+		raw          string
+		wantMessage  string
+		wantMetadata map[string]any
+		wantErr      bool
+	}{
+		{
+			name:         "configured field first",
+			configure:    func(cfg *JsonLogProcessorConfig) { cfg.MessageFieldCandidates = []string{"message", "text"} },
+			raw:          `{"level": "info", "ts": "2024-01-02T00:00:00Z", "msg": "from msg", "text": "from text"}`,
+			wantMessage:  "from msg",
+			wantMetadata: map[string]any{"text": "from text"},
+		},
+		{
+			name:         "first candidate holding a string",
+			configure:    func(cfg *JsonLogProcessorConfig) { cfg.MessageFieldCandidates = []string{"message", "text"} },
+			raw:          `{"level": "info", "ts": "2024-01-02T00:00:00Z", "msg": 42, "message": {"nested": true}, "text": "from text"}`,
+			wantMessage:  "from text",
+			wantMetadata: map[string]any{"msg": float64(42), "message": map[string]any{"nested": true}},
+		},
+		{
+			name:         "missing message is empty",
+			raw:          `{"level": "info", "ts": "2024-01-02T00:00:00Z", "text": "ignored"}`,
+			wantMetadata: map[string]any{"text": "ignored"},
+		},
+		{
+			name:      "missing required message",
+			configure: func(cfg *JsonLogProcessorConfig) { cfg.MessageFieldRequired = true },
+			raw:       `{"level": "info", "ts": "2024-01-02T00:00:00Z", "text": "ignored"}`,
+			wantErr:   true,
+		},
+		{
+			name: "required message found in a candidate",
+			configure: func(cfg *JsonLogProcessorConfig) {
+				cfg.MessageFieldRequired = true
+				cfg.MessageFieldCandidates = []string{"text"}
+			},
+			raw:          `{"level": "info", "ts": "2024-01-02T00:00:00Z", "text": "from text"}`,
+			wantMessage:  "from text",
+			wantMetadata: map[string]any{},
+		},
+		{
+			name:      "required message not a string",
+			configure: func(cfg *JsonLogProcessorConfig) { cfg.MessageFieldRequired = true },
+			raw:       `{"level": "info", "ts": "2024-01-02T00:00:00Z", "msg": ["not", "a", "string"]}`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestJsonProcessor(t, tt.configure).Process(entity.LogRecord{RawData: []byte(tt.raw)})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got message %q, want an error", got.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if got.Message != tt.wantMessage {
+				t.Errorf("got message %q, want %q", got.Message, tt.wantMessage)
+			}
+
+			if !reflect.DeepEqual(got.Metadata, tt.wantMetadata) {
+				t.Errorf("got metadata %v, want %v", got.Metadata, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestNewJsonLogProcessorRequiresMessageField(t *testing.T) {
+	_, err := NewJsonLogProcessor(JsonLogProcessorConfig{Name: "json", LogLevelFieldName: "level", MessageFieldRequired: true})
+	if err == nil {
+		t.Error("got no error, want one for a required message without message fields")
+	}
+}
+
+func TestJsonLogProcessorTimestampFallback(t *testing.T) {
+	ingestedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+1", 3600))
+
+	tests := []struct {
+		name       string
+		fallback   TimestampFallback
+		raw        string
+		ingestedAt time.Time
+		// want is the expected timestamp, or zero if it must be the processing time.
+		want         time.Time
+		wantMetadata map[string]any
+		wantErr      bool
+	}{
+		{
+			name:         "valid timestamp is converted to UTC",
+			fallback:     TimestampFallbackError,
+			raw:          `{"level": "info", "ts": "2024-01-02T03:00:00+02:00"}`,
+			want:         time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC),
+			wantMetadata: map[string]any{},
+		},
+		{
+			name:     "error on missing timestamp",
+			fallback: TimestampFallbackError,
+			raw:      `{"level": "info"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "error on invalid timestamp",
+			fallback: TimestampFallbackError,
+			raw:      `{"level": "info", "ts": "yesterday"}`,
+			wantErr:  true,
+		},
+		{
+			name:         "now on missing timestamp",
+			fallback:     TimestampFallbackNow,
+			raw:          `{"level": "info"}`,
+			ingestedAt:   ingestedAt,
+			wantMetadata: map[string]any{},
+		},
+		{
+			name:         "now keeps an invalid timestamp",
+			fallback:     TimestampFallbackNow,
+			raw:          `{"level": "info", "ts": "yesterday"}`,
+			wantMetadata: map[string]any{"ts": "yesterday"},
+		},
+		{
+			name:         "ingest on invalid timestamp",
+			fallback:     TimestampFallbackIngest,
+			raw:          `{"level": "info", "ts": 1704164645}`,
+			ingestedAt:   ingestedAt,
+			want:         ingestedAt.UTC(),
+			wantMetadata: map[string]any{"ts": float64(1704164645)},
+		},
+		{
+			name:         "ingest without an ingestion time",
+			fallback:     TimestampFallbackIngest,
+			raw:          `{"level": "info"}`,
+			wantMetadata: map[string]any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestJsonProcessor(t, func(cfg *JsonLogProcessorConfig) { cfg.TimestampFallback = tt.fallback })
+
+			before := time.Now().UTC()
+			got, err := p.Process(entity.LogRecord{RawData: []byte(tt.raw), IngestedAt: tt.ingestedAt})
+			after := time.Now().UTC()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got timestamp %v, want an error", got.Timestamp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if got.Timestamp.Location() != time.UTC {
+				t.Errorf("got timestamp %v, want it in UTC", got.Timestamp)
+			}
+
+			if tt.want.IsZero() {
+				if got.Timestamp.Before(before) || got.Timestamp.After(after) {
+					t.Errorf("got timestamp %v, want the processing time between %v and %v", got.Timestamp, before, after)
+				}
+			} else if !got.Timestamp.Equal(tt.want) {
+				t.Errorf("got timestamp %v, want %v", got.Timestamp, tt.want)
+			}
+
+			if !reflect.DeepEqual(got.Metadata, tt.wantMetadata) {
+				t.Errorf("got metadata %v, want %v", got.Metadata, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestNewJsonLogProcessorInvalidTimestampFallback(t *testing.T) {
+	_, err := NewJsonLogProcessor(JsonLogProcessorConfig{Name: "json", TimestampFallback: "tomorrow"})
+	if err == nil {
+		t.Error("got no error, want one for an unknown timestamp fallback")
+	}
+}
+
+func TestJsonLogProcessorPreservesSource(t *testing.T) {
+	record := entity.LogRecord{Source: "api", RawData: []byte(`{"level": "info", "msg": "served", "ts": "2024-01-02T00:00:00Z"}`)}
+
+	got, err := newTestJsonProcessor(t, nil).Process(record)
+	if err != nil {
+		t.Fatalf("cannot process record: %v", err)
+	}
+
+	if got.Source != "api" || string(got.RawData) != string(record.RawData) {
+		t.Errorf("got source %q and raw data %q, want %q and %q", got.Source, got.RawData, "api", record.RawData)
+	}
+}
+
+func TestJsonLogProcessorNormalizesTimestampToUTC(t *testing.T) {
+	got, err := newTestJsonProcessor(t, nil).Process(entity.LogRecord{RawData: []byte(`{"level": "info", "msg": "started", "ts": "2024-01-02T05:30:00+05:30"}`)})
+	if err != nil {
+		t.Fatalf("cannot process record: %v", err)
+	}
+
+	// Unlike Equal, comparing with != also tells apart locations.
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC); got.Timestamp != want {
+		t.Errorf("got timestamp %v, want %v", got.Timestamp, want)
+	}
+}
@@ -20,7 +20,7 @@ type LuaLogProcessorConfig struct {
 // `parse_log` function must return 4 fields:
 // 1. level as a string of debug, info, warning, error, fatal or unknown
 // 2. message as a string
-// 3. timestamp as a string in ISO 8601/RFC3339 format
+// 3. timestamp as a string in ISO 8601/RFC3339 format, or an empty string to keep the original timestamp
 // 4. metadata as a table
 // Note that user can have access to JSON helper using `local json = require("json")`
 type LuaLogProcessor struct {
@@ -103,19 +103,22 @@ func (lp *LuaLogProcessor) Process(record entity.LogRecord) (entity.LogRecord, e
 	L.Pop(4)
 
 	// Parsing outside of the Lua VM Lock
-	luaTimestamp, err := time.Parse(time.RFC3339, tsRaw)
-	if err != nil {
-		return record, fmt.Errorf("cannot parse timestamp '%s': %w", tsRaw, err)
+	// If the script returns no timestamp, the original one is preserved.
+	if tsRaw != "" {
+		luaTimestamp, err := time.Parse(time.RFC3339, tsRaw)
+		if err != nil {
+			return record, fmt.Errorf("cannot parse timestamp '%s': %w", tsRaw, err)
+		}
+		// Offsets are dropped, so timestamps of all records are stored and compared alike.
+		record.Timestamp = luaTimestamp.UTC()
 	}
 
-	return entity.LogRecord{
-		ID:        record.ID,
-		Source:    record.Source,
-		Timestamp: luaTimestamp,
-		Level:     parseLevel(luaLevel),
-		Message:   luaMessage,
-		Metadata:  luaTableToMap(luaMeta),
-	}, nil
+	// Fields not returned by the script (e.g. source) are preserved.
+	record.Level = parseLevel(luaLevel)
+	record.Message = luaMessage
+	record.Metadata = luaTableToMap(luaMeta)
+
+	return record, nil
 }
 
 func luaTableToMap(table *lua.LTable) map[string]any {
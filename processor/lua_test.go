@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// newTestLuaProcessor creates a Lua processor running script.
+func newTestLuaProcessor(t *testing.T, script string) *LuaLogProcessor {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "parse.lua")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatalf("cannot write script: %v", err)
+	}
+
+	p, err := NewLuaLogProcessor(LuaLogProcessorConfig{Name: "lua", ScriptPath: path})
+	if err != nil {
+		t.Fatalf("cannot create processor: %v", err)
+	}
+	return p
+}
+
+func TestLuaLogProcessorPreservesRecord(t *testing.T) {
+	original := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		timestamp     string
+		wantTimestamp time.Time
+	}{
+		{name: "timestamp returned", timestamp: "2024-03-04T05:06:07Z", wantTimestamp: time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)},
+		{name: "no timestamp returned", wantTimestamp: original},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestLuaProcessor(t, `
+function parse_log(line)
+	return "error", line, "`+tt.timestamp+`", {}
+end
+`)
+
+			got, err := p.Process(entity.LogRecord{Source: "api", Timestamp: original, RawData: []byte("disk full")})
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if got.Source != "api" || got.Level != entity.LogLevelError || got.Message != "disk full" {
+				t.Errorf("got source %q, level %v and message %q, want %q, %v and %q", got.Source, got.Level, got.Message,
+					"api", entity.LogLevelError, "disk full")
+			}
+
+			if !got.Timestamp.Equal(tt.wantTimestamp) {
+				t.Errorf("got timestamp %v, want %v", got.Timestamp, tt.wantTimestamp)
+			}
+		})
+	}
+}
+
+func TestLuaLogProcessorNormalizesTimestampToUTC(t *testing.T) {
+	p := newTestLuaProcessor(t, `
+function parse_log(line)
+	return "info", line, "2024-01-02T05:30:00+05:30", {}
+end
+`)
+
+	got, err := p.Process(entity.LogRecord{RawData: []byte("started")})
+	if err != nil {
+		t.Fatalf("cannot process record: %v", err)
+	}
+
+	// Unlike Equal, comparing with != also tells apart locations.
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC); got.Timestamp != want {
+		t.Errorf("got timestamp %v, want %v", got.Timestamp, want)
+	}
+}
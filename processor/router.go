@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+type RouterLogProcessorConfig struct {
+	Name string `yaml:"-"`
+	// Branches are tried in order. Records are processed by the first matching branch which succeeds.
+	Branches []RouterBranch `yaml:"-"`
+}
+
+// RouterBranch dispatches records matching both Prefix and Pattern to Processor. A branch without conditions matches
+// every record, which is handy as the last, fallback branch.
+type RouterBranch struct {
+	// Prefix matches records whose raw data starts with it, ignoring leading whitespace (e.g. `{` for JSON).
+	Prefix string
+	// Pattern is a regular expression matching the raw data of records.
+	Pattern string
+	// Processor processes the records matching the branch.
+	Processor engine.LogProcessor
+}
+
+// RouterLogProcessor dispatches records to one of several processors depending on their raw data, so a source
+// emitting records of different formats (e.g. JSON and plain text lines) can be processed by a single chain.
+type RouterLogProcessor struct {
+	cfg RouterLogProcessorConfig
+	// patterns holds the compiled pattern of each branch, or nil if it has none.
+	patterns []*regexp.Regexp
+}
+
+// NewRouterLogProcessor creates a new instance of RouterLogProcessor.
+func NewRouterLogProcessor(cfg RouterLogProcessorConfig) (*RouterLogProcessor, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("name cannot be empty")
+	}
+
+	if len(cfg.Branches) == 0 {
+		return nil, fmt.Errorf("branches cannot be empty")
+	}
+
+	patterns := make([]*regexp.Regexp, len(cfg.Branches))
+	for i, b := range cfg.Branches {
+		if b.Processor == nil {
+			return nil, fmt.Errorf("processor of branch %d cannot be empty", i)
+		}
+
+		if b.Pattern == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(b.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile pattern of branch %d: %w", i, err)
+		}
+		patterns[i] = re
+	}
+
+	return &RouterLogProcessor{
+		cfg:      cfg,
+		patterns: patterns,
+	}, nil
+}
+
+func (p *RouterLogProcessor) Name() string {
+	return p.cfg.Name
+}
+
+// Process returns the result of the first matching branch which processes the record successfully. If all matching
+// branches fail, their errors are returned. Records dropped by a branch (see engine.ErrDropRecord) are not tried
+// against the following branches.
+func (p *RouterLogProcessor) Process(record entity.LogRecord) (entity.LogRecord, error) {
+	var errs []error
+
+	for i, b := range p.cfg.Branches {
+		if !p.matches(i, record.RawData) {
+			continue
+		}
+
+		res, err := b.Processor.Process(record)
+		if err == nil || errors.Is(err, engine.ErrDropRecord) {
+			return res, err
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", b.Processor.Name(), err))
+	}
+
+	if len(errs) == 0 {
+		return record, errors.New("no branch matches the record")
+	}
+
+	return record, errors.Join(errs...)
+}
+
+// matches reports whether data satisfies the conditions of the i-th branch.
+func (p *RouterLogProcessor) matches(i int, data []byte) bool {
+	b := p.cfg.Branches[i]
+
+	if b.Prefix != "" && !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(b.Prefix)) {
+		return false
+	}
+
+	return p.patterns[i] == nil || p.patterns[i].Match(data)
+}
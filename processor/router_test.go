@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// fakeLogfmtProcessor parses `key=value` pairs separated by spaces, taking `level` and `msg` for the level and the
+// message of the record.
+type fakeLogfmtProcessor struct{}
+
+func (fakeLogfmtProcessor) Name() string { return "logfmt" }
+
+func (fakeLogfmtProcessor) Process(record entity.LogRecord) (entity.LogRecord, error) {
+	record.Metadata = map[string]any{}
+	for _, pair := range strings.Fields(string(record.RawData)) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return entity.LogRecord{}, errors.New("invalid logfmt pair")
+		}
+
+		switch key {
+		case "level":
+			record.Level, _ = entity.ParseLogLevel(value)
+		case "msg":
+			record.Message = value
+		default:
+			record.Metadata[key] = value
+		}
+	}
+	return record, nil
+}
+
+// fakeDropProcessor drops every record.
+type fakeDropProcessor struct{}
+
+func (fakeDropProcessor) Name() string { return "drop" }
+
+func (fakeDropProcessor) Process(record entity.LogRecord) (entity.LogRecord, error) {
+	return record, engine.ErrDropRecord
+}
+
+func newTestRouterProcessor(t *testing.T, fallback engine.LogProcessor) *RouterLogProcessor {
+	t.Helper()
+
+	branches := []RouterBranch{
+		{Prefix: "{", Processor: newTestJsonProcessor(t, nil)},
+		{Pattern: `^\w+=\S*( \w+=\S*)*$`, Processor: fakeLogfmtProcessor{}},
+	}
+	if fallback != nil {
+		branches = append(branches, RouterBranch{Processor: fallback})
+	}
+
+	p, err := NewRouterLogProcessor(RouterLogProcessorConfig{Name: "router", Branches: branches})
+	if err != nil {
+		t.Fatalf("cannot create processor: %v", err)
+	}
+	return p
+}
+
+func TestRouterLogProcessorRoutesByFormat(t *testing.T) {
+	p := newTestRouterProcessor(t, nil)
+
+	tests := []struct {
+		name         string
+		raw          string
+		wantLevel    entity.LogLevel
+		wantMessage  string
+		wantMetadata map[string]any
+	}{
+		{
+			name:         "json",
+			raw:          `  {"level": "error", "msg": "disk full", "ts": "2024-01-02T00:00:00Z", "disk": "sda"}`,
+			wantLevel:    entity.LogLevelError,
+			wantMessage:  "disk full",
+			wantMetadata: map[string]any{"disk": "sda"},
+		},
+		{
+			name:         "logfmt",
+			raw:          `level=warn msg=slow_query duration=3s`,
+			wantLevel:    entity.LogLevelWarn,
+			wantMessage:  "slow_query",
+			wantMetadata: map[string]any{"duration": "3s"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Process(entity.LogRecord{Source: "api", RawData: []byte(tt.raw)})
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if got.Level != tt.wantLevel || got.Message != tt.wantMessage {
+				t.Errorf("got level %v and message %q, want %v and %q", got.Level, got.Message, tt.wantLevel, tt.wantMessage)
+			}
+
+			if !reflect.DeepEqual(got.Metadata, tt.wantMetadata) {
+				t.Errorf("got metadata %v, want %v", got.Metadata, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestRouterLogProcessorNoMatchingBranch(t *testing.T) {
+	if _, err := newTestRouterProcessor(t, nil).Process(entity.LogRecord{RawData: []byte("plain text line")}); err == nil {
+		t.Error("got no error, want one for a record matching no branch")
+	}
+}
+
+func TestRouterLogProcessorFailedBranchFallsThrough(t *testing.T) {
+	p := newTestRouterProcessor(t, fakeDropProcessor{})
+
+	// The JSON branch matches by prefix but fails, so the record is handed to the fallback branch.
+	_, err := p.Process(entity.LogRecord{RawData: []byte("{not json")})
+	if !errors.Is(err, engine.ErrDropRecord) {
+		t.Errorf("got error %v, want the record dropped by the fallback branch", err)
+	}
+}
@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+type SampleLogProcessorConfig struct {
+	Name string `yaml:"-"`
+	// Rates maps log level names (case-insensitive) to the fraction of records kept, from 0 (none) to 1 (all).
+	// Records of levels not listed are kept.
+	Rates map[string]float64 `yaml:"rates"`
+}
+
+// SampleLogProcessor keeps a fraction of records per level, dropping the rest. Levels are set by preceding
+// processors, so it's usually configured after a parsing processor.
+// Records are sampled by a hash of their raw data, so sampling is reproducible (e.g. when replaying raw logs), and
+// identical records are either all kept or all dropped.
+type SampleLogProcessor struct {
+	cfg SampleLogProcessorConfig
+	// rates holds the rate of each level, indexed by level.
+	rates []float64
+}
+
+// NewSampleLogProcessor creates a new instance of SampleLogProcessor.
+func NewSampleLogProcessor(cfg SampleLogProcessorConfig) (*SampleLogProcessor, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("name cannot be empty")
+	}
+
+	rates := make([]float64, entity.LogLevelFatal+1)
+	for i := range rates {
+		rates[i] = 1
+	}
+
+	for name, rate := range cfg.Rates {
+		level, ok := entity.ParseLogLevel(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown log level: %s", name)
+		}
+
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("rate of level `%s` must be between 0 and 1", name)
+		}
+
+		rates[level] = rate
+	}
+
+	return &SampleLogProcessor{
+		cfg:   cfg,
+		rates: rates,
+	}, nil
+}
+
+func (p *SampleLogProcessor) Name() string {
+	return p.cfg.Name
+}
+
+// Process returns the record unchanged if it's sampled, or engine.ErrDropRecord otherwise.
+func (p *SampleLogProcessor) Process(record entity.LogRecord) (entity.LogRecord, error) {
+	if !record.Level.IsValid() {
+		return record, nil
+	}
+
+	rate := p.rates[record.Level]
+	if rate >= 1 {
+		return record, nil
+	}
+
+	if rate > 0 && float64(sampleHash(record.RawData)) < rate*math.MaxUint64 {
+		return record, nil
+	}
+
+	return record, engine.ErrDropRecord
+}
+
+// sampleHash hashes data using FNV-1a, followed by the finalizer of MurmurHash3 so similar records (e.g. differing in
+// a counter) are spread uniformly.
+func sampleHash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data) //nolint:errcheck
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
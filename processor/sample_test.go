@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/thisisjab/logzilla/engine"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// sampled reports whether p keeps the record, failing the test on errors other than engine.ErrDropRecord.
+func sampled(t *testing.T, p *SampleLogProcessor, record entity.LogRecord) bool {
+	t.Helper()
+
+	_, err := p.Process(record)
+	if err != nil && !errors.Is(err, engine.ErrDropRecord) {
+		t.Fatalf("cannot process record: %v", err)
+	}
+	return err == nil
+}
+
+func TestSampleLogProcessorKeepsFraction(t *testing.T) {
+	p, err := NewSampleLogProcessor(SampleLogProcessorConfig{
+		Name:  "sample",
+		Rates: map[string]float64{"debug": 0.1, "INFO": 0.5, "warn": 0, "error": 1},
+	})
+	if err != nil {
+		t.Fatalf("cannot create processor: %v", err)
+	}
+
+	const n = 20000
+
+	tests := []struct {
+		level entity.LogLevel
+		want  float64
+	}{
+		{level: entity.LogLevelDebug, want: 0.1},
+		{level: entity.LogLevelInfo, want: 0.5},
+		{level: entity.LogLevelWarn, want: 0},
+		{level: entity.LogLevelError, want: 1},
+		{level: entity.LogLevelFatal, want: 1},
+		{level: entity.LogLevelUnknown, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			kept := 0
+			for i := range n {
+				record := entity.LogRecord{Level: tt.level, RawData: fmt.Appendf(nil, `{"request_id": %d}`, i)}
+				if sampled(t, p, record) {
+					kept++
+				}
+			}
+
+			if got := float64(kept) / n; math.Abs(got-tt.want) > 0.02 {
+				t.Errorf("got %.3f of records kept, want about %.3f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleLogProcessorIsReproducible(t *testing.T) {
+	cfg := SampleLogProcessorConfig{Name: "sample", Rates: map[string]float64{"info": 0.5}}
+
+	// A second processor stands for a restarted engine replaying raw logs.
+	var processors []*SampleLogProcessor
+	for range 2 {
+		p, err := NewSampleLogProcessor(cfg)
+		if err != nil {
+			t.Fatalf("cannot create processor: %v", err)
+		}
+		processors = append(processors, p)
+	}
+
+	for i := range 100 {
+		record := entity.LogRecord{Level: entity.LogLevelInfo, RawData: fmt.Appendf(nil, "request %d served", i)}
+
+		want := sampled(t, processors[0], record)
+		for _, p := range processors {
+			for range 10 {
+				if got := sampled(t, p, record); got != want {
+					t.Fatalf("got record %q kept %v, want it always kept %v", record.RawData, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestNewSampleLogProcessorInvalidRates(t *testing.T) {
+	tests := []struct {
+		name  string
+		rates map[string]float64
+	}{
+		{name: "unknown level", rates: map[string]float64{"verbose": 0.5}},
+		{name: "negative rate", rates: map[string]float64{"info": -0.1}},
+		{name: "rate above one", rates: map[string]float64{"info": 1.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSampleLogProcessor(SampleLogProcessorConfig{Name: "sample", Rates: tt.rates}); err == nil {
+				t.Error("got no error, want one")
+			}
+		})
+	}
+}
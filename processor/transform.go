@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+type TransformLogProcessorConfig struct {
+	Name string `yaml:"-"`
+	// Rename maps metadata keys to their new names. If the new key already exists, it's overwritten.
+	Rename map[string]string `yaml:"rename"`
+	// Drop lists metadata keys to remove. Nested keys can be addressed using dots (e.g. `user.email`).
+	Drop []string `yaml:"drop"`
+	// Keep is an optional allow-list of top-level metadata keys. If set, any other key is removed.
+	Keep []string `yaml:"keep"`
+}
+
+// TransformLogProcessor renames and drops metadata keys of already processed logs.
+// Transforms are applied in this order: rename, drop, keep.
+type TransformLogProcessor struct {
+	cfg TransformLogProcessorConfig
+	// renameKeys holds keys of cfg.Rename in sorted order, so renames are applied deterministically.
+	renameKeys []string
+}
+
+// NewTransformLogProcessor creates a new instance of TransformLogProcessor.
+func NewTransformLogProcessor(cfg TransformLogProcessorConfig) (*TransformLogProcessor, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("name cannot be empty")
+	}
+
+	for from, to := range cfg.Rename {
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("rename keys cannot be empty")
+		}
+	}
+
+	return &TransformLogProcessor{
+		cfg:        cfg,
+		renameKeys: slices.Sorted(maps.Keys(cfg.Rename)),
+	}, nil
+}
+
+func (p *TransformLogProcessor) Name() string {
+	return p.cfg.Name
+}
+
+// Process applies configured transforms on metadata of the record. Other fields are left unchanged.
+func (p *TransformLogProcessor) Process(record entity.LogRecord) (entity.LogRecord, error) {
+	if record.Metadata == nil {
+		return record, nil
+	}
+
+	// Copy the metadata so the input record is never modified.
+	metadata := maps.Clone(record.Metadata)
+
+	for _, from := range p.renameKeys {
+		if val, ok := metadata[from]; ok {
+			delete(metadata, from)
+			metadata[p.cfg.Rename[from]] = val
+		}
+	}
+
+	for _, path := range p.cfg.Drop {
+		dropPath(metadata, strings.Split(path, "."))
+	}
+
+	if len(p.cfg.Keep) > 0 {
+		for key := range metadata {
+			if !slices.Contains(p.cfg.Keep, key) {
+				delete(metadata, key)
+			}
+		}
+	}
+
+	record.Metadata = metadata
+	return record, nil
+}
+
+// dropPath removes the value at the given path. Nested maps on the way are copied before modification,
+// since they may be shared with the original record.
+func dropPath(m map[string]any, path []string) {
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+
+	nested, ok := m[path[0]].(map[string]any)
+	if !ok {
+		return
+	}
+
+	nested = maps.Clone(nested)
+	dropPath(nested, path[1:])
+	m[path[0]] = nested
+}
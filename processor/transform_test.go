@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+func TestTransformLogProcessor(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      TransformLogProcessorConfig
+		metadata map[string]any
+		want     map[string]any
+	}{
+		{
+			name:     "rename",
+			cfg:      TransformLogProcessorConfig{Rename: map[string]string{"msg": "message", "absent": "present"}},
+			metadata: map[string]any{"msg": "hello", "status": 200},
+			want:     map[string]any{"message": "hello", "status": 200},
+		},
+		{
+			name:     "rename collision overwrites the existing key",
+			cfg:      TransformLogProcessorConfig{Rename: map[string]string{"msg": "message"}},
+			metadata: map[string]any{"msg": "new", "message": "old"},
+			want:     map[string]any{"message": "new"},
+		},
+		{
+			name: "drop top-level and nested keys",
+			cfg:  TransformLogProcessorConfig{Drop: []string{"password", "user.email", "user.address.street", "status.code", "missing.key"}},
+			metadata: map[string]any{"password": "secret", "status": 200, "user": map[string]any{
+				"name": "alice", "email": "a@b.c", "address": map[string]any{"street": "main", "city": "x"},
+			}},
+			want: map[string]any{"status": 200, "user": map[string]any{"name": "alice", "address": map[string]any{"city": "x"}}},
+		},
+		{
+			name:     "keep prunes other keys",
+			cfg:      TransformLogProcessorConfig{Keep: []string{"status", "user", "absent"}},
+			metadata: map[string]any{"status": 200, "user": map[string]any{"name": "alice"}, "trace_id": "abc"},
+			want:     map[string]any{"status": 200, "user": map[string]any{"name": "alice"}},
+		},
+		{
+			name: "rename, drop and keep are applied in order",
+			cfg: TransformLogProcessorConfig{
+				Rename: map[string]string{"usr": "user", "pwd": "password"},
+				Drop:   []string{"user.email"},
+				Keep:   []string{"user", "password"},
+			},
+			metadata: map[string]any{"usr": map[string]any{"name": "alice", "email": "a@b.c"}, "pwd": "secret", "status": 200},
+			want:     map[string]any{"user": map[string]any{"name": "alice"}, "password": "secret"},
+		},
+		{
+			name: "no metadata",
+			cfg:  TransformLogProcessorConfig{Rename: map[string]string{"msg": "message"}, Keep: []string{"message"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "transform"
+			p, err := NewTransformLogProcessor(tt.cfg)
+			if err != nil {
+				t.Fatalf("cannot create processor: %v", err)
+			}
+
+			got, err := p.Process(entity.LogRecord{Message: "unchanged", Metadata: tt.metadata})
+			if err != nil {
+				t.Fatalf("cannot process record: %v", err)
+			}
+
+			if !reflect.DeepEqual(got.Metadata, tt.want) {
+				t.Errorf("got metadata %v, want %v", got.Metadata, tt.want)
+			}
+			if got.Message != "unchanged" {
+				t.Errorf("got message %q, want it unchanged", got.Message)
+			}
+		})
+	}
+}
+
+func TestTransformLogProcessorKeepsInputRecord(t *testing.T) {
+	p, err := NewTransformLogProcessor(TransformLogProcessorConfig{
+		Name:   "transform",
+		Rename: map[string]string{"msg": "message"},
+		Drop:   []string{"user.email"},
+	})
+	if err != nil {
+		t.Fatalf("cannot create processor: %v", err)
+	}
+
+	metadata := map[string]any{"msg": "hello", "user": map[string]any{"email": "a@b.c"}}
+	if _, err := p.Process(entity.LogRecord{Metadata: metadata}); err != nil {
+		t.Fatalf("cannot process record: %v", err)
+	}
+
+	if want := map[string]any{"msg": "hello", "user": map[string]any{"email": "a@b.c"}}; !reflect.DeepEqual(metadata, want) {
+		t.Errorf("got input metadata %v, want it unchanged", metadata)
+	}
+}
+
+func TestNewTransformLogProcessorInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TransformLogProcessorConfig
+	}{
+		{name: "no name", cfg: TransformLogProcessorConfig{}},
+		{name: "empty rename source", cfg: TransformLogProcessorConfig{Name: "transform", Rename: map[string]string{"": "message"}}},
+		{name: "empty rename target", cfg: TransformLogProcessorConfig{Name: "transform", Rename: map[string]string{"msg": ""}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTransformLogProcessor(tt.cfg); err == nil {
+				t.Error("got no error, want one")
+			}
+		})
+	}
+}
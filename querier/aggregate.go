@@ -0,0 +1,39 @@
+package querier
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+// Functions supported by Querier.Aggregate.
+const (
+	AggregateMin = "min"
+	AggregateMax = "max"
+	AggregateAvg = "avg"
+	AggregateSum = "sum"
+)
+
+var aggregateFunctions = []string{AggregateMin, AggregateMax, AggregateAvg, AggregateSum}
+
+// ValidateAggregate checks that fn is a supported aggregate function and field is a metadata path. Queriers still
+// check that the path is allowed for filtering.
+func ValidateAggregate(fn, field string) error {
+	errs := fault.FieldErrorsMetadata{}
+
+	if !slices.Contains(aggregateFunctions, fn) {
+		errs["function"] = []string{fmt.Sprintf("Expected one of %s.", strings.Join(aggregateFunctions, ", "))}
+	}
+
+	if !IsMetadataPath(field) {
+		errs["field"] = []string{"Only metadata paths can be aggregated."}
+	}
+
+	if len(errs) > 0 {
+		return fault.New(fault.BadInputCode, "").WithMetadata(errs)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package querier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/fault"
+)
+
+// Cursor points at the last record of a page. The next page starts right after it in the direction of the query,
+// using the timestamp and the id of the record as the key. Cursors are only meaningful for queries sorted by time.
+type Cursor struct {
+	Timestamp time.Time `json:"ts"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// NewCursor creates a cursor pointing at the record.
+func NewCursor(record entity.LogRecord) Cursor {
+	return Cursor{Timestamp: record.Timestamp, ID: record.ID}
+}
+
+// Encode returns the opaque string representation of the cursor.
+func (c Cursor) Encode() string {
+	js, _ := json.Marshal(c) //nolint:errcheck
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// EncodeSigned returns the representation of the cursor followed by its HMAC-SHA256 signature, so clients can't
+// forge cursors without knowing the secret.
+func (c Cursor) EncodeSigned(secret []byte) string {
+	payload := c.Encode()
+	return payload + "." + base64.RawURLEncoding.EncodeToString(cursorSignature(payload, secret))
+}
+
+// DecodeCursor decodes a cursor created by Cursor.Encode.
+func DecodeCursor(value string) (Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Cursor{}, invalidCursorError()
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(js, &c); err != nil || c.Timestamp.IsZero() {
+		return Cursor{}, invalidCursorError()
+	}
+
+	return c, nil
+}
+
+// DecodeSignedCursor decodes a cursor created by Cursor.EncodeSigned, rejecting it if it isn't signed with secret.
+func DecodeSignedCursor(value string, secret []byte) (Cursor, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return Cursor{}, invalidCursorError()
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, cursorSignature(payload, secret)) {
+		return Cursor{}, invalidCursorError()
+	}
+
+	return DecodeCursor(payload)
+}
+
+func cursorSignature(payload string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload)) //nolint:errcheck
+	return mac.Sum(nil)
+}
+
+func invalidCursorError() error {
+	return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{"cursor": []string{"Invalid cursor."}})
+}
+
+// ValidateCursorSort rejects a cursor if the records of the query are sorted by other fields than time, either by the
+// sort fields of the query or by defaultSort, the sort applied by the querier to queries without sort fields. Cursors
+// are keyed by time, so records would be skipped or repeated across pages otherwise.
+func (r Query) ValidateCursorSort(defaultSort []SortField) error {
+	if r.Cursor == "" || (len(r.Sort) == 0 && len(defaultSort) == 0) {
+		return nil
+	}
+
+	return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+		"cursor": []string{"Cursors can only be used with results sorted by time."},
+	})
+}
+
+// GetCursorWindow returns the time window of the query like GetTimeWindow, except that the cursor, if any, takes
+// precedence over the bound the search starts from: the lower bound when searching forward, the upper one otherwise.
+// Cursors of queries with sort fields are rejected (see ValidateCursorSort).
+func (r Query) GetCursorWindow() (time.Time, time.Time, *Cursor, error) {
+	start, end := r.GetTimeWindow()
+	if r.Cursor == "" {
+		return start, end, nil, nil
+	}
+
+	if err := r.ValidateCursorSort(nil); err != nil {
+		return time.Time{}, time.Time{}, nil, err
+	}
+
+	c, err := DecodeCursor(r.Cursor)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, err
+	}
+
+	if r.GetQueryDirection() == QueryDirectionBackward {
+		end = c.Timestamp
+	} else {
+		start = c.Timestamp
+	}
+
+	return start, end, &c, nil
+}
@@ -0,0 +1,190 @@
+package querier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+func TestGetCursorWindowCursorOverridesStart(t *testing.T) {
+	cursor := Cursor{Timestamp: testStart.Add(30 * time.Minute), ID: uuid.New()}
+
+	tests := []struct {
+		name      string
+		query     Query
+		wantStart time.Time
+		wantEnd   time.Time
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "forward",
+			query:     Query{Start: testStart, End: testEnd, Cursor: cursor.Encode()},
+			wantStart: cursor.Timestamp,
+			wantEnd:   testEnd,
+			wantWhere: "timestamp >= ? AND timestamp < ? AND (timestamp, id) > (?, ?)",
+			wantArgs:  []any{cursor.Timestamp, testEnd, cursor.Timestamp, cursor.ID},
+		},
+		{
+			name:      "backward",
+			query:     Query{Start: testEnd, End: testStart, Cursor: cursor.Encode()},
+			wantStart: testStart,
+			wantEnd:   cursor.Timestamp,
+			wantWhere: "timestamp > ? AND timestamp <= ? AND (timestamp, id) < (?, ?)",
+			wantArgs:  []any{testStart, cursor.Timestamp, cursor.Timestamp, cursor.ID},
+		},
+		{
+			name:      "forward without end",
+			query:     Query{Start: testStart, Cursor: cursor.Encode()},
+			wantStart: cursor.Timestamp,
+			wantWhere: "timestamp >= ? AND (timestamp, id) > (?, ?)",
+			wantArgs:  []any{cursor.Timestamp, cursor.Timestamp, cursor.ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, c, err := tt.query.GetCursorWindow()
+			if err != nil {
+				t.Fatalf("cannot get cursor window: %v", err)
+			}
+
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("got window %v to %v, want %v to %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+
+			if c == nil || *c != cursor {
+				t.Errorf("got cursor %v, want %v", c, cursor)
+			}
+
+			where, args, err := newTestBuilder().buildWhereClause(tt.query)
+			if err != nil {
+				t.Fatalf("cannot build where clause: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMalformedCursorIsBadInput(t *testing.T) {
+	tests := map[string]string{
+		"not base64":        "not base64!",
+		"not json":          "bm90IGpzb24",
+		"missing timestamp": Cursor{ID: uuid.New()}.Encode(),
+	}
+
+	for name, cursor := range tests {
+		t.Run(name, func(t *testing.T) {
+			q := Query{Start: testStart, Limit: 10, Cursor: cursor}
+
+			assertBadInput(t, q.Validate())
+
+			_, _, _, err := q.GetCursorWindow()
+			assertBadInput(t, err)
+
+			_, err = newTestBuilder().Build(q)
+			assertBadInput(t, err)
+		})
+	}
+}
+
+func TestSignedCursorRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+	cursor := Cursor{Timestamp: testStart, ID: uuid.New()}
+
+	encoded := cursor.EncodeSigned(secret)
+	if strings.ContainsAny(encoded, "+/=") {
+		t.Errorf("got cursor %q, want it URL-safe", encoded)
+	}
+
+	decoded, err := DecodeSignedCursor(encoded, secret)
+	if err != nil {
+		t.Fatalf("cannot decode signed cursor: %v", err)
+	}
+
+	if !decoded.Timestamp.Equal(cursor.Timestamp) || decoded.ID != cursor.ID {
+		t.Errorf("got cursor %v, want %v", decoded, cursor)
+	}
+}
+
+func TestSignedCursorTampered(t *testing.T) {
+	secret := []byte("secret")
+	cursor := Cursor{Timestamp: testStart, ID: uuid.New()}
+	encoded := cursor.EncodeSigned(secret)
+	payload, signature, _ := strings.Cut(encoded, ".")
+
+	forged := Cursor{Timestamp: testStart.Add(-24 * time.Hour), ID: cursor.ID}
+
+	tests := map[string]string{
+		"forged payload":     forged.Encode() + "." + signature,
+		"other secret":       cursor.EncodeSigned([]byte("other")),
+		"missing signature":  payload,
+		"truncated":          encoded[:len(encoded)-2],
+		"invalid signature":  payload + ".!!!",
+		"unsigned":           cursor.Encode(),
+		"flipped first byte": string(encoded[0]^1) + encoded[1:],
+	}
+
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeSignedCursor(value, secret)
+			assertBadInput(t, err)
+		})
+	}
+}
+
+func TestCursorRequiresTimeSort(t *testing.T) {
+	cursor := NewCursor(entity.LogRecord{ID: uuid.New(), Timestamp: testStart}).Encode()
+	sorted := []SortField{{Name: "source"}}
+
+	tests := []struct {
+		name        string
+		query       Query
+		defaultSort []SortField
+		wantErr     bool
+	}{
+		{name: "sorted by time", query: Query{Start: testEnd, End: testStart, Cursor: cursor}},
+		{name: "sort fields without cursor", query: Query{Start: testEnd, End: testStart, Sort: sorted}, defaultSort: sorted},
+		{name: "sort fields", query: Query{Start: testEnd, End: testStart, Cursor: cursor, Sort: sorted}, wantErr: true},
+		{name: "explicit time sort", query: Query{Start: testEnd, End: testStart, Cursor: cursor, Sort: []SortField{{Name: "timestamp", IsDescending: true}}}, wantErr: true},
+		{name: "default sort", query: Query{Start: testEnd, End: testStart, Cursor: cursor}, defaultSort: sorted, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Limit = 10
+
+			_, err := NewSQLQueryBuilder(SQLOptions{TableName: "logs", DefaultSort: tt.defaultSort}).Build(tt.query)
+			if tt.wantErr {
+				assertBadInput(t, err)
+			} else if err != nil {
+				t.Fatalf("cannot build query: %v", err)
+			}
+
+			// Sort fields of the query are rejected whatever the querier, before the query reaches it.
+			hasSort := len(tt.query.Sort) > 0 && tt.query.Cursor != ""
+			if err := tt.query.Validate(); hasSort {
+				assertBadInput(t, err)
+			} else if err != nil {
+				t.Errorf("got error %v, want the query valid", err)
+			}
+
+			if _, _, _, err := tt.query.GetCursorWindow(); hasSort {
+				assertBadInput(t, err)
+			} else if err != nil {
+				t.Errorf("got error %v, want the cursor window", err)
+			}
+		})
+	}
+}
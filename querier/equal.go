@@ -0,0 +1,59 @@
+package querier
+
+import (
+	"reflect"
+	"slices"
+)
+
+// Equal reports whether both queries are the same, including their node trees.
+// Times are compared using time.Time.Equal, and sort and projected fields are order-sensitive.
+func (q *Query) Equal(other *Query) bool {
+	if q == nil || other == nil {
+		return q == other
+	}
+
+	return q.Start.Equal(other.Start) &&
+		q.End.Equal(other.End) &&
+		boolPtrEqual(q.StartInclusive, other.StartInclusive) &&
+		boolPtrEqual(q.EndInclusive, other.EndInclusive) &&
+		q.Limit == other.Limit &&
+		q.Direction == other.Direction &&
+		q.Cursor == other.Cursor &&
+		q.TimeZone == other.TimeZone &&
+		slices.Equal(q.Sort, other.Sort) &&
+		slices.Equal(q.Fields, other.Fields) &&
+		nodesEqual(q.Node, other.Node)
+}
+
+// boolPtrEqual reports whether both are unset, or set to the same value.
+func boolPtrEqual(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// nodesEqual recursively compares two node trees.
+func nodesEqual(a, b QueryNode) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch a := a.(type) {
+	case AndNode:
+		b, ok := b.(AndNode)
+		return ok && slices.EqualFunc(a.Children, b.Children, nodesEqual)
+	case OrNode:
+		b, ok := b.(OrNode)
+		return ok && slices.EqualFunc(a.Children, b.Children, nodesEqual)
+	case NotNode:
+		b, ok := b.(NotNode)
+		return ok && nodesEqual(a.Child, b.Child)
+	case ComparisonNode:
+		b, ok := b.(ComparisonNode)
+		// Values may be slices (e.g. for OperatorIn), so they're deep compared.
+		return ok && a.FieldName == b.FieldName && a.Operator == b.Operator && reflect.DeepEqual(a.Value, b.Value)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+package querier
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryEqual(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	base := func() *Query {
+		return &Query{
+			Start:  start,
+			End:    start.Add(time.Hour),
+			Limit:  10,
+			Cursor: "cursor",
+			Sort:   []SortField{{Name: "level", IsDescending: true}, {Name: "source"}},
+			Node: AndNode{Children: []QueryNode{
+				ComparisonNode{FieldName: "source", Operator: OperatorEq, Value: "api"},
+				OrNode{Children: []QueryNode{
+					ComparisonNode{FieldName: "level", Operator: OperatorIn, Value: []any{"error", "warn"}},
+					NotNode{Child: ComparisonNode{FieldName: "metadata.status", Operator: OperatorGte, Value: 500}},
+				}},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(q *Query)
+		want   bool
+	}{
+		{name: "same", modify: func(*Query) {}, want: true},
+		{name: "same instant in another zone", modify: func(q *Query) { q.Start = q.Start.In(time.FixedZone("UTC+1", 3600)) }, want: true},
+		{name: "start", modify: func(q *Query) { q.Start = q.Start.Add(time.Second) }, want: false},
+		{name: "end", modify: func(q *Query) { q.End = time.Time{} }, want: false},
+		{name: "limit", modify: func(q *Query) { q.Limit = 11 }, want: false},
+		{name: "cursor", modify: func(q *Query) { q.Cursor = "" }, want: false},
+		{name: "start inclusivity", modify: func(q *Query) { q.StartInclusive = ptr(false) }, want: false},
+		{name: "sort order", modify: func(q *Query) { q.Sort[0], q.Sort[1] = q.Sort[1], q.Sort[0] }, want: false},
+		{name: "sort direction", modify: func(q *Query) { q.Sort[0].IsDescending = false }, want: false},
+		{name: "missing node", modify: func(q *Query) { q.Node = nil }, want: false},
+		{
+			name:   "node type mismatch",
+			modify: func(q *Query) { q.Node = OrNode{Children: q.Node.(AndNode).Children} },
+			want:   false,
+		},
+		{
+			name: "nested node type mismatch",
+			modify: func(q *Query) {
+				or := q.Node.(AndNode).Children[1].(OrNode)
+				or.Children[1] = or.Children[1].(NotNode).Child
+			},
+			want: false,
+		},
+		{
+			name: "nested operator",
+			modify: func(q *Query) {
+				not := q.Node.(AndNode).Children[1].(OrNode).Children[1].(NotNode)
+				cmp := not.Child.(ComparisonNode)
+				cmp.Operator = OperatorGt
+				q.Node.(AndNode).Children[1].(OrNode).Children[1] = NotNode{Child: cmp}
+			},
+			want: false,
+		},
+		{
+			name: "list value order",
+			modify: func(q *Query) {
+				q.Node.(AndNode).Children[1].(OrNode).Children[0] = ComparisonNode{FieldName: "level", Operator: OperatorIn, Value: []any{"warn", "error"}}
+			},
+			want: false,
+		},
+		{
+			name: "list value length",
+			modify: func(q *Query) {
+				q.Node.(AndNode).Children[1].(OrNode).Children[0] = ComparisonNode{FieldName: "level", Operator: OperatorIn, Value: []any{"error"}}
+			},
+			want: false,
+		},
+		{
+			name: "value type",
+			modify: func(q *Query) {
+				q.Node.(AndNode).Children[1].(OrNode).Children[1] = NotNode{Child: ComparisonNode{FieldName: "metadata.status", Operator: OperatorGte, Value: "500"}}
+			},
+			want: false,
+		},
+		{
+			name: "extra child",
+			modify: func(q *Query) {
+				and := q.Node.(AndNode)
+				and.Children = append(and.Children, AndNode{})
+				q.Node = and
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := base(), base()
+			tt.modify(b)
+
+			if got := a.Equal(b); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			if got := b.Equal(a); got != tt.want {
+				t.Errorf("got %v comparing the other way around, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryEqualNil(t *testing.T) {
+	var a, b *Query
+	if !a.Equal(b) {
+		t.Error("got nil queries not equal")
+	}
+
+	if a.Equal(&Query{}) || (&Query{}).Equal(b) {
+		t.Error("got a nil query equal to an empty one")
+	}
+}
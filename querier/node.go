@@ -1,5 +1,7 @@
 package querier
 
+import "slices"
+
 // QueryNode is the interface that all nodes in the query tree must implement.
 // It uses a private marker method to ensure only types defined in this
 // package can be used as nodes, creating a controlled "sum type" behavior.
@@ -33,6 +35,23 @@ type NotNode struct {
 
 func (n NotNode) queryNode() {}
 
+// IsEmptyNode reports whether the node imposes no condition, i.e. it's a logical group without comparisons, such as an
+// AndNode without children. Empty nodes are collapsed by drivers: the whole tree matches everything if it's empty, and
+// empty children of logical groups are ignored, so `OR(x, AND())` is the same as `x`.
+// NotNodes are never empty: the negation of an empty node matches nothing, so `NOT(AND())` is rendered as `1 = 0`.
+func IsEmptyNode(node QueryNode) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case AndNode:
+		return !slices.ContainsFunc(n.Children, func(c QueryNode) bool { return !IsEmptyNode(c) })
+	case OrNode:
+		return !slices.ContainsFunc(n.Children, func(c QueryNode) bool { return !IsEmptyNode(c) })
+	default:
+		return false
+	}
+}
+
 // ComparisonOperator defines the type of comparison to be performed
 // in an expression (e.g., equality, greater than).
 type ComparisonOperator uint8
@@ -56,6 +75,13 @@ const (
 	OperatorILike
 	// OperatorIn checks if the field is in the list of values.
 	OperatorIn
+	// OperatorNotIn checks if the field is not in the list of values.
+	OperatorNotIn
+	// OperatorNotLike checks if the field is not like the value.
+	OperatorNotLike
+	// OperatorMatch checks if the field matches the regular expression (RE2 syntax) value.
+	// Unlike LIKE, the expression is not anchored, so it matches anywhere in the field.
+	OperatorMatch
 )
 
 // ComparisonNode is a leaf node in the query tree.
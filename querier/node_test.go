@@ -0,0 +1,31 @@
+package querier
+
+import "testing"
+
+func TestIsEmptyNode(t *testing.T) {
+	cmp := ComparisonNode{FieldName: "source", Operator: OperatorEq, Value: "api"}
+
+	tests := []struct {
+		name string
+		node QueryNode
+		want bool
+	}{
+		{name: "nil", node: nil, want: true},
+		{name: "empty and", node: AndNode{}, want: true},
+		{name: "empty or", node: OrNode{}, want: true},
+		{name: "nested empty groups", node: AndNode{Children: []QueryNode{OrNode{}, AndNode{Children: []QueryNode{AndNode{}}}}}, want: true},
+		{name: "comparison", node: cmp, want: false},
+		{name: "and with one empty child", node: AndNode{Children: []QueryNode{AndNode{}, cmp}}, want: false},
+		{name: "deeply nested comparison", node: OrNode{Children: []QueryNode{AndNode{Children: []QueryNode{OrNode{Children: []QueryNode{cmp}}}}}}, want: false},
+		{name: "not of empty", node: NotNode{Child: AndNode{}}, want: false},
+		{name: "group of not of empty", node: AndNode{Children: []QueryNode{NotNode{}}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmptyNode(tt.node); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package querier
+
+import (
+	"strings"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+const metadataPathPrefix = "metadata."
+
+// IsMetadataPath reports whether field addresses a key inside metadata (e.g. `metadata.user_id`).
+func IsMetadataPath(field string) bool {
+	return strings.HasPrefix(field, metadataPathPrefix) && len(field) > len(metadataPathPrefix)
+}
+
+// MetadataKey returns the metadata key addressed by a metadata path, removing quotes if the key is quoted
+// (e.g. `metadata."user id"`).
+func MetadataKey(path string) string {
+	key := strings.TrimPrefix(path, metadataPathPrefix)
+	if len(key) >= 2 && strings.HasPrefix(key, `"`) && strings.HasSuffix(key, `"`) {
+		key = key[1 : len(key)-1]
+	}
+	return key
+}
+
+// Project returns only the requested fields of the record. Metadata paths are returned under their dotted name.
+// Metadata keys absent from the record are returned as nil.
+func Project(record entity.LogRecord, fields []string) map[string]any {
+	res := make(map[string]any, len(fields))
+
+	for _, f := range fields {
+		switch f {
+		case "id":
+			res[f] = record.ID
+		case "source":
+			res[f] = record.Source
+		case "timestamp":
+			res[f] = record.Timestamp
+		case "level":
+			res[f] = record.Level
+		case "message":
+			res[f] = record.Message
+		case "metadata":
+			res[f] = record.Metadata
+		default:
+			if IsMetadataPath(f) {
+				res[f] = record.Metadata[MetadataKey(f)]
+			}
+		}
+	}
+
+	return res
+}
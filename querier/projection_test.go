@@ -0,0 +1,44 @@
+package querier
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+func TestProject(t *testing.T) {
+	record := entity.LogRecord{ID: uuid.New(), Source: "api", Level: entity.LogLevelWarn, Timestamp: testStart, Message: "slow query",
+		Metadata: map[string]any{"duration": "3s", "user id": 7}}
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   map[string]any
+	}{
+		{
+			name:   "columns",
+			fields: []string{"timestamp", "message"},
+			want:   map[string]any{"timestamp": testStart, "message": "slow query"},
+		},
+		{
+			name:   "metadata paths",
+			fields: []string{"id", "metadata.duration", `metadata."user id"`},
+			want:   map[string]any{"id": record.ID, "metadata.duration": "3s", `metadata."user id"`: 7},
+		},
+		{
+			name:   "missing metadata key",
+			fields: []string{"level", "metadata.region"},
+			want:   map[string]any{"level": entity.LogLevelWarn, "metadata.region": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Project(record, tt.fields); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/thisisjab/logzilla/entity"
 	"github.com/thisisjab/logzilla/fault"
 )
@@ -16,17 +17,123 @@ const (
 	QueryDirectionBackward QueryDirection = "backward"
 )
 
+// DefaultQueryTimeout is used by queriers when a request has no timeout.
+const DefaultQueryTimeout = 10 * time.Second
+
 type QueryRequest struct {
 	Query Query
+
+	// Timeout optionally limits how long the querier may take to execute the request. Defaults to DefaultQueryTimeout.
+	Timeout time.Duration
+
+	// CountOnly makes Query only count the records matching the query, like Count, without fetching them.
+	// The response then has Count set and no records.
+	CountOnly bool
+}
+
+// GetTimeout returns the timeout of the request, or DefaultQueryTimeout if it has none.
+func (r QueryRequest) GetTimeout() time.Duration {
+	if r.Timeout <= 0 {
+		return DefaultQueryTimeout
+	}
+	return r.Timeout
 }
 
 type QueryResponse struct {
 	Records []entity.LogRecord
 	Cursor  string
+
+	// DefaultSort is the sort applied by the querier to queries without sort fields, if any. Records sorted by it
+	// can't be paginated using cursors (see Query.ValidateCursorSort).
+	DefaultSort []SortField
+
+	// Count is the number of records matching the query. It's only set if the request is CountOnly.
+	Count int64
 }
 
 type Querier interface {
 	Query(ctx context.Context, req QueryRequest) (QueryResponse, error)
+
+	// Count returns the number of records matching the query, ignoring its limit and sort.
+	Count(ctx context.Context, req QueryRequest) (int64, error)
+
+	// GroupByCount returns the number of records matching the query per distinct value of field,
+	// sorted by count in descending order.
+	GroupByCount(ctx context.Context, req QueryRequest, field string) ([]GroupCount, error)
+
+	// Distinct returns up to the query's limit distinct values of field in the records matching the query, sorted in
+	// ascending order. Field may be a metadata path, whose values are returned as JSON unless they're strings.
+	Distinct(ctx context.Context, req QueryRequest, field string) ([]string, error)
+
+	// Aggregate applies fn (see ValidateAggregate) to the numeric values of a metadata path in the records matching
+	// the query, ignoring its limit and sort. Zero is returned if no record has a value.
+	Aggregate(ctx context.Context, req QueryRequest, fn, field string) (float64, error)
+
+	// Get returns the record with the given id, or an error with fault.NotFoundCode if there's none.
+	Get(ctx context.Context, id uuid.UUID) (entity.LogRecord, error)
+}
+
+// LogNotFoundError is returned by Get when no record has the id.
+func LogNotFoundError() error {
+	return fault.New(fault.NotFoundCode, "Log not found.")
+}
+
+// Explainer is optionally implemented by queriers which can show the query they execute for a request.
+type Explainer interface {
+	Explain(req QueryRequest) (Explanation, error)
+}
+
+// Explanation is the query a querier executes for a request, in the querier's own language (e.g. SQL).
+type Explanation struct {
+	Query    string   `json:"query"`
+	Args     []any    `json:"args,omitempty"`
+	ArgTypes []string `json:"arg_types,omitempty"`
+	Plan     Plan     `json:"plan"`
+}
+
+// Plan describes the effective time window and order of a query, after swapping Start and End of backward
+// queries and applying the cursor, so clients can predict the order of results.
+type Plan struct {
+	// LowerBound is nil if the window has no lower bound, and so is UpperBound.
+	LowerBound *time.Time     `json:"lower_bound"`
+	UpperBound *time.Time     `json:"upper_bound"`
+	Direction  QueryDirection `json:"direction"`
+	// OrderBy is the final order of results, in the querier's own language.
+	OrderBy string `json:"order_by"`
+}
+
+// NewPlan creates the plan of the query, ordered by orderBy.
+func NewPlan(q Query, orderBy string) (Plan, error) {
+	lower, upper, _, err := q.GetCursorWindow()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	p := Plan{Direction: q.GetQueryDirection(), OrderBy: orderBy}
+	if !lower.IsZero() {
+		p.LowerBound = &lower
+	}
+	if !upper.IsZero() {
+		p.UpperBound = &upper
+	}
+
+	return p, nil
+}
+
+// NewExplanation creates an Explanation, noting the type of each argument.
+func NewExplanation(query string, args []any) Explanation {
+	argTypes := make([]string, len(args))
+	for i, a := range args {
+		argTypes[i] = fmt.Sprintf("%T", a)
+	}
+
+	return Explanation{Query: query, Args: args, ArgTypes: argTypes}
+}
+
+// GroupCount is the number of records sharing the same value of a field.
+type GroupCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
 }
 
 // Query defines the parameters for searching and filtering logs.
@@ -38,20 +145,40 @@ type Query struct {
 	// they are applied in the order they appear in the slice.
 	Sort []SortField `json:"sort_fields"`
 
-	// Start defines the beginning of the time range (inclusive).
+	// Start defines the beginning of the time range (inclusive, unless StartInclusive is false).
 	// This field is required for all queries.
+	// In JSON, both Start and End also accept relative times such as "now" or "-1h".
 	Start time.Time `json:"start"`
 
-	// End defines the end of the time range (exclusive).
-	// If End is before Start, the query is executed in backward chronological order.
+	// End defines the end of the time range (exclusive, unless EndInclusive is true).
+	// If End is before Start, the query is executed in backward chronological order, and End remains exclusive.
 	End time.Time `json:"end"`
 
+	// StartInclusive and EndInclusive optionally override whether records at Start and End are returned. They default
+	// to an inclusive Start and an exclusive End (see GetBoundsExclusivity).
+	StartInclusive *bool `json:"start_inclusive,omitempty"`
+	EndInclusive   *bool `json:"end_inclusive,omitempty"`
+
 	// Limit specifies the maximum number of records to return.
 	// Must be between 1 and 1000.
 	Limit int `json:"limit"`
 
+	// Fields optionally limits the returned fields. Metadata keys can be selected using paths like `metadata.user_id`.
+	// If empty, all fields are returned.
+	Fields []string `json:"fields,omitempty"`
+
+	// Direction explicitly sets the chronological order of the results. If empty, it's inferred from Start and End
+	// (see GetQueryDirection). The time window is between the earlier and the later of Start and End, except for
+	// backward queries without End, which return the latest records before Start (see GetTimeWindow).
+	Direction QueryDirection `json:"direction,omitempty"`
+
+	// TimeZone is the IANA name of the zone timestamps without a zone are interpreted in when decoding Start and End
+	// from JSON (e.g. "America/New_York"). Defaults to UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+
 	// Cursor is an opaque string used to resume a search from a specific point.
-	// When provided, it overrides the starting point of the search.
+	// When provided, it overrides the starting point of the search (see GetCursorWindow). Cursors can only be used
+	// with results sorted by time, i.e. without sort fields.
 	Cursor string `json:"cursor,omitempty"`
 }
 
@@ -64,15 +191,63 @@ type SortField struct {
 }
 
 // GetQueryDirection determines the temporal direction of the search.
-// It returns QueryDirectionBackward if the End timestamp is earlier than the Start,
-// indicating the user is searching "into the past."
+// It returns Direction if set. Otherwise, it returns QueryDirectionBackward if the End timestamp is earlier
+// than the Start, indicating the user is searching "into the past."
 func (r Query) GetQueryDirection() QueryDirection {
+	if r.Direction != "" {
+		return r.Direction
+	}
+
 	if !r.End.IsZero() && r.End.Before(r.Start) {
 		return QueryDirectionBackward
 	}
 	return QueryDirectionForward
 }
 
+// GetTimeWindow returns the earlier and the later of Start and End. If End is zero, the window has no upper bound
+// and the returned upper bound is zero, unless the query is explicitly backward: the window then ends at Start and
+// has no lower bound, so the latest records before Start are returned.
+func (r Query) GetTimeWindow() (time.Time, time.Time) {
+	if r.End.IsZero() && r.GetQueryDirection() == QueryDirectionBackward {
+		return time.Time{}, r.Start
+	}
+
+	if r.End.IsZero() || r.Start.Before(r.End) {
+		return r.Start, r.End
+	}
+	return r.End, r.Start
+}
+
+// GetBoundsExclusivity reports whether the lower and the upper bound of the time window (see GetCursorWindow) are
+// exclusive. By default, the bound set by Start is inclusive and the one set by End is exclusive, whichever of them is
+// earlier, so a window with equal Start and End is empty. StartInclusive and EndInclusive override this. Bounds
+// replaced by the cursor are inclusive, since records up to the cursor are skipped by comparing their ids too.
+func (r Query) GetBoundsExclusivity() (bool, bool) {
+	startExclusive := r.StartInclusive != nil && !*r.StartInclusive
+	endExclusive := r.EndInclusive == nil || !*r.EndInclusive
+
+	var lower, upper bool
+	switch {
+	case r.End.IsZero() && r.GetQueryDirection() == QueryDirectionBackward:
+		// Start is the upper bound (see GetTimeWindow).
+		upper = startExclusive
+	case r.End.IsZero() || r.Start.Before(r.End):
+		lower, upper = startExclusive, endExclusive
+	default:
+		lower, upper = endExclusive, startExclusive
+	}
+
+	if r.Cursor != "" {
+		if r.GetQueryDirection() == QueryDirectionBackward {
+			upper = false
+		} else {
+			lower = false
+		}
+	}
+
+	return lower, upper
+}
+
 func (r Query) Validate() error {
 	// MAYBE: In future we may want to read these from configs.
 	const LimitMin = 1
@@ -90,5 +265,21 @@ func (r Query) Validate() error {
 		return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{"start": []string{"Field is required."}})
 	}
 
+	if r.Cursor != "" {
+		if _, err := DecodeCursor(r.Cursor); err != nil {
+			return err
+		}
+	}
+
+	if err := r.ValidateCursorSort(nil); err != nil {
+		return err
+	}
+
+	switch r.Direction {
+	case "", QueryDirectionForward, QueryDirectionBackward:
+	default:
+		return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{"direction": []string{fmt.Sprintf("Expected `%s` or `%s`.", QueryDirectionForward, QueryDirectionBackward)}})
+	}
+
 	return nil
 }
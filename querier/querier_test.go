@@ -0,0 +1,91 @@
+package querier
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryGetQueryDirection(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     Query
+		want      QueryDirection
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{name: "forward", query: Query{Start: testStart, End: testEnd}, want: QueryDirectionForward, wantStart: testStart, wantEnd: testEnd},
+		{name: "inferred backward", query: Query{Start: testEnd, End: testStart}, want: QueryDirectionBackward, wantStart: testStart, wantEnd: testEnd},
+		{
+			name:      "explicitly backward",
+			query:     Query{Start: testStart, End: testEnd, Direction: QueryDirectionBackward},
+			want:      QueryDirectionBackward,
+			wantStart: testStart,
+			wantEnd:   testEnd,
+		},
+		{
+			name:      "explicitly forward with swapped bounds",
+			query:     Query{Start: testEnd, End: testStart, Direction: QueryDirectionForward},
+			want:      QueryDirectionForward,
+			wantStart: testStart,
+			wantEnd:   testEnd,
+		},
+		{name: "no end", query: Query{Start: testStart}, want: QueryDirectionForward, wantStart: testStart},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.GetQueryDirection(); got != tt.want {
+				t.Errorf("got direction %q, want %q", got, tt.want)
+			}
+
+			if start, end := tt.query.GetTimeWindow(); !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("got window from %v to %v, want from %v to %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestQueryValidateDirection(t *testing.T) {
+	q := Query{Start: testStart, Limit: 10, Direction: "sideways"}
+	assertBadInput(t, q.Validate())
+}
+
+func TestQueryRequestGetTimeout(t *testing.T) {
+	if got := (QueryRequest{}).GetTimeout(); got != DefaultQueryTimeout {
+		t.Errorf("got timeout %v without one requested, want %v", got, DefaultQueryTimeout)
+	}
+
+	if got := (QueryRequest{Timeout: time.Minute}).GetTimeout(); got != time.Minute {
+		t.Errorf("got timeout %v, want %v", got, time.Minute)
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         Query
+		wantLower     time.Time
+		wantUpper     *time.Time
+		wantDirection QueryDirection
+	}{
+		{name: "forward", query: Query{Start: testStart, End: testEnd}, wantLower: testStart, wantUpper: &testEnd, wantDirection: QueryDirectionForward},
+		{name: "backward with swapped bounds", query: Query{Start: testEnd, End: testStart}, wantLower: testStart, wantUpper: &testEnd, wantDirection: QueryDirectionBackward},
+		{name: "no upper bound", query: Query{Start: testStart}, wantLower: testStart, wantDirection: QueryDirectionForward},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPlan(tt.query, "ORDER BY timestamp")
+			if err != nil {
+				t.Fatalf("cannot create plan: %v", err)
+			}
+
+			if !p.LowerBound.Equal(tt.wantLower) || p.Direction != tt.wantDirection || p.OrderBy != "ORDER BY timestamp" {
+				t.Errorf("got plan %+v, want lower bound %v and direction %q", p, tt.wantLower, tt.wantDirection)
+			}
+			if (p.UpperBound == nil) != (tt.wantUpper == nil) || (p.UpperBound != nil && !p.UpperBound.Equal(*tt.wantUpper)) {
+				t.Errorf("got upper bound %v, want %v", p.UpperBound, tt.wantUpper)
+			}
+		})
+	}
+}
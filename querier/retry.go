@@ -0,0 +1,219 @@
+package querier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/fault"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultBreakerOpenDuration = 30 * time.Second
+)
+
+// RetryConfig configures retrying failed requests of a RetryingQuerier, and its circuit breaker.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts of a request, including the first one. Defaults to 3.
+	MaxAttempts uint `yaml:"max_attempts"`
+	// InitialBackoff is the delay after the first failed attempt. It's doubled after each attempt. Defaults to 100ms.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// BreakerThreshold is the number of consecutive failed requests which opens the breaker. While open, requests
+	// fail right away instead of reaching the querier. Zero disables the breaker.
+	BreakerThreshold uint `yaml:"breaker_threshold"`
+	// BreakerOpenDuration is how long the breaker stays open before a single request is tried again. Defaults to 30s.
+	BreakerOpenDuration time.Duration `yaml:"breaker_open_duration"`
+}
+
+func (c *RetryConfig) setDefaults() {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaultRetryMaxAttempts
+	}
+
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if c.BreakerOpenDuration == 0 {
+		c.BreakerOpenDuration = defaultBreakerOpenDuration
+	}
+}
+
+func (c RetryConfig) Validate() error {
+	if c.InitialBackoff < 0 {
+		return errors.New("retry initial backoff cannot be negative")
+	}
+
+	if c.BreakerOpenDuration < 0 {
+		return errors.New("breaker open duration cannot be negative")
+	}
+
+	return nil
+}
+
+// RetryingQuerier wraps a querier, retrying requests which fail due to the querier (e.g. a flaky connection).
+// Requests failing due to their input or their context are not retried.
+type RetryingQuerier struct {
+	querier Querier
+	cfg     RetryConfig
+
+	// Following fields track consecutive failed requests for the breaker.
+	mu       sync.Mutex
+	failures uint
+	openedAt time.Time
+	// probing is set while the request let through by the half-open breaker is running.
+	probing bool
+}
+
+// NewRetryingQuerier creates a new RetryingQuerier instance, wrapping q.
+func NewRetryingQuerier(q Querier, cfg RetryConfig) *RetryingQuerier {
+	cfg.setDefaults()
+
+	return &RetryingQuerier{
+		querier: q,
+		cfg:     cfg,
+	}
+}
+
+func (r *RetryingQuerier) Query(ctx context.Context, req QueryRequest) (QueryResponse, error) {
+	return retry(ctx, r, func() (QueryResponse, error) { return r.querier.Query(ctx, req) })
+}
+
+func (r *RetryingQuerier) Count(ctx context.Context, req QueryRequest) (int64, error) {
+	return retry(ctx, r, func() (int64, error) { return r.querier.Count(ctx, req) })
+}
+
+func (r *RetryingQuerier) GroupByCount(ctx context.Context, req QueryRequest, field string) ([]GroupCount, error) {
+	return retry(ctx, r, func() ([]GroupCount, error) { return r.querier.GroupByCount(ctx, req, field) })
+}
+
+func (r *RetryingQuerier) Distinct(ctx context.Context, req QueryRequest, field string) ([]string, error) {
+	return retry(ctx, r, func() ([]string, error) { return r.querier.Distinct(ctx, req, field) })
+}
+
+func (r *RetryingQuerier) Aggregate(ctx context.Context, req QueryRequest, fn, field string) (float64, error) {
+	return retry(ctx, r, func() (float64, error) { return r.querier.Aggregate(ctx, req, fn, field) })
+}
+
+func (r *RetryingQuerier) Get(ctx context.Context, id uuid.UUID) (entity.LogRecord, error) {
+	return retry(ctx, r, func() (entity.LogRecord, error) { return r.querier.Get(ctx, id) })
+}
+
+// retry calls fn until it succeeds, fails with an error which isn't retryable, or runs out of attempts.
+// Once the breaker is open, it fails right away with fault.UnavailableCode.
+func retry[T any](ctx context.Context, r *RetryingQuerier, fn func() (T, error)) (T, error) {
+	var zero T
+
+	allowed, probe := r.allow(time.Now())
+	if !allowed {
+		return zero, fault.New(fault.UnavailableCode, "Storage is temporarily unavailable.")
+	}
+	if probe {
+		defer r.endProbe()
+	}
+
+	backoff := r.cfg.InitialBackoff
+
+	for attempt := uint(1); ; attempt++ {
+		res, err := fn()
+		if err == nil {
+			r.record(time.Now(), false)
+			return res, nil
+		}
+
+		// Requests failing by themselves say nothing about the health of the querier.
+		if isRequestError(ctx, err) {
+			return zero, err
+		}
+
+		if !isRetryable(err) {
+			r.record(time.Now(), true)
+			return zero, err
+		}
+
+		if attempt >= r.cfg.MaxAttempts {
+			r.record(time.Now(), true)
+			return zero, err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return zero, err
+		}
+	}
+}
+
+// isRequestError reports whether err is caused by the request rather than the querier, e.g. an invalid query.
+func isRequestError(ctx context.Context, err error) bool {
+	var f fault.Fault
+	if errors.As(err, &f) {
+		return f.Code() != fault.UnknownCode && f.Code() != fault.UnavailableCode
+	}
+
+	return ctx.Err() != nil
+}
+
+// isRetryable reports whether a request failing due to the querier may succeed if tried again. Timed out requests
+// are not retried, since they'd most likely time out again.
+func isRetryable(err error) bool {
+	return !errors.Is(err, context.DeadlineExceeded)
+}
+
+// allow reports whether requests may reach the querier. Once BreakerOpenDuration has passed, an open breaker is
+// half-open: it allows a single request, the probe, whose result closes the breaker or opens it again. The second
+// return value is true for the probe, which must be ended by endProbe.
+func (r *RetryingQuerier) allow(now time.Time) (bool, bool) {
+	if r.cfg.BreakerThreshold == 0 {
+		return true, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures < r.cfg.BreakerThreshold {
+		return true, false
+	}
+
+	if now.Sub(r.openedAt) < r.cfg.BreakerOpenDuration || r.probing {
+		return false, false
+	}
+
+	r.probing = true
+	return true, true
+}
+
+// endProbe lets another probe through the half-open breaker. It's called once the probe is done, including when it
+// fails due to the request, and its result doesn't tell whether the querier has recovered.
+func (r *RetryingQuerier) endProbe() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.probing = false
+}
+
+// record registers the result of a request, opening the breaker once BreakerThreshold consecutive requests failed.
+func (r *RetryingQuerier) record(now time.Time, failed bool) {
+	if r.cfg.BreakerThreshold == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !failed {
+		r.failures = 0
+		return
+	}
+
+	r.failures++
+	if r.failures >= r.cfg.BreakerThreshold {
+		r.openedAt = now
+	}
+}
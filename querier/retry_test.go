@@ -0,0 +1,193 @@
+package querier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+var errFlaky = errors.New("connection reset")
+
+// flakyQuerier fails the first failures requests to Count with err, then succeeds.
+type flakyQuerier struct {
+	Querier
+
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (q *flakyQuerier) Count(context.Context, QueryRequest) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.calls++
+	if q.calls <= q.failures {
+		return 0, q.err
+	}
+	return 42, nil
+}
+
+func (q *flakyQuerier) callCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.calls
+}
+
+func assertUnavailable(t *testing.T, err error) {
+	t.Helper()
+
+	var f fault.Fault
+	if !errors.As(err, &f) || f.Code() != fault.UnavailableCode {
+		t.Fatalf("got error %v, want an unavailable fault", err)
+	}
+}
+
+func TestRetryingQuerierRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "first attempt succeeds", wantCalls: 1},
+		{name: "retried until it succeeds", failures: 2, err: errFlaky, wantCalls: 3},
+		{name: "out of attempts", failures: 5, err: errFlaky, wantCalls: 3, wantErr: true},
+		{name: "bad input is not retried", failures: 5, err: fault.New(fault.BadInputCode, ""), wantCalls: 1, wantErr: true},
+		{name: "timeout is not retried", failures: 5, err: context.DeadlineExceeded, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &flakyQuerier{failures: tt.failures, err: tt.err}
+			r := NewRetryingQuerier(q, RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+			count, err := r.Count(context.Background(), QueryRequest{})
+			if tt.wantErr {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("got error %v, want %v", err, tt.err)
+				}
+			} else if err != nil || count != 42 {
+				t.Errorf("got count %d and error %v, want 42", count, err)
+			}
+
+			if got := q.callCount(); got != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryingQuerierBreakerFailsFast(t *testing.T) {
+	q := &flakyQuerier{failures: 100, err: errFlaky}
+	r := NewRetryingQuerier(q, RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond, BreakerThreshold: 3, BreakerOpenDuration: time.Hour})
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := r.Count(ctx, QueryRequest{}); !errors.Is(err, errFlaky) {
+			t.Fatalf("got error %v, want %v", err, errFlaky)
+		}
+	}
+
+	calls := q.callCount()
+	for range 10 {
+		_, err := r.Count(ctx, QueryRequest{})
+		assertUnavailable(t, err)
+	}
+
+	if got := q.callCount(); got != calls {
+		t.Errorf("got %d calls once the breaker opened, want none", got-calls)
+	}
+}
+
+func TestRetryingQuerierBreakerIgnoresRequestErrors(t *testing.T) {
+	q := &flakyQuerier{failures: 100, err: fault.New(fault.BadInputCode, "")}
+	r := NewRetryingQuerier(q, RetryConfig{MaxAttempts: 1, BreakerThreshold: 1, BreakerOpenDuration: time.Hour})
+
+	for range 3 {
+		if _, err := r.Count(context.Background(), QueryRequest{}); !errors.Is(err, q.err) {
+			t.Fatalf("got error %v, want %v", err, q.err)
+		}
+	}
+}
+
+func TestRetryingQuerierBreakerHalfOpen(t *testing.T) {
+	cfg := RetryConfig{BreakerThreshold: 2, BreakerOpenDuration: time.Second}
+	r := NewRetryingQuerier(&flakyQuerier{}, cfg)
+	now := time.Now()
+
+	r.record(now, true)
+	r.record(now, true)
+	if allowed, _ := r.allow(now); allowed {
+		t.Fatal("got requests allowed by an open breaker")
+	}
+
+	// Once half-open, only the probe is let through until it's done.
+	now = now.Add(cfg.BreakerOpenDuration)
+	if allowed, probe := r.allow(now); !allowed || !probe {
+		t.Fatalf("got probe allowed %v (probe: %v), want it allowed", allowed, probe)
+	}
+	for range 10 {
+		if allowed, _ := r.allow(now); allowed {
+			t.Fatal("got requests allowed while the probe is running")
+		}
+	}
+
+	// A failed probe opens the breaker again.
+	r.record(now, true)
+	r.endProbe()
+	if allowed, _ := r.allow(now); allowed {
+		t.Fatal("got requests allowed after a failed probe")
+	}
+
+	// A probe failing due to the request leaves the breaker half-open for the next probe.
+	now = now.Add(cfg.BreakerOpenDuration)
+	if allowed, probe := r.allow(now); !allowed || !probe {
+		t.Fatal("got no probe allowed once half-open again")
+	}
+	r.endProbe()
+
+	// A successful probe closes the breaker, letting every request through.
+	if allowed, probe := r.allow(now); !allowed || !probe {
+		t.Fatal("got no probe allowed after a probe without result")
+	}
+	r.record(now, false)
+	r.endProbe()
+	for range 10 {
+		if allowed, probe := r.allow(now); !allowed || probe {
+			t.Fatalf("got request allowed %v (probe: %v) after a successful probe, want it allowed", allowed, probe)
+		}
+	}
+}
+
+func TestRetryingQuerierBreakerProbesConcurrentRequestsOnce(t *testing.T) {
+	q := &flakyQuerier{failures: 1, err: errFlaky}
+	r := NewRetryingQuerier(q, RetryConfig{MaxAttempts: 1, BreakerThreshold: 1, BreakerOpenDuration: time.Nanosecond})
+	ctx := context.Background()
+
+	if _, err := r.Count(ctx, QueryRequest{}); !errors.Is(err, errFlaky) {
+		t.Fatalf("got error %v, want %v", err, errFlaky)
+	}
+
+	// The probe is held until every other request was rejected.
+	r.probing = true
+	for range 10 {
+		_, err := r.Count(ctx, QueryRequest{})
+		assertUnavailable(t, err)
+	}
+	r.endProbe()
+
+	if count, err := r.Count(ctx, QueryRequest{}); err != nil || count != 42 {
+		t.Fatalf("got count %d and error %v from the probe, want 42", count, err)
+	}
+	if got := q.callCount(); got != 2 {
+		t.Errorf("got %d calls, want 2", got)
+	}
+}
@@ -2,12 +2,12 @@ package querier
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"slices"
 	"strings"
-	"time"
 
-	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/fault"
 )
 
 // SQLOptions holds configuration for the SQL query builder.
@@ -15,6 +15,7 @@ type SQLOptions struct {
 	// AllowedSortFields is a whitelist of field names permitted in ORDER BY clauses.
 	// This prevents SQL injection through malicious sort parameters.
 	// If empty, defaults to ["source", "level", "timestamp"].
+	// Metadata paths matching AllowedFilterFieldsRegex are allowed as well, and are sorted numerically.
 	AllowedSortFields []string
 
 	// AllowedFilterFieldsRegex is a regex pattern to validate field names in WHERE clauses.
@@ -29,6 +30,29 @@ type SQLOptions struct {
 	// SelectColumns is the list of columns to SELECT.
 	// If empty, defaults to SELECT *.
 	SelectColumns []string
+
+	// DefaultSort is used when a query does not request any sort fields.
+	// If empty, results are sorted by timestamp only.
+	DefaultSort []SortField
+
+	// FieldExpression optionally converts a validated filter field into the SQL expression to compare with a value
+	// of the given kind, e.g. to extract metadata paths using database specific JSON functions and cast them.
+	// If nil, field names are used as-is.
+	FieldExpression func(field string, kind ValueKind) string
+
+	// MetadataPathColumn optionally returns the SELECT expression of a metadata path requested in Fields, which
+	// must select the value of the path as JSON text (NULL if absent) aliased as the path itself. If nil, the whole
+	// metadata column is selected instead.
+	MetadataPathColumn func(field string) string
+
+	// MatchFunction is the name of the function used for OperatorMatch. It's called as `fn(field, pattern)`.
+	// If empty, OperatorMatch is not supported.
+	MatchFunction string
+
+	// TieBreakerField is always appended as the last ORDER BY expression so
+	// records with identical sort values are returned in a stable order.
+	// If empty, defaults to "id".
+	TieBreakerField string
 }
 
 // SQLQueryBuilder is a generic SQL query builder that constructs
@@ -50,21 +74,21 @@ type BuildResult struct {
 
 // Build builds a complete SELECT query from the given Query parameters.
 func (b *SQLQueryBuilder) Build(q Query) (BuildResult, error) {
-	whereClause, args, err := b.buildWhereClause(q.Node, q.Start, q.End, uuid.UUID{})
+	whereClause, args, err := b.buildWhereClause(q)
 	if err != nil {
 		return BuildResult{}, fmt.Errorf("failed to build where clause: %w", err)
 	}
 
-	orderByClause, err := b.buildOrderByClause(q.Start, q.End, q.Sort)
+	orderByClause, err := b.buildOrderByClause(q.GetQueryDirection(), q.Sort)
 	if err != nil {
 		return BuildResult{}, fmt.Errorf("failed to build order by clause: %w", err)
 	}
 
 	limitClause := fmt.Sprintf("LIMIT %d", q.Limit)
 
-	selectCols := strings.Join(b.opts.SelectColumns, ", ")
-	if len(b.opts.SelectColumns) == 0 {
-		selectCols = "*"
+	selectCols, err := b.buildSelectColumns(q.Fields)
+	if err != nil {
+		return BuildResult{}, err
 	}
 
 	sqlQuery := fmt.Sprintf(
@@ -79,66 +103,296 @@ func (b *SQLQueryBuilder) Build(q Query) (BuildResult, error) {
 	return BuildResult{Query: sqlQuery, Args: args}, nil
 }
 
-// buildWhereClause constructs the WHERE clause with timestamp bounds and query conditions.
-func (b *SQLQueryBuilder) buildWhereClause(root QueryNode, start, end time.Time, skipID uuid.UUID) (string, []any, error) {
-	queryClause, args, err := b.parseQueryNode(root)
+// DefaultSort returns the sort applied to queries without sort fields (see SQLOptions.DefaultSort).
+func (b *SQLQueryBuilder) DefaultSort() []SortField {
+	return b.opts.DefaultSort
+}
+
+// BuildGet builds a SELECT query for the record with the given id, selecting all of SelectColumns.
+func (b *SQLQueryBuilder) BuildGet(id string) BuildResult {
+	selectCols, _ := b.buildSelectColumns(nil)
+
+	return BuildResult{
+		Query: fmt.Sprintf("SELECT %s FROM %s WHERE id = ? LIMIT 1", selectCols, b.opts.TableName),
+		Args:  []any{id},
+	}
+}
+
+// buildSelectColumns returns the columns to select for the requested fields.
+// Requested fields must be one of SelectColumns, or a metadata path which selects the whole metadata column.
+func (b *SQLQueryBuilder) buildSelectColumns(fields []string) (string, error) {
+	if len(fields) == 0 {
+		if len(b.opts.SelectColumns) == 0 {
+			return "*", nil
+		}
+		return strings.Join(b.opts.SelectColumns, ", "), nil
+	}
+
+	var columns []string
+	for _, f := range fields {
+		column := f
+		isPath := IsMetadataPath(f) && (b.opts.AllowedFilterFieldsRegex == nil || b.opts.AllowedFilterFieldsRegex.MatchString(f))
+		if isPath {
+			column = "metadata"
+		}
+
+		if !slices.Contains(b.opts.SelectColumns, column) {
+			return "", fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+				"fields": []string{fmt.Sprintf("Field `%s` is unknown.", f)},
+			})
+		}
+
+		// Selecting only the path avoids reading the whole metadata of every record.
+		if isPath && b.opts.MetadataPathColumn != nil {
+			column = b.opts.MetadataPathColumn(f)
+		}
+
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+
+	return strings.Join(columns, ", "), nil
+}
+
+// BuildCount builds a SELECT count(*) query matching the same records as Build, ignoring sort and limit.
+func (b *SQLQueryBuilder) BuildCount(q Query) (BuildResult, error) {
+	whereClause, args, err := b.buildWhereClause(q)
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("failed to build where clause: %w", err)
+	}
+
+	sqlQuery := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", b.opts.TableName, whereClause)
+
+	return BuildResult{Query: sqlQuery, Args: args}, nil
+}
+
+// BuildGroupByCount builds a query counting records per distinct value of field, sorted by count in descending order.
+// Only fields allowed for sorting can be grouped by.
+func (b *SQLQueryBuilder) BuildGroupByCount(q Query, field string) (BuildResult, error) {
+	if !slices.Contains(b.allowedSortFields(), field) {
+		return BuildResult{}, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for grouping.", field)},
+		})
+	}
+
+	whereClause, args, err := b.buildWhereClause(q)
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("failed to build where clause: %w", err)
+	}
+
+	sqlQuery := fmt.Sprintf(
+		"SELECT %s, count(*) AS count FROM %s WHERE %s GROUP BY %s ORDER BY count DESC",
+		field,
+		b.opts.TableName,
+		whereClause,
+		field,
+	)
+
+	return BuildResult{Query: sqlQuery, Args: args}, nil
+}
+
+// BuildDistinct builds a query selecting up to q.Limit distinct values of field in the records matching the query,
+// sorted in ascending order. Besides fields allowed for sorting, metadata paths allowed for filtering can be used if
+// MetadataPathColumn is set. Their values are selected as JSON text, and records without the path are skipped.
+func (b *SQLQueryBuilder) BuildDistinct(q Query, field string) (BuildResult, error) {
+	column := field
+	allowed := slices.Contains(b.allowedSortFields(), field)
+	metadata := !allowed && IsMetadataPath(field) && b.opts.MetadataPathColumn != nil &&
+		b.opts.AllowedFilterFieldsRegex != nil && b.opts.AllowedFilterFieldsRegex.MatchString(field)
+
+	if !allowed && !metadata {
+		return BuildResult{}, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for listing distinct values.", field)},
+		})
+	}
+
+	whereClause, args, err := b.buildWhereClause(q)
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("failed to build where clause: %w", err)
+	}
+
+	if metadata {
+		column = b.opts.MetadataPathColumn(field)
+
+		expr := field
+		if b.opts.FieldExpression != nil {
+			expr = b.opts.FieldExpression(field, ValueKindUnknown)
+		}
+		whereClause = fmt.Sprintf("(%s) AND %s IS NOT NULL", whereClause, expr)
+	}
+
+	// The column is referred to by position, since metadata path columns are aliased using database specific quoting.
+	sqlQuery := fmt.Sprintf(
+		"SELECT DISTINCT %s FROM %s WHERE %s ORDER BY 1 LIMIT %d",
+		column,
+		b.opts.TableName,
+		whereClause,
+		q.Limit,
+	)
+
+	return BuildResult{Query: sqlQuery, Args: args}, nil
+}
+
+// BuildAggregate builds a query applying fn to the values of a metadata path, cast to numbers, in the records matching
+// the query. Metadata paths must be allowed for filtering. Other fields can't be aggregated, even if they're allowed
+// for sorting.
+func (b *SQLQueryBuilder) BuildAggregate(q Query, fn, field string) (BuildResult, error) {
+	if err := ValidateAggregate(fn, field); err != nil {
+		return BuildResult{}, err
+	}
+
+	if !IsMetadataPath(field) || b.opts.AllowedFilterFieldsRegex == nil || !b.opts.AllowedFilterFieldsRegex.MatchString(field) {
+		return BuildResult{}, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for aggregation.", field)},
+		})
+	}
+
+	expr := field
+	if b.opts.FieldExpression != nil {
+		expr = b.opts.FieldExpression(field, ValueKindFloat)
+	}
+
+	whereClause, args, err := b.buildWhereClause(q)
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("failed to build where clause: %w", err)
+	}
+
+	sqlQuery := fmt.Sprintf("SELECT %s(%s) FROM %s WHERE %s", fn, expr, b.opts.TableName, whereClause)
+
+	return BuildResult{Query: sqlQuery, Args: args}, nil
+}
+
+// allowedSortFields returns the configured allowed sort fields, or the defaults if none are configured.
+func (b *SQLQueryBuilder) allowedSortFields() []string {
+	if len(b.opts.AllowedSortFields) == 0 {
+		return []string{"source", "level", "timestamp"}
+	}
+	return b.opts.AllowedSortFields
+}
+
+// sortExpression returns the expression used to sort by field, and false if sorting by it is not allowed.
+// Besides allowed sort fields, metadata paths allowed for filtering can be used. They're sorted numerically.
+func (b *SQLQueryBuilder) sortExpression(field string) (string, bool) {
+	if slices.Contains(b.allowedSortFields(), field) {
+		return field, true
+	}
+
+	if !IsMetadataPath(field) || b.opts.AllowedFilterFieldsRegex == nil || !b.opts.AllowedFilterFieldsRegex.MatchString(field) {
+		return "", false
+	}
+
+	if b.opts.FieldExpression != nil {
+		return b.opts.FieldExpression(field, ValueKindFloat), true
+	}
+
+	return field, true
+}
+
+// tieBreakerField returns the configured tie-breaker field, or "id" if none is configured.
+func (b *SQLQueryBuilder) tieBreakerField() string {
+	if b.opts.TieBreakerField == "" {
+		return "id"
+	}
+	return b.opts.TieBreakerField
+}
+
+// buildWhereClause constructs the WHERE clause with timestamp bounds, cursor and query conditions.
+func (b *SQLQueryBuilder) buildWhereClause(q Query) (string, []any, error) {
+	queryClause, args, err := b.parseQueryNode(q.Node)
 	if err != nil {
 		return "", nil, err
 	}
 
-	var sTime, eTime time.Time
+	if err := q.ValidateCursorSort(b.opts.DefaultSort); err != nil {
+		return "", nil, err
+	}
 
-	if start.Compare(end) < 0 {
-		sTime = start
-		eTime = end
-	} else {
-		sTime = end
-		eTime = start
+	sTime, eTime, cursor, err := q.GetCursorWindow()
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Always add timestamp bounds
-	parts := []string{"timestamp >= ?"}
-	finalArgs := []any{sTime}
+	// Add timestamp bounds, which are only missing from backward queries without End (see Query.GetTimeWindow).
+	lowerExclusive, upperExclusive := q.GetBoundsExclusivity()
+
+	var parts []string
+	var finalArgs []any
+
+	if !sTime.IsZero() {
+		parts = append(parts, "timestamp "+boundOperator(">", lowerExclusive)+" ?")
+		finalArgs = append(finalArgs, sTime)
+	}
 
 	if !eTime.IsZero() {
-		parts = append(parts, "timestamp <= ?")
+		parts = append(parts, "timestamp "+boundOperator("<", upperExclusive)+" ?")
 		finalArgs = append(finalArgs, eTime)
 	}
 
+	// Skip records up to the cursor, including the record it points at.
+	if cursor != nil {
+		op := ">"
+		if q.GetQueryDirection() == QueryDirectionBackward {
+			op = "<"
+		}
+
+		parts = append(parts, fmt.Sprintf("(timestamp, %s) %s (?, ?)", b.tieBreakerField(), op))
+		finalArgs = append(finalArgs, cursor.Timestamp, cursor.ID)
+	}
+
 	// Add query conditions if they exist
 	if queryClause != "" {
 		parts = append(parts, queryClause)
 		finalArgs = append(finalArgs, args...)
 	}
 
+	if len(parts) == 0 {
+		return "1 = 1", nil, nil
+	}
+
 	return strings.Join(parts, " AND "), finalArgs, nil
 }
 
+// boundOperator returns the comparison operator of a time bound, op being either ">" or "<".
+func boundOperator(op string, exclusive bool) string {
+	if exclusive {
+		return op
+	}
+	return op + "="
+}
+
+// BuildOrderBy returns the ORDER BY clause of the query built by Build.
+func (b *SQLQueryBuilder) BuildOrderBy(q Query) (string, error) {
+	return b.buildOrderByClause(q.GetQueryDirection(), q.Sort)
+}
+
 // buildOrderByClause determines the sort order based on custom fields
-// and the relationship between Start and End timestamps.
-func (b *SQLQueryBuilder) buildOrderByClause(start, end time.Time, sortFields []SortField) (string, error) {
-	// Determine the chronological direction based on the comment:
-	// "If End is before Start, the query is executed in backward chronological order."
+// and the chronological direction of the query.
+func (b *SQLQueryBuilder) buildOrderByClause(direction QueryDirection, sortFields []SortField) (string, error) {
 	timeDirection := "ASC"
-	if !end.IsZero() && end.Before(start) {
+	if direction == QueryDirectionBackward {
 		timeDirection = "DESC"
 	}
 
-	// Define allowed fields for security/validation
-	allowedFields := b.opts.AllowedSortFields
-	if len(allowedFields) == 0 {
-		allowedFields = []string{"source", "level", "timestamp"}
-	}
+	tieBreaker := b.tieBreakerField()
 
-	// Handle the case where no specific sort fields are requested
+	// Fall back to the configured default sort when no specific sort fields are requested
 	if len(sortFields) == 0 {
-		return fmt.Sprintf("ORDER BY timestamp %s", timeDirection), nil
+		sortFields = b.opts.DefaultSort
+	}
+
+	// When sort fields are given explicitly, the time direction must not leak into them.
+	// Appended sort expressions then only act as tie-breakers and use a neutral direction.
+	secondaryDirection := timeDirection
+	if len(sortFields) > 0 {
+		secondaryDirection = "ASC"
 	}
 
 	// Validate and build custom sort parts
 	var parts []string
 	for _, field := range sortFields {
-		if !slices.Contains(allowedFields, field.Name) {
+		expr, ok := b.sortExpression(field.Name)
+		if !ok {
 			return "", fmt.Errorf("field `%s` is not allowed for sorting", field.Name)
 		}
 
@@ -147,17 +401,27 @@ func (b *SQLQueryBuilder) buildOrderByClause(start, end time.Time, sortFields []
 			direction = "DESC"
 		}
 
-		parts = append(parts, fmt.Sprintf("%s %s", field.Name, direction))
+		parts = append(parts, fmt.Sprintf("%s %s", expr, direction))
 	}
 
-	// Ensure timestamp is included in the sort to respect the Start/End logic
-	// if it wasn't already explicitly provided in sortFields.
+	// Ensure timestamp is included in the sort if it wasn't already explicitly provided in sortFields.
+	// Without explicit sort fields, this is what makes results respect the Start/End logic.
 	hasTimestamp := slices.ContainsFunc(sortFields, func(f SortField) bool {
 		return f.Name == "timestamp"
 	})
 
 	if !hasTimestamp {
-		parts = append(parts, fmt.Sprintf("timestamp %s", timeDirection))
+		parts = append(parts, fmt.Sprintf("timestamp %s", secondaryDirection))
+	}
+
+	// Records sharing the same timestamp would otherwise come back in a
+	// nondeterministic order, which breaks cursor pagination.
+	hasTieBreaker := slices.ContainsFunc(sortFields, func(f SortField) bool {
+		return f.Name == tieBreaker
+	})
+
+	if !hasTieBreaker {
+		parts = append(parts, fmt.Sprintf("%s %s", tieBreaker, secondaryDirection))
 	}
 
 	return fmt.Sprintf("ORDER BY %s", strings.Join(parts, ", ")), nil
@@ -174,8 +438,8 @@ func (b *SQLQueryBuilder) parseQueryNode(node QueryNode) (string, []any, error)
 
 	switch n := node.(type) {
 	case AndNode:
-		// Join all children with AND. If there are no children,
-		// we return an empty string or a truthy expression like (1=1).
+		// Join all children with AND. Empty groups collapse to an empty string (see IsEmptyNode), which callers
+		// leave out of the WHERE clause.
 		return b.joinNodes(n.Children, "AND", args)
 
 	case OrNode:
@@ -190,8 +454,9 @@ func (b *SQLQueryBuilder) parseQueryNode(node QueryNode) (string, []any, error)
 			return "", nil, err
 		}
 
+		// The child matches everything, so its negation matches nothing (see IsEmptyNode).
 		if childQuery == "" {
-			return "", nil, nil
+			return "1 = 0", nil, nil
 		}
 
 		return fmt.Sprintf("NOT (%s)", childQuery), args, nil
@@ -235,17 +500,35 @@ func (b *SQLQueryBuilder) joinNodes(children []QueryNode, operator string, args
 
 // formatComparison converts a ComparisonNode into SQL.
 func (b *SQLQueryBuilder) formatComparison(n ComparisonNode) (string, []any, error) {
-	if n.FieldName == "" || n.Value == nil {
-		return "", nil, fmt.Errorf("invalid comparison node: missing field name or value")
+	if n.FieldName == "" {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			"field_name": []string{"Field name is required."},
+		})
+	}
+
+	if n.Value == nil {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Value is required."},
+		})
 	}
 
 	// Prevent SQL injection by validating field name against allowed pattern
 	if b.opts.AllowedFilterFieldsRegex != nil && !b.opts.AllowedFilterFieldsRegex.MatchString(n.FieldName) {
-		return "", nil, fmt.Errorf("invalid field name: %s", n.FieldName)
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Field is not allowed for filtering."},
+		})
 	}
 
-	args := make([]any, 1)
-	args[0] = n.Value
+	if n.Operator == OperatorMatch {
+		return b.formatMatch(n)
+	}
+
+	value, ok := n.LevelValue()
+	if !ok {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Unknown log level."},
+		})
+	}
 
 	op := ""
 	switch n.Operator {
@@ -267,9 +550,82 @@ func (b *SQLQueryBuilder) formatComparison(n ComparisonNode) (string, []any, err
 		op = "ILIKE"
 	case OperatorIn:
 		op = "IN"
+	case OperatorNotIn:
+		op = "NOT IN"
+	case OperatorNotLike:
+		op = "NOT LIKE"
 	default:
-		return "", nil, fmt.Errorf("unsupported operator: %v", n.Operator)
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{fmt.Sprintf("Operator %d is not supported.", n.Operator)},
+		})
+	}
+
+	field := n.FieldName
+	if b.opts.FieldExpression != nil {
+		field = b.opts.FieldExpression(field, KindOf(value))
+	}
+
+	if n.Operator == OperatorIn || n.Operator == OperatorNotIn {
+		return formatList(n.FieldName, field, op, value)
+	}
+
+	return fmt.Sprintf("%s %s ?", field, op), []any{normalizeValue(value)}, nil
+}
+
+// formatList formats an IN or NOT IN comparison with a placeholder per element of the list, since drivers (e.g.
+// SQLite) cannot bind lists to a single placeholder. An empty list matches no record for IN, and every record for
+// NOT IN.
+func formatList(fieldName, field, op string, value any) (string, []any, error) {
+	rv := reflect.ValueOf(value)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			fieldName: []string{"Value must be a list."},
+		})
+	}
+
+	if rv.Len() == 0 {
+		if op == "IN" {
+			return "1 = 0", nil, nil
+		}
+		return "1 = 1", nil, nil
+	}
+
+	placeholders := make([]string, rv.Len())
+	args := make([]any, rv.Len())
+	for i := range args {
+		placeholders[i] = "?"
+		args[i] = normalizeValue(rv.Index(i).Interface())
+	}
+
+	return fmt.Sprintf("%s %s (%s)", field, op, strings.Join(placeholders, ", ")), args, nil
+}
+
+// formatMatch formats an OperatorMatch comparison. Patterns are validated here, so invalid ones are reported as bad
+// input instead of database errors.
+func (b *SQLQueryBuilder) formatMatch(n ComparisonNode) (string, []any, error) {
+	if b.opts.MatchFunction == "" {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{fmt.Sprintf("Operator %d is not supported.", n.Operator)},
+		})
+	}
+
+	pattern, ok := n.Value.(string)
+	if !ok {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Value must be a string."},
+		})
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Value is not a valid regular expression."},
+		})
+	}
+
+	field := n.FieldName
+	if b.opts.FieldExpression != nil {
+		field = b.opts.FieldExpression(field, ValueKindString)
 	}
 
-	return fmt.Sprintf("%s %s ?", n.FieldName, op), args, nil
+	return fmt.Sprintf("%s(%s, ?)", b.opts.MatchFunction, field), []any{pattern}, nil
 }
@@ -0,0 +1,680 @@
+package querier
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+var (
+	testStart = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	testEnd   = testStart.Add(time.Hour)
+)
+
+func newTestBuilder() *SQLQueryBuilder {
+	return NewSQLQueryBuilder(SQLOptions{TableName: "logs"})
+}
+
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestBuildWhereClauseTimeWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     Query
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "forward",
+			query:     Query{Start: testStart, End: testEnd},
+			wantWhere: "timestamp >= ? AND timestamp < ?",
+			wantArgs:  []any{testStart, testEnd},
+		},
+		{
+			name:      "backward swaps bounds and keeps end exclusive",
+			query:     Query{Start: testEnd, End: testStart},
+			wantWhere: "timestamp > ? AND timestamp <= ?",
+			wantArgs:  []any{testStart, testEnd},
+		},
+		{
+			name:      "start only",
+			query:     Query{Start: testStart},
+			wantWhere: "timestamp >= ?",
+			wantArgs:  []any{testStart},
+		},
+		{
+			name:      "explicitly backward start only",
+			query:     Query{Start: testStart, Direction: QueryDirectionBackward},
+			wantWhere: "timestamp <= ?",
+			wantArgs:  []any{testStart},
+		},
+		{
+			name:      "end only",
+			query:     Query{End: testEnd},
+			wantWhere: "timestamp < ?",
+			wantArgs:  []any{testEnd},
+		},
+		{
+			name:      "equal start and end is empty",
+			query:     Query{Start: testStart, End: testStart},
+			wantWhere: "timestamp > ? AND timestamp <= ?",
+			wantArgs:  []any{testStart, testStart},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := newTestBuilder().buildWhereClause(tt.query)
+			if err != nil {
+				t.Fatalf("cannot build where clause: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuildWhereClauseBoundsInclusivity(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     Query
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "defaults",
+			query:     Query{Start: testStart, End: testEnd},
+			wantWhere: "timestamp >= ? AND timestamp < ?",
+			wantArgs:  []any{testStart, testEnd},
+		},
+		{
+			name:      "exclusive start and inclusive end",
+			query:     Query{Start: testStart, End: testEnd, StartInclusive: ptr(false), EndInclusive: ptr(true)},
+			wantWhere: "timestamp > ? AND timestamp <= ?",
+			wantArgs:  []any{testStart, testEnd},
+		},
+		{
+			name:      "both inclusive",
+			query:     Query{Start: testStart, End: testEnd, EndInclusive: ptr(true)},
+			wantWhere: "timestamp >= ? AND timestamp <= ?",
+			wantArgs:  []any{testStart, testEnd},
+		},
+		{
+			name:      "backward query keeps the inclusivity of its bounds",
+			query:     Query{Start: testEnd, End: testStart, StartInclusive: ptr(false), EndInclusive: ptr(true)},
+			wantWhere: "timestamp >= ? AND timestamp < ?",
+			wantArgs:  []any{testStart, testEnd},
+		},
+		{
+			name:      "exclusive start only",
+			query:     Query{Start: testStart, StartInclusive: ptr(false)},
+			wantWhere: "timestamp > ?",
+			wantArgs:  []any{testStart},
+		},
+		{
+			name:      "explicitly backward exclusive start only",
+			query:     Query{Start: testStart, Direction: QueryDirectionBackward, StartInclusive: ptr(false)},
+			wantWhere: "timestamp < ?",
+			wantArgs:  []any{testStart},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := newTestBuilder().buildWhereClause(tt.query)
+			if err != nil {
+				t.Fatalf("cannot build where clause: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuildAggregate(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{
+		TableName:                "logs",
+		AllowedSortFields:        []string{"source", "timestamp", "metadata.duration"},
+		AllowedFilterFieldsRegex: regexp.MustCompile(`^(source|metadata\.[a-z_]+)$`),
+		FieldExpression: func(field string, kind ValueKind) string {
+			if kind == ValueKindFloat {
+				return "toFloat64OrNull(" + field + ")"
+			}
+			return field
+		},
+	})
+
+	tests := []struct {
+		name      string
+		fn        string
+		field     string
+		wantQuery string
+		wantErr   bool
+	}{
+		{name: "metadata path", fn: AggregateAvg, field: "metadata.latency", wantQuery: "SELECT avg(toFloat64OrNull(metadata.latency)) FROM logs WHERE timestamp >= ?"},
+		{name: "metadata path allowed for sorting is cast too", fn: AggregateSum, field: "metadata.duration", wantQuery: "SELECT sum(toFloat64OrNull(metadata.duration)) FROM logs WHERE timestamp >= ?"},
+		{name: "field allowed for sorting", fn: AggregateSum, field: "source", wantErr: true},
+		{name: "field not allowed for filtering", fn: AggregateMax, field: "metadata.Latency", wantErr: true},
+		{name: "unknown function", fn: "median", field: "metadata.latency", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := b.BuildAggregate(Query{Start: testStart}, tt.fn, tt.field)
+			if tt.wantErr {
+				assertBadInput(t, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("cannot build query: %v", err)
+			}
+
+			if res.Query != tt.wantQuery {
+				t.Errorf("got query %q, want %q", res.Query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+// assertBadInput fails the test unless err is a fault with fault.BadInputCode.
+func assertBadInput(t *testing.T, err error) {
+	t.Helper()
+
+	var f fault.Fault
+	if !errors.As(err, &f) || f.Code() != fault.BadInputCode {
+		t.Fatalf("got error %v, want a bad input fault", err)
+	}
+}
+
+func TestBuildWhereClauseEmptyNodes(t *testing.T) {
+	cmp := ComparisonNode{FieldName: "source", Operator: OperatorEq, Value: "api"}
+
+	tests := []struct {
+		name      string
+		node      QueryNode
+		wantWhere string
+		wantArgs  []any
+	}{
+		{name: "empty and", node: AndNode{}, wantWhere: "1 = 1"},
+		{name: "empty or", node: OrNode{}, wantWhere: "1 = 1"},
+		{name: "and with one empty child", node: AndNode{Children: []QueryNode{AndNode{}, cmp}}, wantWhere: "(source = ?)", wantArgs: []any{"api"}},
+		{name: "or with one empty child", node: OrNode{Children: []QueryNode{cmp, OrNode{}}}, wantWhere: "(source = ?)", wantArgs: []any{"api"}},
+		{
+			name:      "nested empties",
+			node:      AndNode{Children: []QueryNode{OrNode{Children: []QueryNode{AndNode{}, OrNode{}}}, AndNode{Children: []QueryNode{AndNode{}}}}},
+			wantWhere: "1 = 1",
+		},
+		{
+			name:      "nested empties around a comparison",
+			node:      OrNode{Children: []QueryNode{AndNode{}, AndNode{Children: []QueryNode{OrNode{}, cmp}}}},
+			wantWhere: "((source = ?))",
+			wantArgs:  []any{"api"},
+		},
+		{name: "not of empty matches nothing", node: NotNode{Child: AndNode{}}, wantWhere: "1 = 0"},
+		{name: "not of nil matches nothing", node: NotNode{}, wantWhere: "1 = 0"},
+		{name: "not of not of empty matches everything", node: NotNode{Child: NotNode{Child: OrNode{}}}, wantWhere: "NOT (1 = 0)"},
+		{
+			name:      "or with not of empty",
+			node:      OrNode{Children: []QueryNode{NotNode{Child: AndNode{}}, cmp}},
+			wantWhere: "(1 = 0 OR source = ?)",
+			wantArgs:  []any{"api"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without bounds, the where clause only holds the node tree.
+			where, args, err := newTestBuilder().buildWhereClause(Query{Node: tt.node, Direction: QueryDirectionBackward})
+			if err != nil {
+				t.Fatalf("cannot build where clause: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if len(args) != len(tt.wantArgs) || (len(args) > 0 && !reflect.DeepEqual(args, tt.wantArgs)) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuildEmptyNodeIsValidSQL(t *testing.T) {
+	res, err := newTestBuilder().Build(Query{Node: AndNode{Children: []QueryNode{AndNode{}}}, Start: testStart, Limit: 10})
+	if err != nil {
+		t.Fatalf("cannot build query: %v", err)
+	}
+
+	want := "SELECT * FROM logs WHERE timestamp >= ? ORDER BY timestamp ASC, id ASC LIMIT 10"
+	if res.Query != want {
+		t.Errorf("got query %q, want %q", res.Query, want)
+	}
+}
+
+func TestBuildOrderByClause(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  SQLOptions
+		query Query
+		want  string
+	}{
+		{
+			name:  "forward",
+			query: Query{Start: testStart},
+			want:  "ORDER BY timestamp ASC, id ASC",
+		},
+		{
+			name:  "backward",
+			query: Query{Start: testEnd, End: testStart},
+			want:  "ORDER BY timestamp DESC, id DESC",
+		},
+		{
+			name:  "sort fields",
+			query: Query{Start: testEnd, End: testStart, Sort: []SortField{{Name: "level", IsDescending: true}}},
+			want:  "ORDER BY level DESC, timestamp ASC, id ASC",
+		},
+		{
+			name:  "explicit timestamp sort",
+			query: Query{Start: testStart, Sort: []SortField{{Name: "timestamp", IsDescending: true}}},
+			want:  "ORDER BY timestamp DESC, id ASC",
+		},
+		{
+			name:  "default sort",
+			opts:  SQLOptions{DefaultSort: []SortField{{Name: "source"}}},
+			query: Query{Start: testStart},
+			want:  "ORDER BY source ASC, timestamp ASC, id ASC",
+		},
+		{
+			name:  "sort fields override the default sort",
+			opts:  SQLOptions{DefaultSort: []SortField{{Name: "source"}}},
+			query: Query{Start: testStart, Sort: []SortField{{Name: "level"}}},
+			want:  "ORDER BY level ASC, timestamp ASC, id ASC",
+		},
+		{
+			name:  "custom tie-breaker",
+			opts:  SQLOptions{TieBreakerField: "source"},
+			query: Query{Start: testStart},
+			want:  "ORDER BY timestamp ASC, source ASC",
+		},
+		{
+			name:  "tie-breaker in sort fields",
+			opts:  SQLOptions{AllowedSortFields: []string{"timestamp", "id"}},
+			query: Query{Start: testStart, Sort: []SortField{{Name: "id", IsDescending: true}}},
+			want:  "ORDER BY id DESC, timestamp ASC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSQLQueryBuilder(tt.opts).BuildOrderBy(tt.query)
+			if err != nil {
+				t.Fatalf("cannot build order by clause: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildOrderByClauseRejectsUnknownField(t *testing.T) {
+	if _, err := newTestBuilder().BuildOrderBy(Query{Sort: []SortField{{Name: "message"}}}); err == nil {
+		t.Fatal("got no error sorting by a field which isn't allowed")
+	}
+}
+
+func TestFormatComparisonInvalid(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{TableName: "logs", AllowedFilterFieldsRegex: regexp.MustCompile(`^(source|level)$`)})
+
+	tests := []struct {
+		name         string
+		node         ComparisonNode
+		wantMetadata fault.FieldErrorsMetadata
+	}{
+		{
+			name:         "missing field name",
+			node:         ComparisonNode{Operator: OperatorEq, Value: "api"},
+			wantMetadata: fault.FieldErrorsMetadata{"field_name": {"Field name is required."}},
+		},
+		{
+			name:         "missing value",
+			node:         ComparisonNode{FieldName: "source", Operator: OperatorEq},
+			wantMetadata: fault.FieldErrorsMetadata{"source": {"Value is required."}},
+		},
+		{
+			name:         "field not allowed",
+			node:         ComparisonNode{FieldName: "password", Operator: OperatorEq, Value: "secret"},
+			wantMetadata: fault.FieldErrorsMetadata{"password": {"Field is not allowed for filtering."}},
+		},
+		{
+			name:         "unsupported operator",
+			node:         ComparisonNode{FieldName: "source", Operator: ComparisonOperator(200), Value: "api"},
+			wantMetadata: fault.FieldErrorsMetadata{"source": {"Operator 200 is not supported."}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := b.formatComparison(tt.node)
+			assertBadInput(t, err)
+
+			var f fault.Fault
+			errors.As(err, &f)
+			if !reflect.DeepEqual(f.Metadata(), tt.wantMetadata) {
+				t.Errorf("got metadata %v, want %v", f.Metadata(), tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestBuildSelectColumns(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{
+		TableName:     "logs",
+		SelectColumns: []string{"id", "timestamp", "message", "metadata"},
+	})
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{name: "all columns", want: "id, timestamp, message, metadata"},
+		{name: "projected columns", fields: []string{"timestamp", "message"}, want: "timestamp, message"},
+		{name: "metadata paths select metadata once", fields: []string{"metadata.user", "message", "metadata.status"}, want: "metadata, message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.buildSelectColumns(tt.fields)
+			if err != nil {
+				t.Fatalf("cannot build select columns: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got columns %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSelectColumnsRejectsUnknownField(t *testing.T) {
+	_, err := newTestBuilder().buildSelectColumns([]string{"timestamp", "password"})
+	assertBadInput(t, err)
+}
+
+func TestFormatComparisonNegations(t *testing.T) {
+	tests := []struct {
+		name      string
+		node      ComparisonNode
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "not in",
+			node:      ComparisonNode{FieldName: "source", Operator: OperatorNotIn, Value: []any{"api", "worker"}},
+			wantWhere: "source NOT IN (?, ?)",
+			wantArgs:  []any{"api", "worker"},
+		},
+		{
+			name:      "not in an empty list matches everything",
+			node:      ComparisonNode{FieldName: "source", Operator: OperatorNotIn, Value: []string{}},
+			wantWhere: "1 = 1",
+		},
+		{
+			name:      "not like",
+			node:      ComparisonNode{FieldName: "message", Operator: OperatorNotLike, Value: "%health%"},
+			wantWhere: "message NOT LIKE ?",
+			wantArgs:  []any{"%health%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := newTestBuilder().formatComparison(tt.node)
+			if err != nil {
+				t.Fatalf("cannot format comparison: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if len(args) != len(tt.wantArgs) || (len(args) > 0 && !reflect.DeepEqual(args, tt.wantArgs)) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuildExplicitBackwardDirection(t *testing.T) {
+	res, err := newTestBuilder().Build(Query{Start: testStart, End: testEnd, Direction: QueryDirectionBackward, Limit: 10})
+	if err != nil {
+		t.Fatalf("cannot build query: %v", err)
+	}
+
+	want := "SELECT * FROM logs WHERE timestamp >= ? AND timestamp < ? ORDER BY timestamp DESC, id DESC LIMIT 10"
+	if res.Query != want {
+		t.Errorf("got query %q, want %q", res.Query, want)
+	}
+
+	if wantArgs := []any{testStart, testEnd}; !reflect.DeepEqual(res.Args, wantArgs) {
+		t.Errorf("got args %v, want %v", res.Args, wantArgs)
+	}
+}
+
+func TestFormatComparisonMatchIsNotLike(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{TableName: "logs", MatchFunction: "match"})
+
+	tests := []struct {
+		name      string
+		node      ComparisonNode
+		wantWhere string
+	}{
+		{name: "match", node: ComparisonNode{FieldName: "message", Operator: OperatorMatch, Value: `time(out|d out)`}, wantWhere: "match(message, ?)"},
+		{name: "like", node: ComparisonNode{FieldName: "message", Operator: OperatorLike, Value: "%timeout%"}, wantWhere: "message LIKE ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := b.formatComparison(tt.node)
+			if err != nil {
+				t.Fatalf("cannot format comparison: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if want := []any{tt.node.Value}; !reflect.DeepEqual(args, want) {
+				t.Errorf("got args %v, want %v", args, want)
+			}
+		})
+	}
+}
+
+func TestFormatComparisonInvalidMatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		matchFunction string
+		value         any
+	}{
+		{name: "not supported", value: "time(out)"},
+		{name: "not a string", matchFunction: "match", value: 42},
+		{name: "invalid regular expression", matchFunction: "match", value: "time(out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSQLQueryBuilder(SQLOptions{TableName: "logs", MatchFunction: tt.matchFunction})
+
+			_, _, err := b.formatComparison(ComparisonNode{FieldName: "message", Operator: OperatorMatch, Value: tt.value})
+			assertBadInput(t, err)
+		})
+	}
+}
+
+func TestBuildGet(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{TableName: "logs", SelectColumns: []string{"id", "timestamp", "message"}})
+
+	got := b.BuildGet("00000000-0000-0000-0000-000000000001")
+	if want := "SELECT id, timestamp, message FROM logs WHERE id = ? LIMIT 1"; got.Query != want {
+		t.Errorf("got query %q, want %q", got.Query, want)
+	}
+	if want := []any{"00000000-0000-0000-0000-000000000001"}; !reflect.DeepEqual(got.Args, want) {
+		t.Errorf("got args %v, want %v", got.Args, want)
+	}
+}
+
+func TestFormatComparisonFiltersById(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{TableName: "logs", AllowedFilterFieldsRegex: regexp.MustCompile(`^(id|source)$`)})
+
+	where, args, err := b.formatComparison(ComparisonNode{FieldName: "id", Operator: OperatorEq, Value: "00000000-0000-0000-0000-000000000001"})
+	if err != nil {
+		t.Fatalf("cannot format comparison: %v", err)
+	}
+
+	if where != "id = ?" {
+		t.Errorf("got where clause %q, want %q", where, "id = ?")
+	}
+	if want := []any{"00000000-0000-0000-0000-000000000001"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got args %v, want %v", args, want)
+	}
+}
+
+func TestBuildSelectColumnsMetadataPathColumn(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{
+		TableName:          "logs",
+		SelectColumns:      []string{"id", "message", "metadata"},
+		MetadataPathColumn: func(field string) string { return "json(" + field + ") AS `" + field + "`" },
+	})
+
+	got, err := b.buildSelectColumns([]string{"id", "metadata.user", "metadata.region", "metadata.user"})
+	if err != nil {
+		t.Fatalf("cannot build select columns: %v", err)
+	}
+	if want := "id, json(metadata.user) AS `metadata.user`, json(metadata.region) AS `metadata.region`"; got != want {
+		t.Errorf("got columns %q, want %q", got, want)
+	}
+}
+
+func TestFormatComparisonIn(t *testing.T) {
+	tests := []struct {
+		name      string
+		node      ComparisonNode
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "strings",
+			node:      ComparisonNode{FieldName: "source", Operator: OperatorIn, Value: []string{"api", "worker"}},
+			wantWhere: "source IN (?, ?)",
+			wantArgs:  []any{"api", "worker"},
+		},
+		{
+			name:      "integers are widened",
+			node:      ComparisonNode{FieldName: "metadata.status", Operator: OperatorIn, Value: []int{500, 503}},
+			wantWhere: "metadata.status IN (?, ?)",
+			wantArgs:  []any{int64(500), int64(503)},
+		},
+		{
+			name:      "single element",
+			node:      ComparisonNode{FieldName: "source", Operator: OperatorIn, Value: []string{"api"}},
+			wantWhere: "source IN (?)",
+			wantArgs:  []any{"api"},
+		},
+		{
+			name:      "empty list matches nothing",
+			node:      ComparisonNode{FieldName: "source", Operator: OperatorIn, Value: []string{}},
+			wantWhere: "1 = 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := newTestBuilder().formatComparison(tt.node)
+			if err != nil {
+				t.Fatalf("cannot format comparison: %v", err)
+			}
+
+			if where != tt.wantWhere {
+				t.Errorf("got where clause %q, want %q", where, tt.wantWhere)
+			}
+
+			if len(args) != len(tt.wantArgs) || (len(args) > 0 && !reflect.DeepEqual(args, tt.wantArgs)) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestFormatComparisonInRequiresList(t *testing.T) {
+	for _, value := range []any{"api", 42, []byte("api")} {
+		_, _, err := newTestBuilder().formatComparison(ComparisonNode{FieldName: "source", Operator: OperatorIn, Value: value})
+		assertBadInput(t, err)
+	}
+}
+
+func TestBuildDistinct(t *testing.T) {
+	b := NewSQLQueryBuilder(SQLOptions{
+		TableName:                "logs",
+		AllowedSortFields:        []string{"timestamp", "source"},
+		AllowedFilterFieldsRegex: regexp.MustCompile(`^(source|metadata\.[a-z_]+)$`),
+		MetadataPathColumn:       func(field string) string { return "json(" + field + ") AS `" + field + "`" },
+	})
+	q := Query{Start: testStart, End: testEnd, Limit: 10}
+
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{
+			name:  "sort field",
+			field: "source",
+			want:  "SELECT DISTINCT source FROM logs WHERE timestamp >= ? AND timestamp < ? ORDER BY 1 LIMIT 10",
+		},
+		{
+			name:  "metadata path",
+			field: "metadata.region",
+			want:  "SELECT DISTINCT json(metadata.region) AS `metadata.region` FROM logs WHERE (timestamp >= ? AND timestamp < ?) AND metadata.region IS NOT NULL ORDER BY 1 LIMIT 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.BuildDistinct(q, tt.field)
+			if err != nil {
+				t.Fatalf("cannot build query: %v", err)
+			}
+			if got.Query != tt.want {
+				t.Errorf("got query %q, want %q", got.Query, tt.want)
+			}
+		})
+	}
+
+	for _, field := range []string{"message", "metadata.Region"} {
+		_, err := b.BuildDistinct(q, field)
+		assertBadInput(t, err)
+	}
+}
@@ -0,0 +1,114 @@
+package querier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+// zonelessLayouts are the layouts accepted for timestamps without a zone, in the order they're tried.
+var zonelessLayouts = []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// ParseTime parses either an absolute RFC3339 timestamp or a time relative to now.
+// Relative expressions are "now" or a signed duration such as "-15m", "-2h" or "-7d".
+// Timestamps without a zone (e.g. "2021-04-17" or "2021-04-17T10:00:00") are interpreted as UTC.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	return ParseTimeInLocation(value, now, time.UTC)
+}
+
+// ParseTimeInLocation is like ParseTime, but interprets timestamps without a zone in loc.
+// Offsets of RFC3339 timestamps are always respected.
+func ParseTimeInLocation(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		d, err := parseRelativeDuration(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	for _, layout := range zonelessLayouts {
+		if t, zerr := time.ParseInLocation(layout, value, loc); zerr == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// parseRelativeDuration parses durations supported by time.ParseDuration, plus whole days (e.g. "-7d").
+func parseRelativeDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid relative time: %s", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid relative time: %s", value)
+	}
+
+	return d, nil
+}
+
+// UnmarshalJSON decodes a query, accepting relative expressions (see ParseTime) for start and end.
+// Relative expressions are resolved against the time of decoding, and timestamps without a zone are interpreted in
+// TimeZone. Since TimeZone is only replaced if it's present in data, it can be set beforehand as a default.
+func (r *Query) UnmarshalJSON(data []byte) error {
+	type query Query
+	aux := struct {
+		*query
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}{query: (*query)(r)}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		return err
+	}
+
+	loc := time.UTC
+	if r.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(r.TimeZone); err != nil {
+			return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{"time_zone": []string{"Unknown time zone."}})
+		}
+	}
+
+	now := time.Now()
+	var err error
+
+	r.Start = time.Time{}
+	if aux.Start != "" {
+		if r.Start, err = ParseTimeInLocation(aux.Start, now, loc); err != nil {
+			return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{"start": []string{"Expected an RFC3339 timestamp or a relative time."}})
+		}
+	}
+
+	r.End = time.Time{}
+	if aux.End != "" {
+		if r.End, err = ParseTimeInLocation(aux.End, now, loc); err != nil {
+			return fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{"end": []string{"Expected an RFC3339 timestamp or a relative time."}})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package querier
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/thisisjab/logzilla/fault"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "now", want: now},
+		{value: "-15m", want: now.Add(-15 * time.Minute)},
+		{value: "-2h", want: now.Add(-2 * time.Hour)},
+		{value: "+1h30m", want: now.Add(90 * time.Minute)},
+		{value: "-7d", want: now.Add(-7 * 24 * time.Hour)},
+		{value: "2024-01-01T10:00:00+02:00", want: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)},
+		{value: "2024-01-01T10:00:00.5", want: time.Date(2024, 1, 1, 10, 0, 0, 5e8, time.UTC)},
+		{value: "2024-01-01 10:00:00", want: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{value: "2024-01-01", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "-1w", wantErr: true},
+		{value: "-d", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTime(tt.value, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot parse time: %v", err)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+3:30", 3*3600+1800)
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "2024-01-01T10:00:00", want: time.Date(2024, 1, 1, 6, 30, 0, 0, time.UTC)},
+		{value: "2024-01-01", want: time.Date(2023, 12, 31, 20, 30, 0, 0, time.UTC)},
+		{value: "2024-01-01T10:00:00Z", want: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{value: "-1h", want: now.Add(-time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimeInLocation(tt.value, now, loc)
+			if err != nil {
+				t.Fatalf("cannot parse time: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryUnmarshalJSONTimes(t *testing.T) {
+	const tolerance = time.Minute
+
+	tests := []struct {
+		name      string
+		timeZone  string
+		data      string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "relative bounds",
+			data:      `{"start": "-1h", "end": "now"}`,
+			wantStart: time.Now().Add(-time.Hour),
+			wantEnd:   time.Now(),
+		},
+		{
+			name:      "relative and absolute bounds",
+			data:      `{"start": "2024-01-01T00:00:00Z", "end": "-1d"}`,
+			wantStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Now().Add(-24 * time.Hour),
+		},
+		{
+			name:      "time zone of zoneless timestamps",
+			data:      `{"start": "2024-01-01", "end": "2024-01-02T00:00:00Z", "time_zone": "America/New_York"}`,
+			wantStart: time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "default time zone",
+			timeZone:  "America/New_York",
+			data:      `{"start": "2024-01-01T00:00:00", "end": "now"}`,
+			wantStart: time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			wantEnd:   time.Now(),
+		},
+		{
+			name:      "time zone overriding the default",
+			timeZone:  "America/New_York",
+			data:      `{"start": "2024-01-01", "end": "now", "time_zone": "UTC"}`,
+			wantStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Now(),
+		},
+		{
+			name: "no bounds",
+			data: `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Query{TimeZone: tt.timeZone}
+			if err := json.Unmarshal([]byte(tt.data), &q); err != nil {
+				t.Fatalf("cannot decode query: %v", err)
+			}
+
+			if q.Start.Sub(tt.wantStart).Abs() > tolerance || q.Start.IsZero() != tt.wantStart.IsZero() {
+				t.Errorf("got start %v, want %v", q.Start, tt.wantStart)
+			}
+			if q.End.Sub(tt.wantEnd).Abs() > tolerance || q.End.IsZero() != tt.wantEnd.IsZero() {
+				t.Errorf("got end %v, want %v", q.End, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestQueryUnmarshalJSONInvalidTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantField string
+	}{
+		{name: "invalid start", data: `{"start": "yesterday"}`, wantField: "start"},
+		{name: "invalid end", data: `{"start": "-1h", "end": "-1x"}`, wantField: "end"},
+		{name: "unknown time zone", data: `{"start": "2024-01-01", "time_zone": "Mars/Olympus_Mons"}`, wantField: "time_zone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+			err := json.Unmarshal([]byte(tt.data), &q)
+
+			var f fault.Fault
+			if !errors.As(err, &f) || f.Code() != fault.BadInputCode {
+				t.Fatalf("got error %v, want a bad input fault", err)
+			}
+			if fields, ok := f.Metadata().(fault.FieldErrorsMetadata); !ok || len(fields[tt.wantField]) == 0 {
+				t.Errorf("got metadata %v, want an error for %s", f.Metadata(), tt.wantField)
+			}
+		})
+	}
+}
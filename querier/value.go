@@ -0,0 +1,109 @@
+package querier
+
+import (
+	"reflect"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// ValueKind is the kind of a comparison value, used by drivers to cast dynamically typed fields (e.g. metadata
+// paths) before comparing them, so numbers are compared numerically rather than lexicographically.
+type ValueKind uint8
+
+const (
+	ValueKindUnknown ValueKind = iota
+	ValueKindString
+	ValueKindInt
+	ValueKindFloat
+	ValueKindBool
+)
+
+// KindOf returns the kind of v. For lists (e.g. values of OperatorIn), the kind of the first element is returned.
+func KindOf(v any) ValueKind {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8 {
+		if rv.Len() == 0 {
+			return ValueKindUnknown
+		}
+		rv = reflect.ValueOf(rv.Index(0).Interface())
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return ValueKindString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ValueKindInt
+	case reflect.Float32, reflect.Float64:
+		return ValueKindFloat
+	case reflect.Bool:
+		return ValueKindBool
+	default:
+		return ValueKindUnknown
+	}
+}
+
+// normalizeValue converts integers to int64 and floats to float64, including elements of lists.
+// Other values, and lists which don't need conversion, are returned unchanged.
+func normalizeValue(v any) any {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		switch rv.Type().Elem().Kind() {
+		case reflect.Uint8, reflect.String, reflect.Int64, reflect.Float64, reflect.Bool:
+			return v
+		}
+
+		res := make([]any, rv.Len())
+		for i := range res {
+			res[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// LevelValue returns the value of the comparison. For comparisons on the level field, log level names
+// (case-insensitive) are converted to their numeric values, including elements of lists, so levels are compared by
+// their order (e.g. `level >= warn`). Values of other fields and of pattern operators are returned unchanged.
+// The second return value is false if a name is not a known log level.
+func (n ComparisonNode) LevelValue() (any, bool) {
+	switch {
+	case n.FieldName != "level":
+		return n.Value, true
+	case n.Operator == OperatorLike, n.Operator == OperatorILike, n.Operator == OperatorNotLike, n.Operator == OperatorMatch:
+		return n.Value, true
+	default:
+		return levelValue(n.Value)
+	}
+}
+
+func levelValue(v any) (any, bool) {
+	if name, ok := v.(string); ok {
+		level, ok := entity.ParseLogLevel(name)
+		return int64(level), ok
+	}
+
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return v, true
+	}
+
+	res := make([]any, rv.Len())
+	for i := range res {
+		var ok bool
+		if res[i], ok = levelValue(rv.Index(i).Interface()); !ok {
+			return nil, false
+		}
+	}
+
+	return res, true
+}
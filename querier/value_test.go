@@ -0,0 +1,91 @@
+package querier
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  ValueKind
+	}{
+		{name: "string", value: "2000", want: ValueKindString},
+		{name: "int", value: 2000, want: ValueKindInt},
+		{name: "unsigned int", value: uint16(2000), want: ValueKindInt},
+		{name: "float", value: 0.5, want: ValueKindFloat},
+		{name: "bool", value: true, want: ValueKindBool},
+		{name: "nil", value: nil, want: ValueKindUnknown},
+		{name: "bytes", value: []byte("2000"), want: ValueKindUnknown},
+		{name: "list takes its first element", value: []any{int64(1), "two"}, want: ValueKindInt},
+		{name: "empty list", value: []string{}, want: ValueKindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.value); got != tt.want {
+				t.Errorf("got kind %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "int", value: 2000, want: int64(2000)},
+		{name: "unsigned int", value: uint8(7), want: int64(7)},
+		{name: "float32", value: float32(0.5), want: float64(0.5)},
+		{name: "string is unchanged", value: "2000", want: "2000"},
+		{name: "list of ints", value: []int{1, 2}, want: []any{int64(1), int64(2)}},
+		{name: "list of strings is unchanged", value: []string{"a", "b"}, want: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparisonNodeLevelValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		node   ComparisonNode
+		want   any
+		wantOk bool
+	}{
+		{name: "level name", node: ComparisonNode{FieldName: "level", Operator: OperatorGte, Value: "warn"}, want: int64(entity.LogLevelWarn), wantOk: true},
+		{name: "level name in capitals", node: ComparisonNode{FieldName: "level", Operator: OperatorEq, Value: "ERROR"}, want: int64(entity.LogLevelError), wantOk: true},
+		{name: "numeric level", node: ComparisonNode{FieldName: "level", Operator: OperatorGte, Value: 3}, want: 3, wantOk: true},
+		{
+			name:   "list of level names",
+			node:   ComparisonNode{FieldName: "level", Operator: OperatorIn, Value: []string{"debug", "fatal"}},
+			want:   []any{int64(entity.LogLevelDebug), int64(entity.LogLevelFatal)},
+			wantOk: true,
+		},
+		{name: "unknown level name", node: ComparisonNode{FieldName: "level", Operator: OperatorEq, Value: "verbose"}},
+		{name: "pattern on level", node: ComparisonNode{FieldName: "level", Operator: OperatorLike, Value: "WA%"}, want: "WA%", wantOk: true},
+		{name: "other fields", node: ComparisonNode{FieldName: "source", Operator: OperatorEq, Value: "warn"}, want: "warn", wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.node.LevelValue()
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
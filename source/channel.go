@@ -0,0 +1,74 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+type ChannelLogSourceConfig struct {
+	Name           string   `yaml:"-"`
+	ProcessorNames []string `yaml:"processors"`
+	BufferSize     uint     `yaml:"buffer_size"`
+}
+
+// ChannelLogSource is an in-process log source. Records pushed into it (e.g. by the ingest API) are provided to the
+// engine like records of any other source, so they still run through the configured processors.
+type ChannelLogSource struct {
+	cfg     ChannelLogSourceConfig
+	logger  *slog.Logger
+	records chan entity.LogRecord
+}
+
+// NewChannelLogSource creates a new ChannelLogSource instance.
+func NewChannelLogSource(logger *slog.Logger, cfg ChannelLogSourceConfig) (*ChannelLogSource, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("name cannot be empty")
+	}
+
+	return &ChannelLogSource{
+		cfg:     cfg,
+		logger:  logger,
+		records: make(chan entity.LogRecord, cfg.BufferSize),
+	}, nil
+}
+
+func (c *ChannelLogSource) Name() string {
+	return c.cfg.Name
+}
+
+func (c *ChannelLogSource) ProcessorNames() []string {
+	return c.cfg.ProcessorNames
+}
+
+// Push queues records to be provided to the engine. It blocks until all records are queued or ctx is done.
+func (c *ChannelLogSource) Push(ctx context.Context, records ...entity.LogRecord) error {
+	for _, r := range records {
+		r.Source = c.Name()
+
+		select {
+		case c.records <- r:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (c *ChannelLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-c.records:
+			select {
+			case logChan <- r:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
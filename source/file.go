@@ -2,24 +2,45 @@ package source
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/thisisjab/logzilla/entity"
 )
 
+const (
+	defaultMaxLineBytes = 1024 * 1024
+	defaultDelimiter    = "\n"
+)
+
 type FileLogSourceConfig struct {
-	Name           string   `yaml:"-"`
+	Name string `yaml:"-"`
+	// FilePath is either the path of a single file, or a glob pattern (e.g. `/var/log/app-*.log`).
+	// When it's a pattern, every matching file is tailed, including the ones created later, and records are tagged
+	// with `<source name>/<file name>` as their source.
 	FilePath       string   `yaml:"path"`
 	ProcessorNames []string `yaml:"processors"`
+	// MaxLineBytes is the maximum length of a line. Longer lines are truncated. Defaults to 1 MiB.
+	MaxLineBytes uint `yaml:"max_line_bytes"`
+	// StartFromLines is the number of existing lines at the end of the file to provide on start, like `tail -n`.
+	// Defaults to zero, which only provides lines written after start.
+	StartFromLines uint `yaml:"start_from_lines"`
+	// Delimiter is the single byte which terminates lines, e.g. "\0" for null-delimited records. Defaults to "\n".
+	Delimiter string `yaml:"delimiter"`
+	// KeepCarriageReturn keeps a carriage return preceding the delimiter, which is trimmed by default.
+	KeepCarriageReturn bool `yaml:"keep_carriage_return"`
 }
 
-// FileLogSource works by watching a file for changes and reading new lines as they are written.
+// FileLogSource works by watching a file (or files matching a pattern) for changes and reading new lines as they are written.
 type FileLogSource struct {
 	cfg    FileLogSourceConfig
 	logger *slog.Logger
@@ -35,6 +56,22 @@ func NewFileLogSource(logger *slog.Logger, cfg FileLogSourceConfig) (*FileLogSou
 		return nil, fmt.Errorf("file path cannot be empty")
 	}
 
+	if _, err := filepath.Match(cfg.FilePath, ""); err != nil {
+		return nil, fmt.Errorf("invalid file path pattern: %w", err)
+	}
+
+	if cfg.MaxLineBytes == 0 {
+		cfg.MaxLineBytes = defaultMaxLineBytes
+	}
+
+	if cfg.Delimiter == "" {
+		cfg.Delimiter = defaultDelimiter
+	}
+
+	if len(cfg.Delimiter) != 1 {
+		return nil, fmt.Errorf("delimiter must be a single byte")
+	}
+
 	return &FileLogSource{
 		logger: logger,
 		cfg:    cfg,
@@ -50,15 +87,33 @@ func (f *FileLogSource) ProcessorNames() []string {
 }
 
 func (f *FileLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
-	file, err := os.Open(f.cfg.FilePath)
+	if isFilePattern(f.cfg.FilePath) {
+		return f.providePattern(ctx, logChan)
+	}
+
+	return f.tail(ctx, f.cfg.FilePath, f.Name(), false, logChan)
+}
+
+// tail provides lines written to the file at path, tagging records with the given source.
+// If fromStart is set, the whole file is provided, otherwise only the last StartFromLines lines are.
+func (f *FileLogSource) tail(ctx context.Context, path, source string, fromStart bool, logChan chan<- entity.LogRecord) error {
+	file, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("cannot open file: %w", err)
 	}
 	defer file.Close()
 
-	// Always seek to the end of the file
+	// Seek to the end of the file, or to the start of the last lines if configured
 	// Note that when file is read (when notified by fsnotify), the cursor will move to end of file
-	_, err = file.Seek(0, io.SeekEnd)
+	var offset int64
+	if !fromStart {
+		offset, err = lastLinesOffset(file, f.cfg.StartFromLines, f.delimiter())
+		if err != nil {
+			return fmt.Errorf("cannot find last lines: %w", err)
+		}
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
 	if err != nil {
 		return err
 	}
@@ -69,11 +124,23 @@ func (f *FileLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRe
 	}
 	defer watcher.Close()
 
-	if err := watcher.Add(f.cfg.FilePath); err != nil {
+	if err := watcher.Add(path); err != nil {
 		return fmt.Errorf("cannot add file to watcher: %w", err)
 	}
 
-	reader := bufio.NewReader(file)
+	// The splitter outlives scanners, so the rest of a truncated line is discarded even if written later.
+	splitter := &lineSplitter{
+		delimiter: f.delimiter(),
+		trimCR:    !f.cfg.KeepCarriageReturn,
+		maxLen:    int(f.cfg.MaxLineBytes),
+	}
+
+	// Provide the existing last lines. The watcher is already set up, so lines written meanwhile are not missed.
+	if fromStart || f.cfg.StartFromLines > 0 {
+		if err := f.readLines(file, splitter, source, logChan); err != nil {
+			return err
+		}
+	}
 
 	for {
 		select {
@@ -85,6 +152,11 @@ func (f *FileLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRe
 				f.logger.Debug("fsnotify watcher channel is closed.")
 				return nil
 			}
+			// Attribute changes (e.g. by `touch` or backup tools) never change the contents, and they're frequent
+			// on busy filesystems, so they're ignored without logging each of them.
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
 			if !event.Has(fsnotify.Write) {
 				// TODO: handle file rotation
 				// Editors like vim, create a new file and rewrite all changes, when even a single line is appended.
@@ -98,22 +170,8 @@ func (f *FileLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRe
 				continue
 			}
 
-			for {
-				line, err := reader.ReadBytes('\n')
-				if len(line) > 0 {
-					l := entity.LogRecord{
-						Source:    f.Name(),
-						RawData:   line,
-						Timestamp: time.Now(),
-					}
-					logChan <- l
-				}
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					return err
-				}
+			if err := f.readLines(file, splitter, source, logChan); err != nil {
+				return err
 			}
 
 		case err, ok := <-watcher.Errors:
@@ -124,3 +182,255 @@ func (f *FileLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRe
 		}
 	}
 }
+
+// providePattern tails every file matching the configured pattern. The directory of the pattern is watched, so files
+// created later are tailed from their start, and files which are removed or renamed stop being tailed.
+func (f *FileLogSource) providePattern(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	pattern := f.cfg.FilePath
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(pattern)); err != nil {
+		return fmt.Errorf("cannot add directory to watcher: %w", err)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		tailers = make(map[string]context.CancelFunc)
+	)
+
+	// Files are tailed until ctx is done or they're removed, and a failing file doesn't stop the others.
+	startTail := func(path string, fromStart bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := tailers[path]; ok {
+			return
+		}
+
+		tailCtx, cancel := context.WithCancel(ctx)
+		tailers[path] = cancel
+
+		source := f.Name() + "/" + filepath.Base(path)
+		f.logger.Info("tailing file.", "source", f.Name(), "path", path)
+
+		wg.Go(func() {
+			if err := f.tail(tailCtx, path, source, fromStart, logChan); err != nil {
+				f.logger.Error("cannot tail file.", "source", f.Name(), "path", path, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			// The file may have been stopped and tailed again meanwhile.
+			if tailCtx.Err() == nil {
+				delete(tailers, path)
+			}
+			cancel()
+		})
+	}
+
+	stopTail := func(path string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if cancel, ok := tailers[path]; ok {
+			f.logger.Info("stopped tailing file.", "source", f.Name(), "path", path)
+			cancel()
+			delete(tailers, path)
+		}
+	}
+
+	defer wg.Wait()
+
+	// The directory is already watched, so files created meanwhile are not missed.
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("cannot expand file path pattern: %w", err)
+	}
+
+	for _, path := range matches {
+		startTail(path, false)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				f.logger.Debug("fsnotify watcher channel is closed.")
+				return nil
+			}
+
+			if matched, _ := filepath.Match(pattern, event.Name); !matched {
+				continue
+			}
+
+			switch {
+			case event.Has(fsnotify.Create):
+				startTail(event.Name, true)
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				stopTail(event.Name)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// isFilePattern reports whether path contains any of the special characters of filepath.Match.
+func isFilePattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// readLines provides all lines up to the end of the file, tagging records with the given source.
+// A line which isn't terminated yet is provided as is, and the rest of it is provided as another line.
+func (f *FileLogSource) readLines(reader io.Reader, splitter *lineSplitter, source string, logChan chan<- entity.LogRecord) error {
+	// A scanner stops at the end of the file, so a new one is used every time the file is written.
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, min(splitter.maxLen+1, 64*1024)), splitter.maxLen+1)
+	scanner.Split(splitter.split)
+
+	for scanner.Scan() {
+		if splitter.truncated {
+			truncatedLines.WithLabelValues(f.Name()).Inc()
+			f.logger.Warn("truncated line exceeding max line length.", "source", f.Name(), "max_line_bytes", f.cfg.MaxLineBytes)
+		}
+
+		if line := scanner.Bytes(); len(line) > 0 {
+			now := time.Now().UTC()
+			l := entity.LogRecord{
+				Source: source,
+				// The scanner reuses its buffer.
+				RawData:    bytes.Clone(line),
+				Timestamp:  now,
+				IngestedAt: now,
+			}
+			logChan <- l
+		}
+	}
+
+	return scanner.Err()
+}
+
+// lastLinesOffset returns the offset where the last n lines of the file start. If the file has fewer lines, it
+// returns zero. If n is zero, it returns the size of the file. The file is read backwards in chunks, so only the
+// last lines are read.
+func lastLinesOffset(file *os.File, n uint, delimiter byte) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	if n == 0 || size == 0 {
+		return size, nil
+	}
+
+	const chunkSize = 4096
+	buf := make([]byte, chunkSize)
+
+	// A trailing delimiter terminates the last line, it doesn't start a new one.
+	end := size
+	if _, err := file.ReadAt(buf[:1], size-1); err != nil {
+		return 0, err
+	}
+	if buf[0] == delimiter {
+		end--
+	}
+
+	var newlines uint
+	for end > 0 {
+		start := max(end-chunkSize, 0)
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != delimiter {
+				continue
+			}
+
+			newlines++
+			if newlines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+
+		end = start
+	}
+
+	return 0, nil
+}
+
+func (f *FileLogSource) delimiter() byte {
+	return f.cfg.Delimiter[0]
+}
+
+// lineSplitter splits data into lines for bufio.Scanner, without the delimiter. Lines longer than maxLen are truncated
+// to that length and the rest of the line is discarded, so a single line never grows the buffer unbounded.
+type lineSplitter struct {
+	delimiter byte
+	trimCR    bool
+	maxLen    int
+
+	// truncated reports whether the last line was truncated.
+	truncated bool
+	// discarding is set while the rest of a truncated line is being skipped.
+	discarding bool
+}
+
+func (s *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	s.truncated = false
+
+	if i := bytes.IndexByte(data, s.delimiter); i >= 0 {
+		if s.discarding {
+			s.discarding = false
+			return i + 1, nil, nil
+		}
+
+		line := data[:i]
+		if len(line) > s.maxLen {
+			line = line[:s.maxLen]
+			s.truncated = true
+		}
+
+		return i + 1, s.trim(line), nil
+	}
+
+	if s.discarding {
+		return len(data), nil, nil
+	}
+
+	if len(data) > s.maxLen {
+		s.discarding = true
+		s.truncated = true
+		return len(data), data[:s.maxLen], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), s.trim(data), nil
+	}
+
+	// Requests more data.
+	return 0, nil, nil
+}
+
+func (s *lineSplitter) trim(line []byte) []byte {
+	if s.trimCR {
+		return bytes.TrimSuffix(line, []byte{'\r'})
+	}
+
+	return line
+}
@@ -0,0 +1,350 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes, used to capture logs.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// newTestFileSource creates a file source logging into the returned buffer at debug level.
+func newTestFileSource(t *testing.T, cfg FileLogSourceConfig) (*FileLogSource, *lockedBuffer) {
+	t.Helper()
+
+	if cfg.Name == "" {
+		cfg.Name = "files"
+	}
+
+	logs := &lockedBuffer{}
+	f, err := NewFileLogSource(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})), cfg)
+	if err != nil {
+		t.Fatalf("cannot create source: %v", err)
+	}
+	return f, logs
+}
+
+// readTestLines reads every line of the chunks, written one after another, with the splitter of f.
+func readTestLines(t *testing.T, f *FileLogSource, chunks ...string) []string {
+	t.Helper()
+
+	splitter := &lineSplitter{delimiter: f.delimiter(), trimCR: !f.cfg.KeepCarriageReturn, maxLen: int(f.cfg.MaxLineBytes)}
+	logChan := make(chan entity.LogRecord, 100)
+
+	for _, chunk := range chunks {
+		if err := f.readLines(strings.NewReader(chunk), splitter, f.Name(), logChan); err != nil {
+			t.Fatalf("cannot read lines: %v", err)
+		}
+	}
+	close(logChan)
+
+	var lines []string
+	for record := range logChan {
+		lines = append(lines, string(record.RawData))
+	}
+	return lines
+}
+
+func TestFileLogSourceTruncatesLongLines(t *testing.T) {
+	f, logs := newTestFileSource(t, FileLogSourceConfig{FilePath: "app.log", MaxLineBytes: 8})
+
+	// The rest of the long line is discarded, even when it's written later.
+	got := readTestLines(t, f, "short\n"+strings.Repeat("x", 100), strings.Repeat("y", 100)+"\nok\n")
+
+	want := []string{"short", "xxxxxxxx", "ok"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+
+	if got := strings.Count(logs.String(), "truncated line exceeding max line length"); got != 1 {
+		t.Errorf("got %d warnings logged, want 1: %s", got, logs)
+	}
+}
+
+func TestFileLogSourceDefaultMaxLineBytes(t *testing.T) {
+	f, _ := newTestFileSource(t, FileLogSourceConfig{FilePath: "app.log"})
+
+	line := strings.Repeat("x", 200*1024)
+	if got := readTestLines(t, f, line+"\n"); len(got) != 1 || got[0] != line {
+		t.Errorf("got %d lines, want the long line as is", len(got))
+	}
+}
+
+// startTestSource provides records of f until the test ends.
+func startTestSource(t *testing.T, f *FileLogSource) <-chan entity.LogRecord {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logChan := make(chan entity.LogRecord, 1000)
+	done := make(chan error, 1)
+	go func() { done <- f.Provide(ctx, logChan) }()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("cannot provide logs: %v", err)
+		}
+	})
+	return logChan
+}
+
+// receiveRecords receives n records, failing the test if they aren't provided in time.
+func receiveRecords(t *testing.T, logChan <-chan entity.LogRecord, n int) []entity.LogRecord {
+	t.Helper()
+
+	var records []entity.LogRecord
+	for len(records) < n {
+		select {
+		case record := <-logChan:
+			records = append(records, record)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d records, want %d", len(records), n)
+		}
+	}
+	return records
+}
+
+func rawLines(records []entity.LogRecord) []string {
+	lines := make([]string, len(records))
+	for i, record := range records {
+		lines[i] = string(record.RawData)
+	}
+	return lines
+}
+
+// appendToFile appends data to the file at path, creating it if needed.
+func appendToFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("cannot open file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+
+	tests := []struct {
+		name    string
+		content string
+		n       uint
+		want    string
+	}{
+		{name: "zero lines", content: "a\nb\n", n: 0, want: ""},
+		{name: "last lines", content: "a\nb\nc\n", n: 2, want: "b\nc\n"},
+		{name: "unterminated last line", content: "a\nb\nc", n: 2, want: "b\nc"},
+		{name: "fewer lines than wanted", content: "a\nb\n", n: 10, want: "a\nb\n"},
+		{name: "empty file", content: "", n: 3, want: ""},
+		{name: "lines across chunks", content: "a\n" + long + "\n" + long + "\nb\n", n: 2, want: long + "\nb\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			appendToFile(t, path, tt.content)
+
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("cannot open file: %v", err)
+			}
+			defer file.Close()
+
+			offset, err := lastLinesOffset(file, tt.n, '\n')
+			if err != nil {
+				t.Fatalf("cannot find last lines: %v", err)
+			}
+			if got := tt.content[offset:]; got != tt.want {
+				t.Errorf("got last lines %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileLogSourceStartFromLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	var content strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	appendToFile(t, path, content.String())
+
+	f, _ := newTestFileSource(t, FileLogSourceConfig{FilePath: path, StartFromLines: 10})
+	logChan := startTestSource(t, f)
+
+	var want []string
+	for i := 90; i < 100; i++ {
+		want = append(want, fmt.Sprintf("line %d", i))
+	}
+	if got := rawLines(receiveRecords(t, logChan, 10)); !slices.Equal(got, want) {
+		t.Fatalf("got lines %q, want %q", got, want)
+	}
+
+	// Lines written after start follow the existing ones.
+	appendToFile(t, path, "line 100\n")
+	if got := rawLines(receiveRecords(t, logChan, 1)); !slices.Equal(got, []string{"line 100"}) {
+		t.Errorf("got lines %q, want the appended line", got)
+	}
+}
+
+func TestFileLogSourcePattern(t *testing.T) {
+	dir := t.TempDir()
+	appendToFile(t, filepath.Join(dir, "app-1.log"), "one started\n")
+	appendToFile(t, filepath.Join(dir, "app-2.log"), "two started\n")
+	appendToFile(t, filepath.Join(dir, "other.txt"), "ignored\n")
+
+	f, _ := newTestFileSource(t, FileLogSourceConfig{FilePath: filepath.Join(dir, "app-*.log"), StartFromLines: 1})
+	logChan := startTestSource(t, f)
+
+	// Existing files are being tailed once their last lines are provided.
+	sources := func(records []entity.LogRecord) map[string]string {
+		m := make(map[string]string)
+		for _, record := range records {
+			m[string(record.RawData)] = record.Source
+		}
+		return m
+	}
+	got := sources(receiveRecords(t, logChan, 2))
+
+	// Lines appended to tailed files are provided, and matching files created later are provided from their start.
+	appendToFile(t, filepath.Join(dir, "app-1.log"), "one done\n")
+	appendToFile(t, filepath.Join(dir, "app-2.log"), "two done\n")
+	appendToFile(t, filepath.Join(dir, "app-3.log"), "three started\nthree done\n")
+	appendToFile(t, filepath.Join(dir, "other.txt"), "ignored\n")
+	for line, source := range sources(receiveRecords(t, logChan, 4)) {
+		got[line] = source
+	}
+
+	want := map[string]string{
+		"one started":   "files/app-1.log",
+		"two started":   "files/app-2.log",
+		"one done":      "files/app-1.log",
+		"two done":      "files/app-2.log",
+		"three started": "files/app-3.log",
+		"three done":    "files/app-3.log",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got lines %v, want %v", got, want)
+	}
+	for line, source := range want {
+		if got[line] != source {
+			t.Errorf("got line %q from source %q, want %q", line, got[line], source)
+		}
+	}
+
+	select {
+	case record := <-logChan:
+		t.Errorf("got unexpected record %q from %s", record.RawData, record.Source)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFileLogSourceDelimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    FileLogSourceConfig
+		chunks []string
+		want   []string
+	}{
+		{
+			name:   "default newline",
+			chunks: []string{"first\nsecond\n\nthird"},
+			want:   []string{"first", "second", "third"},
+		},
+		{
+			name:   "carriage returns are trimmed",
+			chunks: []string{"first\r\nsecond\r\n", "third\r"},
+			want:   []string{"first", "second", "third"},
+		},
+		{
+			name:   "carriage returns are kept",
+			cfg:    FileLogSourceConfig{KeepCarriageReturn: true},
+			chunks: []string{"first\r\nsecond\r\n"},
+			want:   []string{"first\r", "second\r"},
+		},
+		{
+			name:   "null byte",
+			cfg:    FileLogSourceConfig{Delimiter: "\x00"},
+			chunks: []string{"multi\nline\x00second\x00"},
+			want:   []string{"multi\nline", "second"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.FilePath = "app.log"
+			f, _ := newTestFileSource(t, cfg)
+
+			if got := readTestLines(t, f, tt.chunks...); !slices.Equal(got, tt.want) {
+				t.Errorf("got lines %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFileLogSourceInvalidDelimiter(t *testing.T) {
+	if _, err := NewFileLogSource(slog.Default(), FileLogSourceConfig{Name: "files", FilePath: "app.log", Delimiter: "\r\n"}); err == nil {
+		t.Error("got no error, want one for a delimiter of several bytes")
+	}
+}
+
+func TestFileLogSourceIgnoresAttributeChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendToFile(t, path, "started\n")
+
+	f, logs := newTestFileSource(t, FileLogSourceConfig{FilePath: path, StartFromLines: 1})
+	logChan := startTestSource(t, f)
+	receiveRecords(t, logChan, 1)
+
+	for i := range 100 {
+		if err := os.Chmod(path, os.FileMode(0o600+i%2*0o040)); err != nil {
+			t.Fatalf("cannot change file mode: %v", err)
+		}
+	}
+
+	// Events are handled in order, so the attribute changes are handled once the appended line is provided.
+	appendToFile(t, path, "done\n")
+	if got := rawLines(receiveRecords(t, logChan, 1)); !slices.Equal(got, []string{"done"}) {
+		t.Fatalf("got lines %q, want the appended line", got)
+	}
+
+	// Consecutive attribute changes may be coalesced into a single event, so no log line is logged at all.
+	if got := logs.String(); got != "" {
+		t.Errorf("got logs %s, want the attribute changes ignored silently", got)
+	}
+}
@@ -0,0 +1,11 @@
+package source
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var truncatedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "logzilla_source_truncated_lines_total",
+	Help: "Number of lines truncated for exceeding the maximum line length, per source.",
+}, []string{"source"})
@@ -0,0 +1,139 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/thisisjab/logzilla/entity"
+)
+
+type NATSLogSourceConfig struct {
+	Name           string   `yaml:"-"`
+	ProcessorNames []string `yaml:"processors"`
+	// Servers lists the URLs of the NATS servers. Defaults to "nats://127.0.0.1:4222".
+	Servers []string `yaml:"servers"`
+	// Subject is the subject to subscribe to. Wildcards (e.g. `logs.>`) are allowed.
+	Subject string `yaml:"subject"`
+	// Durable is the name of a durable JetStream consumer. When set, messages are consumed through JetStream and
+	// acknowledged once queued, so messages published while the source isn't running are not lost. Otherwise, the
+	// subject is subscribed to with core NATS.
+	Durable string `yaml:"durable"`
+}
+
+// NATSLogSource provides messages published to a NATS subject, optionally through a durable JetStream consumer.
+type NATSLogSource struct {
+	cfg    NATSLogSourceConfig
+	logger *slog.Logger
+}
+
+// NewNATSLogSource creates a new NATSLogSource instance.
+func NewNATSLogSource(logger *slog.Logger, cfg NATSLogSourceConfig) (*NATSLogSource, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("name cannot be empty")
+	}
+
+	if cfg.Subject == "" {
+		return nil, fmt.Errorf("subject cannot be empty")
+	}
+
+	if len(cfg.Servers) == 0 {
+		cfg.Servers = []string{nats.DefaultURL}
+	}
+
+	return &NATSLogSource{
+		cfg:    cfg,
+		logger: logger,
+	}, nil
+}
+
+func (n *NATSLogSource) Name() string {
+	return n.cfg.Name
+}
+
+func (n *NATSLogSource) ProcessorNames() []string {
+	return n.cfg.ProcessorNames
+}
+
+func (n *NATSLogSource) Provide(ctx context.Context, logChan chan<- entity.LogRecord) error {
+	// The client reconnects on its own for as long as the source runs. Once the connection is closed, an error is
+	// returned, so the engine restarts the source.
+	conn, err := nats.Connect(strings.Join(n.cfg.Servers, ","),
+		nats.Name("logzilla-"+n.Name()),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			n.logger.Warn("disconnected from nats.", "source", n.Name(), "error", err)
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			n.logger.Info("reconnected to nats.", "source", n.Name(), "url", c.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("cannot connect to nats: %w", err)
+	}
+	// Closing the connection, rather than unsubscribing, keeps the durable consumer.
+	defer conn.Close()
+
+	sub, err := n.subscribe(conn)
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("cannot receive message: %w", err)
+		}
+
+		now := time.Now().UTC()
+		l := entity.LogRecord{
+			Source:     n.Name(),
+			RawData:    msg.Data,
+			Timestamp:  now,
+			IngestedAt: now,
+		}
+
+		select {
+		case logChan <- l:
+		case <-ctx.Done():
+			// The message isn't acknowledged, so JetStream redelivers it.
+			return nil
+		}
+
+		if n.cfg.Durable != "" {
+			if err := msg.Ack(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+				n.logger.Warn("cannot acknowledge message.", "source", n.Name(), "error", err)
+			}
+		}
+	}
+}
+
+// subscribe subscribes to the subject, through the durable JetStream consumer if configured.
+func (n *NATSLogSource) subscribe(conn *nats.Conn) (*nats.Subscription, error) {
+	if n.cfg.Durable == "" {
+		sub, err := conn.SubscribeSync(n.cfg.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("cannot subscribe to subject: %w", err)
+		}
+		return sub, nil
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create jetstream context: %w", err)
+	}
+
+	sub, err := js.SubscribeSync(n.cfg.Subject, nats.Durable(n.cfg.Durable), nats.ManualAck())
+	if err != nil {
+		return nil, fmt.Errorf("cannot subscribe to subject: %w", err)
+	}
+
+	return sub, nil
+}
@@ -0,0 +1,182 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisjab/logzilla/entity"
+)
+
+// startFakeNATSServer serves the core NATS protocol on a local port for the duration of the test, publishing
+// messages on "logs.api" to every subscription. It returns the URL of the server.
+func startFakeNATSServer(t *testing.T, messages ...string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var conns []net.Conn
+
+	t.Cleanup(func() {
+		l.Close()
+		mu.Lock()
+		for _, c := range conns {
+			c.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serveFakeNATSConn(c, messages)
+			}()
+		}
+	}()
+
+	return "nats://" + l.Addr().String()
+}
+
+func serveFakeNATSConn(c net.Conn, messages []string) {
+	defer c.Close()
+
+	fmt.Fprintf(c, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			io.WriteString(c, "PONG\r\n")
+		case "SUB":
+			sid := fields[len(fields)-1]
+			for _, m := range messages {
+				fmt.Fprintf(c, "MSG logs.api %s %d\r\n%s\r\n", sid, len(m), m)
+			}
+		}
+	}
+}
+
+func TestNATSLogSourceProvidesMessages(t *testing.T) {
+	url := startFakeNATSServer(t, `{"level": "info", "msg": "started"}`, "plain text line")
+
+	n, err := NewNATSLogSource(slog.New(slog.NewTextHandler(io.Discard, nil)), NATSLogSourceConfig{
+		Name:    "events",
+		Servers: []string{url},
+		Subject: "logs.>",
+	})
+	if err != nil {
+		t.Fatalf("cannot create source: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logChan := make(chan entity.LogRecord, 10)
+	done := make(chan error, 1)
+	go func() { done <- n.Provide(ctx, logChan) }()
+
+	var records []entity.LogRecord
+	for len(records) < 2 {
+		select {
+		case record := <-logChan:
+			records = append(records, record)
+		case err := <-done:
+			t.Fatalf("got source stopped with error %v, want it running", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d records, want 2", len(records))
+		}
+	}
+
+	want := []string{`{"level": "info", "msg": "started"}`, "plain text line"}
+	if got := rawLines(records); !slices.Equal(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+	for _, r := range records {
+		if r.Source != "events" || r.Timestamp.IsZero() || r.Timestamp.Location() != time.UTC {
+			t.Errorf("got source %q and timestamp %v, want events and a UTC timestamp", r.Source, r.Timestamp)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error %v once cancelled, want none", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got source still running once cancelled")
+	}
+}
+
+func TestNATSLogSourceUnreachableServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	url := "nats://" + l.Addr().String()
+	l.Close()
+
+	n, err := NewNATSLogSource(slog.New(slog.NewTextHandler(io.Discard, nil)), NATSLogSourceConfig{Name: "events", Servers: []string{url}, Subject: "logs"})
+	if err != nil {
+		t.Fatalf("cannot create source: %v", err)
+	}
+
+	if err := n.Provide(context.Background(), make(chan entity.LogRecord)); err == nil {
+		t.Error("got no error, want one so the source is restarted")
+	}
+}
+
+func TestNewNATSLogSourceInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  NATSLogSourceConfig
+	}{
+		{name: "no name", cfg: NATSLogSourceConfig{Subject: "logs"}},
+		{name: "no subject", cfg: NATSLogSourceConfig{Name: "events"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewNATSLogSource(slog.New(slog.NewTextHandler(io.Discard, nil)), tt.cfg); err == nil {
+				t.Error("got no error, want one")
+			}
+		})
+	}
+}
@@ -0,0 +1,813 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/fault"
+	"github.com/thisisjab/logzilla/querier"
+)
+
+type ElasticStorageConfig struct {
+	// Addr is the base URL of the cluster, e.g. http://localhost:9200
+	Addr     string `yaml:"addr"`
+	Index    string `yaml:"index"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// ElasticStorage stores and queries processed logs using Elasticsearch (or OpenSearch) REST API.
+type ElasticStorage struct {
+	cfg    ElasticStorageConfig
+	client *http.Client
+}
+
+func NewElasticStorage(cfg ElasticStorageConfig) (*ElasticStorage, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("address cannot be empty")
+	}
+
+	if cfg.Index == "" {
+		cfg.Index = "processed_logs"
+	}
+
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+
+	return &ElasticStorage{
+		cfg:    cfg,
+		client: &http.Client{},
+	}, nil
+}
+
+// elasticIndexMapping maps metadata strings as keywords, so they can be filtered using exact and wildcard matches.
+var elasticIndexMapping = map[string]any{
+	"mappings": map[string]any{
+		"dynamic_templates": []any{
+			map[string]any{
+				"metadata_strings": map[string]any{
+					"path_match":         "metadata.*",
+					"match_mapping_type": "string",
+					"mapping":            map[string]any{"type": "keyword"},
+				},
+			},
+		},
+		"properties": map[string]any{
+			"id":        map[string]any{"type": "keyword"},
+			"source":    map[string]any{"type": "keyword"},
+			"timestamp": map[string]any{"type": "date"},
+			"level":     map[string]any{"type": "byte"},
+			"message": map[string]any{
+				"type":   "text",
+				"fields": map[string]any{"keyword": map[string]any{"type": "keyword", "ignore_above": 32766}},
+			},
+			"metadata": map[string]any{"type": "object"},
+		},
+	},
+}
+
+func (s *ElasticStorage) Connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if _, err := s.do(ctx, http.MethodGet, "/", nil, ""); err != nil {
+		return fmt.Errorf("failed to ping the cluster: %w", err)
+	}
+
+	status, err := s.status(ctx, http.MethodHead, "/"+s.cfg.Index)
+	if err != nil {
+		return fmt.Errorf("failed to check index: %w", err)
+	}
+
+	if status == http.StatusNotFound {
+		body, err := json.Marshal(elasticIndexMapping)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.do(ctx, http.MethodPut, "/"+s.cfg.Index, body, "application/json"); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ElasticStorage) Close(ctx context.Context) error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *ElasticStorage) StoreProcessedLogs(ctx context.Context, logs ...entity.LogRecord) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+
+	body, err := elasticBulkBody(s.cfg.Index, logs)
+	if err != nil {
+		return fmt.Errorf("couldn't build bulk body: %w", err)
+	}
+
+	resBody, err := s.do(ctx, http.MethodPost, "/_bulk", body, "application/x-ndjson")
+	if err != nil {
+		return fmt.Errorf("couldn't send bulk request: %w", err)
+	}
+
+	var res struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error *struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return fmt.Errorf("couldn't parse bulk response: %w", err)
+	}
+
+	if !res.Errors {
+		return nil
+	}
+
+	failed := 0
+	var reason string
+	for _, item := range res.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				failed++
+				if reason == "" {
+					reason = result.Error.Reason
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("couldn't index %d of %d logs: %s", failed, len(logs), reason)
+}
+
+// elasticBulkBody builds the NDJSON body of a _bulk request indexing the given logs.
+func elasticBulkBody(index string, logs []entity.LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for _, log := range logs {
+		action := map[string]any{"index": map[string]any{"_index": index, "_id": log.ID.String()}}
+		if err := enc.Encode(action); err != nil {
+			return nil, err
+		}
+
+		if err := enc.Encode(log); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *ElasticStorage) Query(ctx context.Context, req querier.QueryRequest) (querier.QueryResponse, error) {
+	// Records are neither fetched nor scanned if only their count is requested.
+	if req.CountOnly {
+		count, err := s.Count(ctx, req)
+		if err != nil {
+			return querier.QueryResponse{}, err
+		}
+		return querier.QueryResponse{Count: count}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	body, err := elasticSearchBody(req.Query)
+	if err != nil {
+		return querier.QueryResponse{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	resBody, err := s.post(ctx, "/"+s.cfg.Index+"/_search", body)
+	if err != nil {
+		return querier.QueryResponse{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var res struct {
+		Hits struct {
+			Hits []struct {
+				Source entity.LogRecord `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return querier.QueryResponse{}, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	records := make([]entity.LogRecord, len(res.Hits.Hits))
+	for i, hit := range res.Hits.Hits {
+		records[i] = hit.Source
+	}
+
+	return querier.QueryResponse{
+		Records: records,
+		Cursor:  "", // TODO: Implement cursor-based pagination
+	}, nil
+}
+
+func (s *ElasticStorage) Count(ctx context.Context, req querier.QueryRequest) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	query, err := elasticQuery(req.Query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	resBody, err := s.post(ctx, "/"+s.cfg.Index+"/_count", map[string]any{"query": query})
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var res struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return 0, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	return res.Count, nil
+}
+
+func (s *ElasticStorage) Get(ctx context.Context, id uuid.UUID) (entity.LogRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, querier.DefaultQueryTimeout)
+	defer cancel()
+
+	// Documents are indexed with the id of their log as their _id.
+	body := map[string]any{
+		"query": map[string]any{"ids": map[string]any{"values": []string{id.String()}}},
+		"size":  1,
+	}
+
+	resBody, err := s.post(ctx, "/"+s.cfg.Index+"/_search", body)
+	if err != nil {
+		return entity.LogRecord{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var res struct {
+		Hits struct {
+			Hits []struct {
+				Source entity.LogRecord `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return entity.LogRecord{}, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	if len(res.Hits.Hits) == 0 {
+		return entity.LogRecord{}, querier.LogNotFoundError()
+	}
+
+	return res.Hits.Hits[0].Source, nil
+}
+
+func (s *ElasticStorage) GroupByCount(ctx context.Context, req querier.QueryRequest, field string) ([]querier.GroupCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	if !slices.Contains(defaultAllowedSortFields, field) {
+		return nil, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for grouping.", field)},
+		})
+	}
+
+	query, err := elasticQuery(req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	body := map[string]any{
+		"size":  0,
+		"query": query,
+		"aggs": map[string]any{
+			"groups": map[string]any{
+				"terms": map[string]any{"field": field, "size": 1000, "order": map[string]any{"_count": "desc"}},
+			},
+		},
+	}
+
+	resBody, err := s.post(ctx, "/"+s.cfg.Index+"/_search", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var res struct {
+		Aggregations struct {
+			Groups struct {
+				Buckets []struct {
+					Key      any   `json:"key"`
+					DocCount int64 `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"groups"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	groups := make([]querier.GroupCount, len(res.Aggregations.Groups.Buckets))
+	for i, b := range res.Aggregations.Groups.Buckets {
+		value := fmt.Sprint(b.Key)
+		// Levels are indexed by their numeric value, but reported by name like other storages do.
+		if n, ok := b.Key.(float64); ok && field == "level" {
+			value = entity.LogLevel(n).String()
+		}
+		groups[i] = querier.GroupCount{Value: value, Count: b.DocCount}
+	}
+
+	return groups, nil
+}
+
+func (s *ElasticStorage) Distinct(ctx context.Context, req querier.QueryRequest, field string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	metadata := isSortableMetadataPath(field)
+	if !slices.Contains(defaultAllowedSortFields, field) && !metadata {
+		return nil, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for listing distinct values.", field)},
+		})
+	}
+
+	if metadata {
+		field = "metadata." + querier.MetadataKey(field)
+	}
+
+	query, err := elasticQuery(req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	body := map[string]any{
+		"size":  0,
+		"query": query,
+		"aggs": map[string]any{
+			"values": map[string]any{
+				"terms": map[string]any{"field": field, "size": req.Query.Limit, "order": map[string]any{"_key": "asc"}},
+			},
+		},
+	}
+
+	resBody, err := s.post(ctx, "/"+s.cfg.Index+"/_search", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var res struct {
+		Aggregations struct {
+			Values struct {
+				Buckets []struct {
+					Key any `json:"key"`
+				} `json:"buckets"`
+			} `json:"values"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	values := make([]string, len(res.Aggregations.Values.Buckets))
+	for i, b := range res.Aggregations.Values.Buckets {
+		values[i] = distinctValue(b.Key)
+		// Levels are indexed by their numeric value, but reported by name like other storages do.
+		if n, ok := b.Key.(float64); ok && field == "level" {
+			values[i] = entity.LogLevel(n).String()
+		}
+	}
+
+	return values, nil
+}
+
+// elasticSearchBody builds the body of a _search request for the given query.
+func (s *ElasticStorage) Aggregate(ctx context.Context, req querier.QueryRequest, fn, field string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	if err := querier.ValidateAggregate(fn, field); err != nil {
+		return 0, err
+	}
+
+	if !isSortableMetadataPath(field) {
+		return 0, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for aggregation.", field)},
+		})
+	}
+
+	query, err := elasticQuery(req.Query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	// Aggregate function names match the names of Elasticsearch metric aggregations.
+	body := map[string]any{
+		"size":  0,
+		"query": query,
+		"aggs": map[string]any{
+			"value": map[string]any{fn: map[string]any{"field": field}},
+		},
+	}
+
+	resBody, err := s.post(ctx, "/"+s.cfg.Index+"/_search", body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var res struct {
+		Aggregations struct {
+			Value struct {
+				Value *float64 `json:"value"`
+			} `json:"value"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return 0, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	if res.Aggregations.Value.Value == nil {
+		return 0, nil
+	}
+
+	return *res.Aggregations.Value.Value, nil
+}
+
+func elasticSearchBody(q querier.Query) (map[string]any, error) {
+	query, err := elasticQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sort, err := elasticSort(q)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]any{
+		"query": query,
+		"sort":  sort,
+		"size":  q.Limit,
+	}
+
+	if len(q.Fields) > 0 {
+		var includes []string
+		for _, f := range q.Fields {
+			if querier.IsMetadataPath(f) {
+				f = "metadata." + querier.MetadataKey(f)
+			} else if !slices.Contains([]string{"id", "source", "timestamp", "level", "message", "metadata"}, f) {
+				return nil, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+					"fields": []string{fmt.Sprintf("Field `%s` is unknown.", f)},
+				})
+			}
+			includes = append(includes, f)
+		}
+		body["_source"] = map[string]any{"includes": includes}
+	}
+
+	return body, nil
+}
+
+// elasticQuery translates the query into an Elasticsearch bool query, including the timestamp bounds.
+func elasticQuery(q querier.Query) (map[string]any, error) {
+	start, end, cursor, err := q.GetCursorWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	lowerExclusive, upperExclusive := q.GetBoundsExclusivity()
+
+	timeRange := map[string]any{}
+	if !start.IsZero() {
+		timeRange[elasticBoundOperator("gt", lowerExclusive)] = start.Format(time.RFC3339Nano)
+	}
+	if !end.IsZero() {
+		timeRange[elasticBoundOperator("lt", upperExclusive)] = end.Format(time.RFC3339Nano)
+	}
+
+	must := []any{}
+	if len(timeRange) > 0 {
+		must = append(must, map[string]any{"range": map[string]any{"timestamp": timeRange}})
+	}
+
+	// Skip records up to the cursor, including the record it points at.
+	if cursor != nil {
+		op := "gt"
+		if q.GetQueryDirection() == querier.QueryDirectionBackward {
+			op = "lt"
+		}
+
+		ts := cursor.Timestamp.Format(time.RFC3339Nano)
+		must = append(must, map[string]any{"bool": map[string]any{
+			"should": []any{
+				map[string]any{"range": map[string]any{"timestamp": map[string]any{op: ts}}},
+				map[string]any{"bool": map[string]any{"must": []any{
+					map[string]any{"term": map[string]any{"timestamp": ts}},
+					map[string]any{"range": map[string]any{"id": map[string]any{op: cursor.ID.String()}}},
+				}}},
+			},
+			"minimum_should_match": 1,
+		}})
+	}
+
+	node, err := elasticQueryNode(q.Node)
+	if err != nil {
+		return nil, err
+	}
+	if node != nil {
+		must = append(must, node)
+	}
+
+	return map[string]any{"bool": map[string]any{"must": must}}, nil
+}
+
+// elasticBoundOperator returns the range operator of a time bound, op being either "gt" or "lt".
+func elasticBoundOperator(op string, exclusive bool) string {
+	if exclusive {
+		return op
+	}
+	return op + "e"
+}
+
+// elasticQueryNode recursively translates the query tree. It returns nil for empty nodes.
+func elasticQueryNode(node querier.QueryNode) (map[string]any, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	switch n := node.(type) {
+	case querier.AndNode:
+		children, err := elasticQueryNodes(n.Children)
+		if err != nil || len(children) == 0 {
+			return nil, err
+		}
+		return map[string]any{"bool": map[string]any{"must": children}}, nil
+
+	case querier.OrNode:
+		children, err := elasticQueryNodes(n.Children)
+		if err != nil || len(children) == 0 {
+			return nil, err
+		}
+		return map[string]any{"bool": map[string]any{"should": children, "minimum_should_match": 1}}, nil
+
+	case querier.NotNode:
+		child, err := elasticQueryNode(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		// The negation of an empty node matches nothing (see querier.IsEmptyNode).
+		if child == nil {
+			return map[string]any{"match_none": map[string]any{}}, nil
+		}
+		return map[string]any{"bool": map[string]any{"must_not": []any{child}}}, nil
+
+	case querier.ComparisonNode:
+		return elasticComparison(n)
+
+	default:
+		return nil, fmt.Errorf("unknown query node type: %T", node)
+	}
+}
+
+func elasticQueryNodes(nodes []querier.QueryNode) ([]any, error) {
+	var res []any
+	for _, child := range nodes {
+		q, err := elasticQueryNode(child)
+		if err != nil {
+			return nil, err
+		}
+		if q != nil {
+			res = append(res, q)
+		}
+	}
+	return res, nil
+}
+
+// elasticComparison translates a single comparison into a term, range, wildcard or terms query.
+func elasticComparison(n querier.ComparisonNode) (map[string]any, error) {
+	if n.FieldName == "" {
+		return nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			"field_name": []string{"Field name is required."},
+		})
+	}
+
+	if n.Value == nil {
+		return nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Value is required."},
+		})
+	}
+
+	if !defaultAllowedFilterFieldsRegex.MatchString(n.FieldName) {
+		return nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Field is not allowed for filtering."},
+		})
+	}
+
+	// Levels are indexed by their numeric value.
+	value, ok := n.LevelValue()
+	if !ok {
+		return nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Unknown log level."},
+		})
+	}
+	n.Value = value
+
+	field := n.FieldName
+	if querier.IsMetadataPath(field) {
+		field = "metadata." + querier.MetadataKey(field)
+	}
+
+	// Exact and pattern matches on message use its keyword sub-field.
+	exactField := field
+	if field == "message" {
+		exactField = "message.keyword"
+	}
+
+	switch n.Operator {
+	case querier.OperatorEq:
+		return map[string]any{"term": map[string]any{exactField: n.Value}}, nil
+	case querier.OperatorNe:
+		return map[string]any{"bool": map[string]any{"must_not": []any{
+			map[string]any{"term": map[string]any{exactField: n.Value}},
+		}}}, nil
+	case querier.OperatorGt:
+		return map[string]any{"range": map[string]any{field: map[string]any{"gt": n.Value}}}, nil
+	case querier.OperatorLt:
+		return map[string]any{"range": map[string]any{field: map[string]any{"lt": n.Value}}}, nil
+	case querier.OperatorGte:
+		return map[string]any{"range": map[string]any{field: map[string]any{"gte": n.Value}}}, nil
+	case querier.OperatorLte:
+		return map[string]any{"range": map[string]any{field: map[string]any{"lte": n.Value}}}, nil
+	case querier.OperatorLike, querier.OperatorILike:
+		return map[string]any{"wildcard": map[string]any{exactField: map[string]any{
+			"value":            likeToWildcard(fmt.Sprint(n.Value)),
+			"case_insensitive": n.Operator == querier.OperatorILike,
+		}}}, nil
+	case querier.OperatorIn:
+		return map[string]any{"terms": map[string]any{exactField: n.Value}}, nil
+	case querier.OperatorNotIn:
+		return map[string]any{"bool": map[string]any{"must_not": []any{
+			map[string]any{"terms": map[string]any{exactField: n.Value}},
+		}}}, nil
+	case querier.OperatorNotLike:
+		return map[string]any{"bool": map[string]any{"must_not": []any{
+			map[string]any{"wildcard": map[string]any{exactField: map[string]any{
+				"value": likeToWildcard(fmt.Sprint(n.Value)),
+			}}},
+		}}}, nil
+	case querier.OperatorMatch:
+		// Lucene regular expressions are always anchored, so the pattern is wrapped to match anywhere in the field.
+		return map[string]any{"regexp": map[string]any{exactField: map[string]any{
+			"value": ".*(" + fmt.Sprint(n.Value) + ").*",
+		}}}, nil
+	default:
+		return nil, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{fmt.Sprintf("Operator %d is not supported.", n.Operator)},
+		})
+	}
+}
+
+// likeToWildcard converts a SQL LIKE pattern into an Elasticsearch wildcard pattern.
+func likeToWildcard(pattern string) string {
+	return strings.NewReplacer("*", `\*`, "?", `\?`, "%", "*", "_", "?").Replace(pattern)
+}
+
+// elasticSort builds the sort clause, following the same rules as querier.SQLQueryBuilder.
+func elasticSort(q querier.Query) ([]any, error) {
+	timeDirection := "asc"
+	if q.GetQueryDirection() == querier.QueryDirectionBackward {
+		timeDirection = "desc"
+	}
+
+	secondaryDirection := timeDirection
+	if len(q.Sort) > 0 {
+		secondaryDirection = "asc"
+	}
+
+	var sort []any
+	hasTimestamp := false
+	for _, f := range q.Sort {
+		direction := "asc"
+		if f.IsDescending {
+			direction = "desc"
+		}
+
+		switch {
+		case slices.Contains(defaultAllowedSortFields, f.Name):
+			sort = append(sort, map[string]any{f.Name: direction})
+		case isSortableMetadataPath(f.Name):
+			// Metadata keys may be missing from the mapping of some indices, which must not fail the search.
+			sort = append(sort, map[string]any{f.Name: map[string]any{"order": direction, "unmapped_type": "double"}})
+		default:
+			return nil, fmt.Errorf("field `%s` is not allowed for sorting", f.Name)
+		}
+
+		hasTimestamp = hasTimestamp || f.Name == "timestamp"
+	}
+
+	if !hasTimestamp {
+		sort = append(sort, map[string]any{"timestamp": secondaryDirection})
+	}
+
+	return append(sort, map[string]any{"id": secondaryDirection}), nil
+}
+
+// Explain returns the search body sent for the request.
+func (s *ElasticStorage) Explain(req querier.QueryRequest) (querier.Explanation, error) {
+	body, err := elasticSearchBody(req.Query)
+	if err != nil {
+		return querier.Explanation{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		return querier.Explanation{}, err
+	}
+
+	sort, err := json.Marshal(body["sort"])
+	if err != nil {
+		return querier.Explanation{}, err
+	}
+
+	e := querier.NewExplanation(string(js), nil)
+	if e.Plan, err = querier.NewPlan(req.Query, string(sort)); err != nil {
+		return querier.Explanation{}, err
+	}
+
+	return e, nil
+}
+
+func (s *ElasticStorage) post(ctx context.Context, path string, body any) ([]byte, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.do(ctx, http.MethodPost, path, b, "application/json")
+}
+
+// do sends a request to the cluster and returns the response body. Non-2xx responses are returned as errors.
+func (s *ElasticStorage) do(ctx context.Context, method, path string, body []byte, contentType string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.Addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d: %s", res.StatusCode, resBody)
+	}
+
+	return resBody, nil
+}
+
+// status sends a bodiless request and returns the response status code.
+func (s *ElasticStorage) status(ctx context.Context, method, path string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.Addr+path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode, nil
+}
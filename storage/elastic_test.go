@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/querier"
+)
+
+// assertJSON fails the test unless got encodes to the same JSON value as want, regardless of key order.
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("cannot marshal: %v", err)
+	}
+
+	var gotValue, wantValue any
+	if err := json.Unmarshal(gotJSON, &gotValue); err != nil {
+		t.Fatalf("cannot unmarshal: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("cannot unmarshal want: %v", err)
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", gotJSON, want)
+	}
+}
+
+func TestElasticBulkBody(t *testing.T) {
+	logs := []entity.LogRecord{
+		{ID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), Source: "api", RawData: []byte("raw"), Level: entity.LogLevelError,
+			Timestamp: testTime, Message: "boom", Metadata: map[string]any{"status": 500}},
+		{ID: uuid.MustParse("00000000-0000-0000-0000-000000000002"), Source: "worker", Level: entity.LogLevelInfo,
+			Timestamp: testTime.Add(time.Millisecond), Message: "done"},
+	}
+
+	body, err := elasticBulkBody("logs", logs)
+	if err != nil {
+		t.Fatalf("cannot build bulk body: %v", err)
+	}
+
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		t.Errorf("got body %q, want it to end with a newline", body)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n"))
+	want := []string{
+		`{"index": {"_index": "logs", "_id": "00000000-0000-0000-0000-000000000001"}}`,
+		`{"id": "00000000-0000-0000-0000-000000000001", "source": "api", "level": 4, "timestamp": "2024-01-02T00:00:00Z",
+			"message": "boom", "metadata": {"status": 500}}`,
+		`{"index": {"_index": "logs", "_id": "00000000-0000-0000-0000-000000000002"}}`,
+		`{"id": "00000000-0000-0000-0000-000000000002", "source": "worker", "level": 2, "timestamp": "2024-01-02T00:00:00.001Z",
+			"message": "done", "metadata": null}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %s", len(lines), len(want), body)
+	}
+
+	for i, line := range lines {
+		assertJSON(t, json.RawMessage(line), want[i])
+	}
+}
+
+func TestElasticBulkBodyEmpty(t *testing.T) {
+	body, err := elasticBulkBody("logs", nil)
+	if err != nil {
+		t.Fatalf("cannot build bulk body: %v", err)
+	}
+	if len(body) != 0 {
+		t.Errorf("got body %q, want it empty", body)
+	}
+}
+
+func TestElasticQuery(t *testing.T) {
+	timeRange := `{"range": {"timestamp": {"gte": "2024-01-02T00:00:00Z", "lt": "2024-01-02T01:00:00Z"}}}`
+
+	tests := []struct {
+		name string
+		node querier.QueryNode
+		want string
+	}{
+		{
+			name: "no node",
+			want: `{"bool": {"must": [` + timeRange + `]}}`,
+		},
+		{
+			name: "nested and/or tree",
+			node: querier.AndNode{Children: []querier.QueryNode{
+				querier.ComparisonNode{FieldName: "level", Operator: querier.OperatorGte, Value: "warn"},
+				querier.OrNode{Children: []querier.QueryNode{
+					querier.ComparisonNode{FieldName: "source", Operator: querier.OperatorEq, Value: "api"},
+					querier.AndNode{Children: []querier.QueryNode{
+						querier.ComparisonNode{FieldName: "metadata.status", Operator: querier.OperatorGt, Value: 499},
+						querier.NotNode{Child: querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorLike, Value: "%health_"}},
+					}},
+				}},
+			}},
+			want: `{"bool": {"must": [` + timeRange + `, {"bool": {"must": [
+				{"range": {"level": {"gte": 3}}},
+				{"bool": {"minimum_should_match": 1, "should": [
+					{"term": {"source": "api"}},
+					{"bool": {"must": [
+						{"range": {"metadata.status": {"gt": 499}}},
+						{"bool": {"must_not": [{"wildcard": {"message.keyword": {"value": "*health?", "case_insensitive": false}}}]}}
+					]}}
+				]}}
+			]}}]}}`,
+		},
+		{
+			name: "empty groups are dropped",
+			node: querier.AndNode{Children: []querier.QueryNode{
+				querier.OrNode{},
+				querier.ComparisonNode{FieldName: "source", Operator: querier.OperatorIn, Value: []string{"api", "worker"}},
+				querier.AndNode{Children: []querier.QueryNode{querier.OrNode{}}},
+			}},
+			want: `{"bool": {"must": [` + timeRange + `, {"bool": {"must": [{"terms": {"source": ["api", "worker"]}}]}}]}}`,
+		},
+		{
+			name: "negation of an empty group matches nothing",
+			node: querier.NotNode{Child: querier.AndNode{}},
+			want: `{"bool": {"must": [` + timeRange + `, {"match_none": {}}]}}`,
+		},
+		{
+			name: "match is wrapped to be unanchored",
+			node: querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorMatch, Value: "time(out|d out)"},
+			want: `{"bool": {"must": [` + timeRange + `, {"regexp": {"message.keyword": {"value": ".*(time(out|d out)).*"}}}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := elasticQuery(querier.Query{Node: tt.node, Start: testTime, End: testTime.Add(time.Hour), Limit: 10})
+			if err != nil {
+				t.Fatalf("cannot translate query: %v", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestElasticQueryRejectsUnknownField(t *testing.T) {
+	node := querier.OrNode{Children: []querier.QueryNode{
+		querier.ComparisonNode{FieldName: "source", Operator: querier.OperatorEq, Value: "api"},
+		querier.ComparisonNode{FieldName: "password", Operator: querier.OperatorEq, Value: "secret"},
+	}}
+
+	if _, err := elasticQuery(querier.Query{Node: node, Start: testTime, Limit: 10}); err == nil {
+		t.Error("got no error, want one for a field not allowed for filtering")
+	}
+}
+
+func TestElasticComparisonNegations(t *testing.T) {
+	tests := []struct {
+		name string
+		node querier.ComparisonNode
+		want string
+	}{
+		{
+			name: "not in",
+			node: querier.ComparisonNode{FieldName: "source", Operator: querier.OperatorNotIn, Value: []string{"api", "worker"}},
+			want: `{"bool": {"must_not": [{"terms": {"source": ["api", "worker"]}}]}}`,
+		},
+		{
+			name: "not like",
+			node: querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorNotLike, Value: "%health_"},
+			want: `{"bool": {"must_not": [{"wildcard": {"message.keyword": {"value": "*health?"}}}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := elasticComparison(tt.node)
+			if err != nil {
+				t.Fatalf("cannot translate comparison: %v", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
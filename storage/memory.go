@@ -0,0 +1,539 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/fault"
+	"github.com/thisisjab/logzilla/querier"
+)
+
+type MemoryStorageConfig struct {
+	// MaxRecords is the maximum number of records kept. When exceeded, the oldest stored records are removed.
+	// Zero means no limit.
+	MaxRecords uint `yaml:"max_records"`
+}
+
+// MemoryStorage keeps records in memory and evaluates queries in-process. It's meant for tests and development.
+type MemoryStorage struct {
+	cfg     MemoryStorageConfig
+	mu      sync.RWMutex
+	records []entity.LogRecord
+}
+
+func NewMemoryStorage(cfg MemoryStorageConfig) *MemoryStorage {
+	return &MemoryStorage{cfg: cfg}
+}
+
+func (s *MemoryStorage) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStorage) Close(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStorage) StoreProcessedLogs(ctx context.Context, logs ...entity.LogRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, logs...)
+
+	if s.cfg.MaxRecords > 0 && len(s.records) > int(s.cfg.MaxRecords) {
+		s.records = slices.Clone(s.records[len(s.records)-int(s.cfg.MaxRecords):])
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Query(ctx context.Context, req querier.QueryRequest) (querier.QueryResponse, error) {
+	if req.CountOnly {
+		count, err := s.Count(ctx, req)
+		if err != nil {
+			return querier.QueryResponse{}, err
+		}
+		return querier.QueryResponse{Count: count}, nil
+	}
+
+	records, err := s.match(req.Query)
+	if err != nil {
+		return querier.QueryResponse{}, err
+	}
+
+	if err := sortMemoryRecords(records, req.Query); err != nil {
+		return querier.QueryResponse{}, err
+	}
+
+	if req.Query.Limit > 0 && len(records) > req.Query.Limit {
+		records = records[:req.Query.Limit]
+	}
+
+	return querier.QueryResponse{
+		Records: records,
+		Cursor:  "", // TODO: Implement cursor-based pagination
+	}, nil
+}
+
+func (s *MemoryStorage) Count(ctx context.Context, req querier.QueryRequest) (int64, error) {
+	records, err := s.match(req.Query)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(records)), nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, id uuid.UUID) (entity.LogRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.records {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+
+	return entity.LogRecord{}, querier.LogNotFoundError()
+}
+
+func (s *MemoryStorage) GroupByCount(ctx context.Context, req querier.QueryRequest, field string) ([]querier.GroupCount, error) {
+	if !slices.Contains(defaultAllowedSortFields, field) {
+		return nil, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for grouping.", field)},
+		})
+	}
+
+	records, err := s.match(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, r := range records {
+		v, _ := memoryFieldValue(r, field)
+		counts[fmt.Sprint(v)]++
+	}
+
+	groups := make([]querier.GroupCount, 0, len(counts))
+	for v, c := range counts {
+		groups = append(groups, querier.GroupCount{Value: v, Count: c})
+	}
+
+	slices.SortFunc(groups, func(a, b querier.GroupCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+	})
+
+	return groups, nil
+}
+
+func (s *MemoryStorage) Distinct(ctx context.Context, req querier.QueryRequest, field string) ([]string, error) {
+	metadata := isSortableMetadataPath(field)
+	if !slices.Contains(defaultAllowedSortFields, field) && !metadata {
+		return nil, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for listing distinct values.", field)},
+		})
+	}
+
+	records, err := s.match(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var values []string
+	for _, r := range records {
+		v, ok := memoryFieldValue(r, field)
+		if !ok || v == nil {
+			continue
+		}
+
+		value := fmt.Sprint(v)
+		if metadata {
+			value = distinctValue(v)
+		}
+
+		if !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+
+	slices.Sort(values)
+
+	return values[:min(len(values), max(req.Query.Limit, 0))], nil
+}
+
+func (s *MemoryStorage) Aggregate(ctx context.Context, req querier.QueryRequest, fn, field string) (float64, error) {
+	if err := querier.ValidateAggregate(fn, field); err != nil {
+		return 0, err
+	}
+
+	if !isSortableMetadataPath(field) {
+		return 0, fault.New(fault.BadInputCode, "").WithMetadata(fault.FieldErrorsMetadata{
+			"field": []string{fmt.Sprintf("Field `%s` is not allowed for aggregation.", field)},
+		})
+	}
+
+	records, err := s.match(req.Query)
+	if err != nil {
+		return 0, err
+	}
+
+	var values []float64
+	for _, r := range records {
+		v, _ := memoryFieldValue(r, field)
+		if f, ok := toFloat(v); ok {
+			values = append(values, f)
+		}
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	switch fn {
+	case querier.AggregateMin:
+		return slices.Min(values), nil
+	case querier.AggregateMax:
+		return slices.Max(values), nil
+	case querier.AggregateAvg:
+		return sum / float64(len(values)), nil
+	default:
+		return sum, nil
+	}
+}
+
+// match returns a copy of the records within the time window of the query which match its node tree.
+// Records up to the cursor of the query, including the record it points at, are skipped.
+func (s *MemoryStorage) match(q querier.Query) ([]entity.LogRecord, error) {
+	start, end, cursor, err := q.GetCursorWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	backward := q.GetQueryDirection() == querier.QueryDirectionBackward
+	lowerExclusive, upperExclusive := q.GetBoundsExclusivity()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []entity.LogRecord
+	for _, r := range s.records {
+		if r.Timestamp.Before(start) || (lowerExclusive && r.Timestamp.Equal(start)) {
+			continue
+		}
+
+		if !end.IsZero() && (r.Timestamp.After(end) || (upperExclusive && r.Timestamp.Equal(end))) {
+			continue
+		}
+
+		if cursor != nil {
+			c := cmp.Or(r.Timestamp.Compare(cursor.Timestamp), cmp.Compare(r.ID.String(), cursor.ID.String()))
+			if (backward && c >= 0) || (!backward && c <= 0) {
+				continue
+			}
+		}
+
+		ok, err := memoryMatches(r, q.Node)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			res = append(res, r)
+		}
+	}
+
+	return res, nil
+}
+
+// memoryMatches recursively evaluates the node against the record.
+func memoryMatches(r entity.LogRecord, node querier.QueryNode) (bool, error) {
+	switch n := node.(type) {
+	case nil:
+		return true, nil
+	case querier.AndNode:
+		for _, c := range n.Children {
+			if querier.IsEmptyNode(c) {
+				continue
+			}
+			ok, err := memoryMatches(r, c)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case querier.OrNode:
+		// Empty children are ignored like SQL drivers do, so a group of only empty children matches everything.
+		empty := true
+		for _, c := range n.Children {
+			if querier.IsEmptyNode(c) {
+				continue
+			}
+			empty = false
+			ok, err := memoryMatches(r, c)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return empty, nil
+	case querier.NotNode:
+		// The negation of an empty node matches nothing, like SQL drivers render it (see querier.IsEmptyNode).
+		if querier.IsEmptyNode(n.Child) {
+			return false, nil
+		}
+		ok, err := memoryMatches(r, n.Child)
+		return !ok, err
+	case querier.ComparisonNode:
+		return memoryCompare(r, n)
+	default:
+		return false, fmt.Errorf("unknown node type: %T", node)
+	}
+}
+
+func memoryCompare(r entity.LogRecord, n querier.ComparisonNode) (bool, error) {
+	if n.FieldName == "" {
+		return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			"field_name": []string{"Field name is required."},
+		})
+	}
+
+	if n.Value == nil {
+		return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Value is required."},
+		})
+	}
+
+	if !defaultAllowedFilterFieldsRegex.MatchString(n.FieldName) {
+		return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Field is not allowed for filtering."},
+		})
+	}
+
+	value, ok := n.LevelValue()
+	if !ok {
+		return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{"Unknown log level."},
+		})
+	}
+	n.Value = value
+
+	actual, ok := memoryFieldValue(r, n.FieldName)
+
+	switch n.Operator {
+	case querier.OperatorEq:
+		return ok && compareMemoryValues(actual, n.Value) == 0, nil
+	case querier.OperatorNe:
+		return ok && compareMemoryValues(actual, n.Value) != 0, nil
+	case querier.OperatorGt:
+		return ok && compareMemoryValues(actual, n.Value) > 0, nil
+	case querier.OperatorLt:
+		return ok && compareMemoryValues(actual, n.Value) < 0, nil
+	case querier.OperatorGte:
+		return ok && compareMemoryValues(actual, n.Value) >= 0, nil
+	case querier.OperatorLte:
+		return ok && compareMemoryValues(actual, n.Value) <= 0, nil
+	case querier.OperatorLike, querier.OperatorILike, querier.OperatorNotLike:
+		pattern := likeToRegexp(fmt.Sprint(n.Value), n.Operator == querier.OperatorILike)
+		matched := ok && pattern.MatchString(fmt.Sprint(actual))
+		return matched != (n.Operator == querier.OperatorNotLike), nil
+	case querier.OperatorMatch:
+		pattern, isString := n.Value.(string)
+		re, err := regexp.Compile(pattern)
+		if !isString || err != nil {
+			return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+				n.FieldName: []string{"Value is not a valid regular expression."},
+			})
+		}
+		return ok && re.MatchString(fmt.Sprint(actual)), nil
+	case querier.OperatorIn, querier.OperatorNotIn:
+		in := false
+		rv := reflect.ValueOf(n.Value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+				n.FieldName: []string{"Value must be a list."},
+			})
+		}
+		for i := range rv.Len() {
+			if ok && compareMemoryValues(actual, rv.Index(i).Interface()) == 0 {
+				in = true
+				break
+			}
+		}
+		return in != (n.Operator == querier.OperatorNotIn), nil
+	default:
+		return false, fault.New(fault.BadInputCode, "Invalid comparison.").WithMetadata(fault.FieldErrorsMetadata{
+			n.FieldName: []string{fmt.Sprintf("Operator %d is not supported.", n.Operator)},
+		})
+	}
+}
+
+// memoryFieldValue returns the value of a top-level field or metadata path of the record.
+// The second return value is false if the record has no such metadata key.
+func memoryFieldValue(r entity.LogRecord, field string) (any, bool) {
+	switch field {
+	case "id":
+		return r.ID.String(), true
+	case "source":
+		return r.Source, true
+	case "timestamp":
+		return r.Timestamp, true
+	case "level":
+		return r.Level, true
+	case "message":
+		return r.Message, true
+	case "metadata":
+		return r.Metadata, true
+	}
+
+	if !querier.IsMetadataPath(field) {
+		return nil, false
+	}
+
+	v, ok := r.Metadata[querier.MetadataKey(field)]
+	return v, ok
+}
+
+// compareMemoryValues compares a record value with a query value, converting the query value to the type of the
+// record value where possible. Values which can't be converted are compared by their string representation.
+func compareMemoryValues(actual, expected any) int {
+	switch a := actual.(type) {
+	case time.Time:
+		switch e := expected.(type) {
+		case time.Time:
+			return a.Compare(e)
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, e); err == nil {
+				return a.Compare(t)
+			}
+		}
+
+	case entity.LogLevel:
+		switch e := expected.(type) {
+		case entity.LogLevel:
+			return cmp.Compare(a, e)
+		case string:
+			if l, ok := entity.ParseLogLevel(e); ok {
+				return cmp.Compare(a, l)
+			}
+		}
+		if f, ok := toFloat(expected); ok {
+			return cmp.Compare(float64(a), f)
+		}
+
+	case bool:
+		if e, ok := expected.(bool); ok {
+			switch {
+			case a == e:
+				return 0
+			case !a:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+
+	if a, ok := toFloat(actual); ok {
+		if e, ok := toFloat(expected); ok {
+			return cmp.Compare(a, e)
+		}
+	}
+
+	return cmp.Compare(fmt.Sprint(actual), fmt.Sprint(expected))
+}
+
+// toFloat converts numbers, and strings holding numbers, to float64.
+func toFloat(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(rv.String(), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// likeToRegexp converts a SQL LIKE pattern into a regular expression matching the whole value.
+func likeToRegexp(pattern string, ignoreCase bool) *regexp.Regexp {
+	var b strings.Builder
+	if ignoreCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.MustCompile(b.String())
+}
+
+// isSortableMetadataPath reports whether field is a metadata path allowed for filtering, and so for sorting.
+func isSortableMetadataPath(field string) bool {
+	return querier.IsMetadataPath(field) && defaultAllowedFilterFieldsRegex.MatchString(field)
+}
+
+// sortMemoryRecords sorts records following the same rules as querier.SQLQueryBuilder.
+func sortMemoryRecords(records []entity.LogRecord, q querier.Query) error {
+	for _, f := range q.Sort {
+		if !slices.Contains(defaultAllowedSortFields, f.Name) && !isSortableMetadataPath(f.Name) {
+			return fmt.Errorf("field `%s` is not allowed for sorting", f.Name)
+		}
+	}
+
+	backward := q.GetQueryDirection() == querier.QueryDirectionBackward
+	secondaryDescending := backward && len(q.Sort) == 0
+
+	sortFields := append(slices.Clone(q.Sort),
+		querier.SortField{Name: "timestamp", IsDescending: secondaryDescending},
+		querier.SortField{Name: "id", IsDescending: secondaryDescending},
+	)
+
+	slices.SortStableFunc(records, func(a, b entity.LogRecord) int {
+		for _, f := range sortFields {
+			av, _ := memoryFieldValue(a, f.Name)
+			bv, _ := memoryFieldValue(b, f.Name)
+
+			c := compareMemoryValues(av, bv)
+			if f.IsDescending {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	return nil
+}
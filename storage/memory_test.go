@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/fault"
+	"github.com/thisisjab/logzilla/querier"
+)
+
+var testTime = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// ids returns the ids of records.
+func ids(records []entity.LogRecord) []uuid.UUID {
+	res := make([]uuid.UUID, len(records))
+	for i, r := range records {
+		res[i] = r.ID
+	}
+	return res
+}
+
+func TestMemoryStorageStableOrderOfIdenticalTimestamps(t *testing.T) {
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	ctx := context.Background()
+
+	var records []entity.LogRecord
+	for range 20 {
+		records = append(records, entity.LogRecord{ID: uuid.New(), Source: "api", Timestamp: testTime})
+	}
+	if err := s.StoreProcessedLogs(ctx, records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	want := ids(records)
+	slices.SortFunc(want, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+
+	query := func(q querier.Query) []uuid.UUID {
+		t.Helper()
+
+		resp, err := s.Query(ctx, querier.QueryRequest{Query: q})
+		if err != nil {
+			t.Fatalf("cannot query: %v", err)
+		}
+		return ids(resp.Records)
+	}
+
+	forward := querier.Query{Start: testTime, End: testTime.Add(time.Second), Limit: 100}
+	for range 3 {
+		if got := query(forward); !slices.Equal(got, want) {
+			t.Fatalf("got records in order %v, want them sorted by id %v", got, want)
+		}
+	}
+
+	backward := querier.Query{Start: testTime.Add(time.Second), End: testTime.Add(-time.Second), Limit: 100}
+	reversed := slices.Clone(want)
+	slices.Reverse(reversed)
+	if got := query(backward); !slices.Equal(got, reversed) {
+		t.Fatalf("got records in order %v of a backward query, want them sorted by id descending %v", got, reversed)
+	}
+
+	// Pages resumed with a cursor neither skip nor repeat records sharing the timestamp.
+	var paged []uuid.UUID
+	page := forward
+	page.Limit = 3
+	for {
+		resp, err := s.Query(ctx, querier.QueryRequest{Query: page})
+		if err != nil {
+			t.Fatalf("cannot query: %v", err)
+		}
+		if len(resp.Records) == 0 {
+			break
+		}
+
+		paged = append(paged, ids(resp.Records)...)
+		page.Cursor = querier.NewCursor(resp.Records[len(resp.Records)-1]).Encode()
+	}
+
+	if !slices.Equal(paged, want) {
+		t.Fatalf("got paged records %v, want %v", paged, want)
+	}
+}
+
+func TestMemoryStorageBackwardPagination(t *testing.T) {
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	ctx := context.Background()
+
+	var records []entity.LogRecord
+	for i := range 10 {
+		// Pairs of records share their timestamp.
+		records = append(records, entity.LogRecord{ID: uuid.New(), Source: "api", Timestamp: testTime.Add(time.Duration(i/2) * time.Second)})
+	}
+	if err := s.StoreProcessedLogs(ctx, records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	want := slices.Clone(records)
+	slices.SortFunc(want, func(a, b entity.LogRecord) int {
+		return cmp.Or(b.Timestamp.Compare(a.Timestamp), strings.Compare(b.ID.String(), a.ID.String()))
+	})
+
+	var paged []uuid.UUID
+	page := querier.Query{Start: testTime.Add(time.Minute), End: testTime.Add(-time.Second), Limit: 3}
+	for {
+		resp, err := s.Query(ctx, querier.QueryRequest{Query: page})
+		if err != nil {
+			t.Fatalf("cannot query: %v", err)
+		}
+		if len(resp.Records) == 0 {
+			break
+		}
+
+		paged = append(paged, ids(resp.Records)...)
+		page.Cursor = querier.NewCursor(resp.Records[len(resp.Records)-1]).Encode()
+	}
+
+	if !slices.Equal(paged, ids(want)) {
+		t.Fatalf("got paged records %v, want %v", paged, ids(want))
+	}
+
+	// Explicitly sorted records can't be paged, since cursors are keyed by time.
+	page.Sort = []querier.SortField{{Name: "source", IsDescending: true}}
+	_, err := s.Query(ctx, querier.QueryRequest{Query: page})
+
+	var f fault.Fault
+	if !errors.As(err, &f) || f.Code() != fault.BadInputCode {
+		t.Errorf("got error %v, want a bad input fault for a cursor of a sorted query", err)
+	}
+}
+
+func TestMemoryStorageMatchIsNotLike(t *testing.T) {
+	records := []entity.LogRecord{
+		{ID: uuid.New(), Timestamp: testTime, Message: "request timed out"},
+		{ID: uuid.New(), Timestamp: testTime, Message: "request timeout"},
+		{ID: uuid.New(), Timestamp: testTime, Message: "time(out)"},
+	}
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	if err := s.StoreProcessedLogs(context.Background(), records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		node querier.QueryNode
+		want []entity.LogRecord
+	}{
+		{
+			name: "match uses regular expressions",
+			node: querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorMatch, Value: "time(out|d out)"},
+			want: records[:2],
+		},
+		{
+			name: "like uses wildcards",
+			node: querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorLike, Value: "time(out%"},
+			want: records[2:],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{Node: tt.node, Start: testTime, Limit: 10}})
+			if err != nil {
+				t.Fatalf("cannot query: %v", err)
+			}
+
+			got, want := ids(resp.Records), ids(tt.want)
+			slices.SortFunc(got, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+			slices.SortFunc(want, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+			if !slices.Equal(got, want) {
+				t.Errorf("got records %v, want %v", got, want)
+			}
+		})
+	}
+
+	node := querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorMatch, Value: "time(out"}
+	_, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{Node: node, Start: testTime, Limit: 10}})
+	var f fault.Fault
+	if !errors.As(err, &f) || f.Code() != fault.BadInputCode {
+		t.Errorf("got error %v, want a bad input fault for an invalid regular expression", err)
+	}
+}
+
+func TestMemoryStorageSortByMetadata(t *testing.T) {
+	records := []entity.LogRecord{
+		{ID: uuid.New(), Timestamp: testTime, Metadata: map[string]any{"duration": 900}},
+		{ID: uuid.New(), Timestamp: testTime, Metadata: map[string]any{"duration": 25.5}},
+		{ID: uuid.New(), Timestamp: testTime, Metadata: map[string]any{"duration": 100}},
+	}
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	if err := s.StoreProcessedLogs(context.Background(), records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		descending bool
+		want       []entity.LogRecord
+	}{
+		{name: "ascending", want: []entity.LogRecord{records[1], records[2], records[0]}},
+		{name: "descending", descending: true, want: []entity.LogRecord{records[0], records[2], records[1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{
+				Start: testTime,
+				Sort:  []querier.SortField{{Name: "metadata.duration", IsDescending: tt.descending}},
+				Limit: 10,
+			}})
+			if err != nil {
+				t.Fatalf("cannot query: %v", err)
+			}
+
+			if got, want := ids(resp.Records), ids(tt.want); !slices.Equal(got, want) {
+				t.Errorf("got records %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMemoryStorageComparesLevelNamesByOrder(t *testing.T) {
+	var records []entity.LogRecord
+	for _, level := range []entity.LogLevel{entity.LogLevelDebug, entity.LogLevelInfo, entity.LogLevelWarn, entity.LogLevelError, entity.LogLevelFatal} {
+		records = append(records, entity.LogRecord{ID: uuid.New(), Level: level, Timestamp: testTime.Add(time.Duration(level) * time.Second)})
+	}
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	if err := s.StoreProcessedLogs(context.Background(), records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	for _, value := range []any{"warn", "WARN", int(entity.LogLevelWarn)} {
+		t.Run(fmt.Sprint(value), func(t *testing.T) {
+			node := querier.ComparisonNode{FieldName: "level", Operator: querier.OperatorGte, Value: value}
+			resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{Node: node, Start: testTime, Limit: 10}})
+			if err != nil {
+				t.Fatalf("cannot query: %v", err)
+			}
+
+			if got, want := ids(resp.Records), ids(records[2:]); !slices.Equal(got, want) {
+				t.Errorf("got records %v, want the warn, error and fatal ones %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMemoryStorageFiltersById(t *testing.T) {
+	records := []entity.LogRecord{
+		{ID: uuid.New(), Timestamp: testTime, Message: "first"},
+		{ID: uuid.New(), Timestamp: testTime.Add(time.Second), Message: "second"},
+	}
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	if err := s.StoreProcessedLogs(context.Background(), records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+
+	node := querier.ComparisonNode{FieldName: "id", Operator: querier.OperatorEq, Value: records[1].ID.String()}
+	resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{Node: node, Start: testTime, Limit: 10}})
+	if err != nil {
+		t.Fatalf("cannot query: %v", err)
+	}
+	if got, want := ids(resp.Records), ids(records[1:]); !slices.Equal(got, want) {
+		t.Errorf("got records %v, want %v", got, want)
+	}
+
+	record, err := s.Get(context.Background(), records[0].ID)
+	if err != nil || record.ID != records[0].ID {
+		t.Errorf("got record %v and error %v, want %v", record.ID, err, records[0].ID)
+	}
+
+	_, err = s.Get(context.Background(), uuid.New())
+	var f fault.Fault
+	if !errors.As(err, &f) || f.Code() != fault.NotFoundCode {
+		t.Errorf("got error %v, want a not found fault", err)
+	}
+}
+
+func TestMemoryStorageQueryCountOnly(t *testing.T) {
+	s := NewMemoryStorage(MemoryStorageConfig{})
+	for i := range 5 {
+		if err := s.StoreProcessedLogs(context.Background(), entity.LogRecord{ID: uuid.New(), Source: "api", Timestamp: testTime.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatalf("cannot store logs: %v", err)
+		}
+	}
+
+	resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{Start: testTime, Limit: 2}, CountOnly: true})
+	if err != nil {
+		t.Fatalf("cannot query: %v", err)
+	}
+
+	if resp.Count != 5 || len(resp.Records) != 0 {
+		t.Errorf("got count %d and %d records, want only a count of 5", resp.Count, len(resp.Records))
+	}
+}
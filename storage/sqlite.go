@@ -0,0 +1,511 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/querier"
+	"modernc.org/sqlite"
+)
+
+// sqliteMatchFunction is the SQL function registered for regular expression matching, since SQLite has none built in.
+const sqliteMatchFunction = "logzilla_match"
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(sqliteMatchFunction, 2, sqliteMatch)
+}
+
+// sqliteMatch returns 1 if the first argument matches the regular expression in the second one, and 0 otherwise.
+// NULL values never match.
+func sqliteMatch(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return int64(0), nil
+	}
+
+	re, err := sqliteRegexps.get(fmt.Sprint(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	value := args[0]
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	if re.MatchString(fmt.Sprint(value)) {
+		return int64(1), nil
+	}
+
+	return int64(0), nil
+}
+
+// sqliteRegexps caches compiled patterns, since the match function is called for every row.
+var sqliteRegexps = &regexpCache{entries: make(map[string]*regexp.Regexp)}
+
+// regexpCacheSize is the number of patterns kept before the cache is cleared.
+const regexpCacheSize = 128
+
+type regexpCache struct {
+	mu      sync.Mutex
+	entries map[string]*regexp.Regexp
+}
+
+func (c *regexpCache) get(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if re, ok := c.entries[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.entries) >= regexpCacheSize {
+		clear(c.entries)
+	}
+	c.entries[pattern] = re
+
+	return re, nil
+}
+
+type SQLiteStorageConfig struct {
+	// Path is the database file path. It's created if it doesn't exist.
+	Path string `yaml:"path"`
+}
+
+// SQLiteStorage is an embedded storage for demos and small single-node deployments.
+// Timestamps are stored as unix nanoseconds, levels by their numeric value and metadata as JSON text.
+type SQLiteStorage struct {
+	db     *sql.DB
+	cfg    SQLiteStorageConfig
+	query  *querier.SQLQueryBuilder
+	logger *slog.Logger
+}
+
+func NewSQLiteStorage(logger *slog.Logger, cfg SQLiteStorageConfig) (*SQLiteStorage, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+
+	queryBuilder := querier.NewSQLQueryBuilder(querier.SQLOptions{
+		TableName:                "processed_logs",
+		SelectColumns:            []string{"id", "source", "timestamp", "level", "message", "metadata"},
+		AllowedSortFields:        defaultAllowedSortFields,
+		AllowedFilterFieldsRegex: defaultAllowedFilterFieldsRegex,
+		FieldExpression:          sqliteFieldExpression,
+		MetadataPathColumn:       sqliteMetadataPathColumn,
+		MatchFunction:            sqliteMatchFunction,
+		TieBreakerField:          "id",
+	})
+
+	return &SQLiteStorage{
+		cfg:    cfg,
+		query:  queryBuilder,
+		logger: logger,
+	}, nil
+}
+
+// sqliteFieldExpression extracts metadata paths from the JSON text column. Extracted values are cast when compared
+// with numbers, since numbers stored as JSON strings would otherwise never be equal to (or less than) a number.
+func sqliteFieldExpression(field string, kind querier.ValueKind) string {
+	if !querier.IsMetadataPath(field) {
+		return field
+	}
+
+	key := strings.ReplaceAll(querier.MetadataKey(field), "'", "''")
+	expr := fmt.Sprintf(`json_extract(metadata, '$."%s"')`, key)
+
+	switch kind {
+	case querier.ValueKindInt:
+		return fmt.Sprintf("CAST(%s AS INTEGER)", expr)
+	case querier.ValueKindFloat:
+		return fmt.Sprintf("CAST(%s AS REAL)", expr)
+	default:
+		return expr
+	}
+}
+
+// sqliteMetadataPathColumn selects metadata paths as JSON text using the `->` operator, which returns NULL for absent keys.
+func sqliteMetadataPathColumn(field string) string {
+	key := strings.ReplaceAll(querier.MetadataKey(field), "'", "''")
+	alias := `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+	return fmt.Sprintf(`metadata -> '$."%s"' AS %s`, key, alias)
+}
+
+func (s *SQLiteStorage) Connect(ctx context.Context) error {
+	db, err := sql.Open("sqlite", s.cfg.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping the database: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS processed_logs (
+			id TEXT PRIMARY KEY,
+			source TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			level INTEGER NOT NULL,
+			message TEXT NOT NULL,
+			metadata TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS processed_logs_source_timestamp ON processed_logs (source, timestamp);
+		CREATE INDEX IF NOT EXISTS processed_logs_timestamp ON processed_logs (timestamp);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	s.db = db
+
+	return nil
+}
+
+func (s *SQLiteStorage) Close(ctx context.Context) error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStorage) StoreProcessedLogs(ctx context.Context, logs ...entity.LogRecord) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO processed_logs (id, source, timestamp, level, message, metadata) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("couldn't prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, log := range logs {
+		metadata, err := json.Marshal(log.Metadata)
+		if err != nil {
+			return fmt.Errorf("couldn't marshal metadata of log %s: %w", log.ID, err)
+		}
+
+		if _, err := stmt.ExecContext(ctx, log.ID.String(), log.Source, log.Timestamp.UnixNano(), int(log.Level), log.Message, string(metadata)); err != nil {
+			return fmt.Errorf("couldn't insert log %s: %w", log.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) Query(ctx context.Context, req querier.QueryRequest) (querier.QueryResponse, error) {
+	// Records are neither fetched nor scanned if only their count is requested.
+	if req.CountOnly {
+		count, err := s.Count(ctx, req)
+		if err != nil {
+			return querier.QueryResponse{}, err
+		}
+		return querier.QueryResponse{Count: count}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	result, err := s.query.Build(req.Query)
+	if err != nil {
+		return querier.QueryResponse{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, result.Query, sqliteArgs(result.Args)...)
+	if err != nil {
+		return querier.QueryResponse{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	records, err := scanSQLiteLogRecords(ctx, rows)
+	if err != nil {
+		return querier.QueryResponse{}, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	return querier.QueryResponse{
+		Records:     records,
+		Cursor:      "", // TODO: Implement cursor-based pagination
+		DefaultSort: s.query.DefaultSort(),
+	}, nil
+}
+
+func (s *SQLiteStorage) Count(ctx context.Context, req querier.QueryRequest) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	result, err := s.query.BuildCount(req.Query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var count int64
+	if err := s.db.QueryRowContext(ctx, result.Query, sqliteArgs(result.Args)...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLiteStorage) Get(ctx context.Context, id uuid.UUID) (entity.LogRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, querier.DefaultQueryTimeout)
+	defer cancel()
+
+	result := s.query.BuildGet(id.String())
+
+	rows, err := s.db.QueryContext(ctx, result.Query, result.Args...)
+	if err != nil {
+		return entity.LogRecord{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	records, err := scanSQLiteLogRecords(ctx, rows)
+	if err != nil {
+		return entity.LogRecord{}, fmt.Errorf("failed to scan results: %w", err)
+	}
+
+	if len(records) == 0 {
+		return entity.LogRecord{}, querier.LogNotFoundError()
+	}
+
+	return records[0], nil
+}
+
+func (s *SQLiteStorage) GroupByCount(ctx context.Context, req querier.QueryRequest, field string) ([]querier.GroupCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	result, err := s.query.BuildGroupByCount(req.Query, field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, result.Query, sqliteArgs(result.Args)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []querier.GroupCount
+	for rows.Next() {
+		var value any
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		v := fmt.Sprint(value)
+		// Levels are stored by their numeric value, but reported by name like other storages do.
+		if n, ok := value.(int64); ok && field == "level" {
+			v = entity.LogLevel(n).String()
+		}
+		groups = append(groups, querier.GroupCount{Value: v, Count: count})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return groups, nil
+}
+
+func (s *SQLiteStorage) Distinct(ctx context.Context, req querier.QueryRequest, field string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	result, err := s.query.BuildDistinct(req.Query, field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, result.Query, sqliteArgs(result.Args)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value any
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		v := fmt.Sprint(value)
+		if querier.IsMetadataPath(field) {
+			if v, err = distinctJSONValue(field, v); err != nil {
+				return nil, err
+			}
+		} else if n, ok := value.(int64); ok && field == "level" {
+			// Levels are stored by their numeric value, but reported by name like other storages do.
+			v = entity.LogLevel(n).String()
+		}
+		values = append(values, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return values, nil
+}
+
+func (s *SQLiteStorage) Aggregate(ctx context.Context, req querier.QueryRequest, fn, field string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, req.GetTimeout())
+	defer cancel()
+
+	result, err := s.query.BuildAggregate(req.Query, fn, field)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var value sql.NullFloat64
+	if err := s.db.QueryRowContext(ctx, result.Query, sqliteArgs(result.Args)...).Scan(&value); err != nil {
+		return 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return value.Float64, nil
+}
+
+// Explain returns the SQL executed for the request.
+func (s *SQLiteStorage) Explain(req querier.QueryRequest) (querier.Explanation, error) {
+	result, err := s.query.Build(req.Query)
+	if err != nil {
+		return querier.Explanation{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	orderBy, err := s.query.BuildOrderBy(req.Query)
+	if err != nil {
+		return querier.Explanation{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	e := querier.NewExplanation(result.Query, sqliteArgs(result.Args))
+	if e.Plan, err = querier.NewPlan(req.Query, orderBy); err != nil {
+		return querier.Explanation{}, err
+	}
+
+	return e, nil
+}
+
+// sqliteArgs converts query arguments into their stored representation.
+func sqliteArgs(args []any) []any {
+	res := make([]any, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case time.Time:
+			res[i] = v.UnixNano()
+		case entity.LogLevel:
+			res[i] = int(v)
+		default:
+			res[i] = a
+		}
+	}
+	return res
+}
+
+// scanSQLiteLogRecords scans rows into log records. Columns are matched by name, so any subset of columns can be selected.
+// Scanning stops with the context error as soon as ctx is done.
+func scanSQLiteLogRecords(ctx context.Context, rows *sql.Rows) ([]entity.LogRecord, error) {
+	var records []entity.LogRecord
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var record entity.LogRecord
+		var id, metadata string
+		var timestamp int64
+		paths := make(map[string]*sql.NullString)
+
+		dest := make([]any, len(columns))
+		for i, c := range columns {
+			if querier.IsMetadataPath(c) {
+				paths[c] = new(sql.NullString)
+				dest[i] = paths[c]
+				continue
+			}
+
+			switch c {
+			case "id":
+				dest[i] = &id
+			case "source":
+				dest[i] = &record.Source
+			case "timestamp":
+				dest[i] = &timestamp
+			case "level":
+				dest[i] = &record.Level
+			case "message":
+				dest[i] = &record.Message
+			case "metadata":
+				dest[i] = &metadata
+			default:
+				return nil, fmt.Errorf("unexpected column: %s", c)
+			}
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		if id != "" {
+			if record.ID, err = uuid.Parse(id); err != nil {
+				return nil, fmt.Errorf("failed to parse id: %w", err)
+			}
+		}
+
+		if timestamp != 0 {
+			record.Timestamp = time.Unix(0, timestamp).UTC()
+		}
+
+		if metadata != "" {
+			if err := json.Unmarshal([]byte(metadata), &record.Metadata); err != nil {
+				return nil, fmt.Errorf("failed to parse metadata: %w", err)
+			}
+		}
+
+		for path, js := range paths {
+			if err := setProjectedMetadata(&record, path, js.String); err != nil {
+				return nil, err
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/logzilla/entity"
+	"github.com/thisisjab/logzilla/querier"
+)
+
+// newTestSQLiteStorage returns a connected SQLite storage backed by a temporary file and seeded with records.
+func newTestSQLiteStorage(t *testing.T, records ...entity.LogRecord) *SQLiteStorage {
+	t.Helper()
+
+	s, err := NewSQLiteStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), SQLiteStorageConfig{Path: filepath.Join(t.TempDir(), "logzilla.db")})
+	if err != nil {
+		t.Fatalf("cannot create storage: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	t.Cleanup(func() { s.Close(ctx) })
+
+	if err := s.StoreProcessedLogs(ctx, records...); err != nil {
+		t.Fatalf("cannot store logs: %v", err)
+	}
+	return s
+}
+
+func TestSQLiteArgs(t *testing.T) {
+	args := []any{testTime, entity.LogLevelError, "api", int64(7)}
+
+	want := []any{testTime.UnixNano(), int(entity.LogLevelError), "api", int64(7)}
+	if got := sqliteArgs(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestSQLiteStorageQuery(t *testing.T) {
+	records := []entity.LogRecord{
+		{ID: uuid.New(), Source: "api", Level: entity.LogLevelInfo, Timestamp: testTime, Message: "GET /users 200",
+			Metadata: map[string]any{"status": 200, "user": "alice"}},
+		{ID: uuid.New(), Source: "api", Level: entity.LogLevelError, Timestamp: testTime.Add(time.Second), Message: "GET /orders 503",
+			Metadata: map[string]any{"status": 503, "user": "bob"}},
+		{ID: uuid.New(), Source: "worker", Level: entity.LogLevelWarn, Timestamp: testTime.Add(2 * time.Second), Message: "job 42 retried",
+			Metadata: map[string]any{"status": "500", "user": "alice"}},
+		{ID: uuid.New(), Source: "worker", Level: entity.LogLevelError, Timestamp: testTime.Add(time.Hour), Message: "job 43 failed",
+			Metadata: map[string]any{"status": 500}},
+	}
+	s := newTestSQLiteStorage(t, records...)
+
+	tests := []struct {
+		name string
+		node querier.QueryNode
+		want []entity.LogRecord
+	}{
+		{
+			name: "no filter is limited to the time window",
+			want: records[:3],
+		},
+		{
+			name: "level name",
+			node: querier.ComparisonNode{FieldName: "level", Operator: querier.OperatorEq, Value: "error"},
+			want: records[1:2],
+		},
+		{
+			name: "level value",
+			node: querier.ComparisonNode{FieldName: "level", Operator: querier.OperatorGte, Value: entity.LogLevelWarn},
+			want: records[1:3],
+		},
+		{
+			name: "numeric metadata compares numbers stored as strings too",
+			node: querier.ComparisonNode{FieldName: "metadata.status", Operator: querier.OperatorGte, Value: 500},
+			want: records[1:3],
+		},
+		{
+			name: "string metadata",
+			node: querier.ComparisonNode{FieldName: "metadata.user", Operator: querier.OperatorEq, Value: "alice"},
+			want: []entity.LogRecord{records[0], records[2]},
+		},
+		{
+			name: "missing metadata key",
+			node: querier.ComparisonNode{FieldName: "metadata.region", Operator: querier.OperatorEq, Value: "eu"},
+		},
+		{
+			name: "match is not anchored",
+			node: querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorMatch, Value: `/(users|orders) [0-9]{3}$`},
+			want: records[:2],
+		},
+		{
+			name: "match on metadata",
+			node: querier.ComparisonNode{FieldName: "metadata.user", Operator: querier.OperatorMatch, Value: `^b`},
+			want: records[1:2],
+		},
+		{
+			name: "match combined with a metadata filter",
+			node: querier.AndNode{Children: []querier.QueryNode{
+				querier.ComparisonNode{FieldName: "message", Operator: querier.OperatorMatch, Value: `job \d+`},
+				querier.ComparisonNode{FieldName: "metadata.user", Operator: querier.OperatorEq, Value: "alice"},
+			}},
+			want: records[2:3],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{
+				Node:  tt.node,
+				Start: testTime,
+				End:   testTime.Add(time.Minute),
+				Limit: 100,
+			}})
+			if err != nil {
+				t.Fatalf("cannot query: %v", err)
+			}
+
+			if got, want := ids(resp.Records), ids(tt.want); !slices.Equal(got, want) {
+				t.Errorf("got records %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSQLiteStorageQueryRecord(t *testing.T) {
+	want := entity.LogRecord{ID: uuid.New(), Source: "api", Level: entity.LogLevelFatal, Timestamp: testTime.Add(time.Millisecond),
+		Message: "out of memory", Metadata: map[string]any{"host": "web-1"}}
+	s := newTestSQLiteStorage(t, want)
+
+	resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{Start: testTime, End: testTime.Add(time.Second), Limit: 10}})
+	if err != nil {
+		t.Fatalf("cannot query: %v", err)
+	}
+	if len(resp.Records) != 1 {
+		t.Fatalf("got %d records, want 1", len(resp.Records))
+	}
+
+	got := resp.Records[0]
+	if got.ID != want.ID || got.Source != want.Source || got.Level != want.Level || !got.Timestamp.Equal(want.Timestamp) || got.Message != want.Message {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(got.Metadata, want.Metadata) {
+		t.Errorf("got metadata %v, want %v", got.Metadata, want.Metadata)
+	}
+}
+
+func TestSQLiteStorageProjectsMetadataPaths(t *testing.T) {
+	records := []entity.LogRecord{
+		{ID: uuid.New(), Timestamp: testTime, Message: "signed in", Metadata: map[string]any{"user": "alice", "status": 200}},
+		{ID: uuid.New(), Timestamp: testTime.Add(time.Second), Message: "health check", Metadata: map[string]any{"status": 200}},
+	}
+	s := newTestSQLiteStorage(t, records...)
+
+	resp, err := s.Query(context.Background(), querier.QueryRequest{Query: querier.Query{
+		Start:  testTime,
+		Limit:  10,
+		Fields: []string{"id", "metadata.user"},
+	}})
+	if err != nil {
+		t.Fatalf("cannot query: %v", err)
+	}
+	if len(resp.Records) != len(records) {
+		t.Fatalf("got %d records, want %d", len(resp.Records), len(records))
+	}
+
+	want := []map[string]any{{"user": "alice"}, nil}
+	for i, got := range resp.Records {
+		if got.ID != records[i].ID || got.Message != "" {
+			t.Errorf("got %+v, want only the id %v and projected metadata", got, records[i].ID)
+		}
+		if !reflect.DeepEqual(got.Metadata, want[i]) {
+			t.Errorf("got metadata %v, want %v", got.Metadata, want[i])
+		}
+	}
+}